@@ -0,0 +1,90 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"patchmon-agent/internal/patching"
+	"patchmon-agent/internal/reporting"
+	"patchmon-agent/internal/wsproto"
+
+	"github.com/sirupsen/logrus"
+)
+
+// applyUpdatesTimeout bounds a single apply_updates run
+const applyUpdatesTimeout = 2 * time.Hour
+
+// updateRunner applies package updates requested over the WebSocket. It
+// allows one run at a time; concurrent requests are rejected.
+var updateRunner *patching.Runner
+
+// applyUpdatesProgress is a line of package manager output
+type applyUpdatesProgress struct {
+	Line string `json:"line"`
+}
+
+// applyUpdatesResult is the outcome of an apply_updates run, sent as the
+// result payload or as error details when the package manager failed
+type applyUpdatesResult struct {
+	PackageManager  string                   `json:"package_manager"`
+	ExitCode        int                      `json:"exit_code"`
+	PackagesChanged []patching.PackageChange `json:"packages_changed"`
+	RebootRequired  bool                     `json:"reboot_required"`
+}
+
+// runApplyUpdates applies the updates requested by an apply_updates message,
+// streams the package manager output back to the server, reports the result
+// and then sends a fresh report so the server sees the new package state.
+func runApplyUpdates(ctx context.Context, m wsMsg) {
+	log := logger.WithFields(logrus.Fields{
+		"id":   m.reply.id,
+		"mode": m.mode,
+	})
+	log.Info("Applying updates")
+
+	ctx, cancel := context.WithTimeout(ctx, applyUpdatesTimeout)
+	defer cancel()
+
+	req := patching.Request{
+		Mode:     patching.Mode(m.mode),
+		Packages: m.packages,
+		Exclude:  m.exclude,
+	}
+	result, err := updateRunner.Apply(ctx, req, func(line string) {
+		m.reply.progress(applyUpdatesProgress{Line: line})
+	})
+
+	// Rejected requests never touched the package manager
+	if result == nil {
+		if errors.Is(err, patching.ErrBusy) {
+			err = wsproto.Errorf(wsproto.ErrCodeBusy, "%v", err)
+		}
+		log.WithError(err).Warn("apply_updates rejected")
+		finishCommand(m, nil, err, nil)
+		return
+	}
+
+	summary := applyUpdatesResult{
+		PackageManager:  result.PackageManager,
+		ExitCode:        result.ExitCode,
+		PackagesChanged: result.Changes,
+		RebootRequired:  result.RebootRequired,
+	}
+	if summary.PackagesChanged == nil {
+		summary.PackagesChanged = []patching.PackageChange{}
+	}
+	if err != nil {
+		log.WithError(err).Warn("apply_updates failed")
+	} else {
+		log.WithFields(logrus.Fields{
+			"changed":         len(summary.PackagesChanged),
+			"reboot_required": summary.RebootRequired,
+		}).Info("apply_updates completed")
+	}
+	finishCommand(m, summary, err, summary)
+
+	if err := requestReport(ctx, reporting.ReasonPatched); err != nil {
+		log.WithError(err).Warn("report after apply_updates failed")
+	}
+}
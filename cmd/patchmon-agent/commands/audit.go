@@ -0,0 +1,137 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+
+	"patchmon-agent/internal/audit"
+	"patchmon-agent/internal/config"
+	"patchmon-agent/internal/version"
+
+	"github.com/spf13/cobra"
+)
+
+// auditLog records every command received over the WebSocket
+var auditLog = audit.New(config.DefaultAuditFile)
+
+// auditCmd represents the audit command
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Show and verify the audit log of server-initiated actions",
+	Long: `Show the audit log of commands received from the PatchMon server and
+verify its hash chain. A broken chain means entries were edited, removed or
+reordered, and makes the command exit with an error.
+
+Examples:
+  patchmon-agent audit              # Show all entries
+  patchmon-agent audit -n 20        # Show the last 20 entries
+  patchmon-agent audit --json       # Print entries as JSON lines
+  patchmon-agent audit --verify     # Only verify the chain`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkRoot(); err != nil {
+			return err
+		}
+
+		last, _ := cmd.Flags().GetInt("last")
+		asJSON, _ := cmd.Flags().GetBool("json")
+		verifyOnly, _ := cmd.Flags().GetBool("verify")
+
+		return showAudit(last, asJSON, verifyOnly)
+	},
+}
+
+func init() {
+	auditCmd.Flags().IntP("last", "n", 0, "Show only the last N entries")
+	auditCmd.Flags().Bool("json", false, "Print entries as JSON lines")
+	auditCmd.Flags().Bool("verify", false, "Only verify the hash chain")
+}
+
+func showAudit(last int, asJSON, verifyOnly bool) error {
+	entries, err := audit.Read(auditLog.Path())
+	if errors.Is(err, fs.ErrNotExist) {
+		fmt.Printf("No audit log at %s\n", auditLog.Path())
+		return nil
+	}
+	var verifyErr *audit.VerifyError
+	if err != nil && !errors.As(err, &verifyErr) {
+		return err
+	}
+
+	if !verifyOnly {
+		shown := entries
+		if last > 0 && len(shown) > last {
+			shown = shown[len(shown)-last:]
+		}
+		for _, entry := range shown {
+			if asJSON {
+				line, err := json.Marshal(entry)
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(line))
+				continue
+			}
+			printAuditEntry(entry)
+		}
+	}
+
+	if verifyErr != nil {
+		return fmt.Errorf("audit log verification failed after %d valid entries: %w", len(entries), verifyErr)
+	}
+	if !asJSON {
+		fmt.Printf("✅ Audit log verified: %d entries, chain intact\n", len(entries))
+	}
+	return nil
+}
+
+func printAuditEntry(entry audit.Entry) {
+	line := fmt.Sprintf("#%d %s %-20s %-9s", entry.Seq, entry.Time.Local().Format("2006-01-02T15:04:05"), entry.Command, entry.Outcome)
+	if entry.ID != "" {
+		line += " id=" + entry.ID
+	}
+	if len(entry.Params) > 0 {
+		params, _ := json.Marshal(entry.Params)
+		line += " params=" + string(params)
+	}
+	if entry.VersionBefore != "" && entry.VersionAfter != "" && entry.VersionBefore != entry.VersionAfter {
+		line += fmt.Sprintf(" version=%s->%s", entry.VersionBefore, entry.VersionAfter)
+	}
+	if entry.Reason != "" {
+		line += " reason=" + strings.ReplaceAll(entry.Reason, "\n", " ")
+	}
+	fmt.Println(line)
+}
+
+// recordCommand appends the outcome of a WebSocket command to the audit log.
+// versionAfter defaults to the running version.
+func recordCommand(m wsMsg, outcome, reason, versionAfter string) {
+	if versionAfter == "" {
+		versionAfter = version.Version
+	}
+	entry := audit.Entry{
+		Command:       m.kind,
+		ID:            m.reply.id,
+		Params:        m.params(),
+		Outcome:       outcome,
+		Reason:        reason,
+		VersionBefore: version.Version,
+		VersionAfter:  versionAfter,
+	}
+	if _, err := auditLog.Append(entry); err != nil {
+		logger.WithError(err).WithField("command", m.kind).Error("Failed to write audit log")
+	}
+}
+
+// finishCommand sends the final reply for a command and records its outcome
+func finishCommand(m wsMsg, result interface{}, err error, details interface{}) {
+	if err != nil {
+		m.reply.fail(err, details)
+		recordCommand(m, audit.OutcomeFailed, err.Error(), "")
+		return
+	}
+	m.reply.result(result)
+	recordCommand(m, audit.OutcomeSucceeded, "", "")
+}
@@ -0,0 +1,59 @@
+package commands
+
+import (
+	"time"
+
+	"patchmon-agent/internal/audit"
+	"patchmon-agent/internal/config"
+	"patchmon-agent/internal/policy"
+	"patchmon-agent/internal/wsproto"
+
+	"github.com/sirupsen/logrus"
+)
+
+// authorizeCommand evaluates the local command policy for a remote command
+// and logs an audit line with the decision. Refused commands are answered
+// with an error frame. The policy is re-read for every command so edits take
+// effect without restarting the agent.
+func authorizeCommand(m *wsMsg) bool {
+	var decision policy.Decision
+
+	pol, err := policy.Load(config.DefaultPolicyFile)
+	if err != nil {
+		// Fail closed: a broken policy must not turn into allow-all
+		logger.WithError(err).Error("Failed to load command policy, refusing remote commands")
+		decision = policy.Decision{Reason: "command policy is invalid"}
+	} else {
+		now := time.Now()
+		decision = pol.Evaluate(policy.Command{Kind: m.kind, Packages: m.packages}, now)
+		// A forced update notification replaces the binary just like update_agent
+		if decision.Allowed && m.kind == "update_notification" && m.force {
+			decision = pol.Evaluate(policy.Command{Kind: "update_agent"}, now)
+		}
+	}
+
+	fields := logrus.Fields{
+		"audit":   "command",
+		"command": m.kind,
+		"id":      m.reply.id,
+		"reason":  decision.Reason,
+	}
+	if m.kind == "apply_updates" {
+		fields["mode"] = m.mode
+		fields["packages"] = m.packages
+	}
+
+	if !decision.Allowed {
+		fields["decision"] = "refused"
+		logger.WithFields(fields).Warn("Remote command refused")
+		m.reply.fail(wsproto.Errorf(wsproto.ErrCodeDenied, "%s", decision.Reason), nil)
+		recordCommand(*m, audit.OutcomeRefused, decision.Reason, "")
+		return false
+	}
+
+	fields["decision"] = "accepted"
+	logger.WithFields(fields).Info("Remote command accepted")
+	m.exclude = decision.Exclude
+	recordCommand(*m, audit.OutcomeAccepted, decision.Reason, "")
+	return true
+}
@@ -2,13 +2,16 @@ package commands
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"patchmon-agent/internal/client"
+	"patchmon-agent/internal/control"
 	"patchmon-agent/internal/hardware"
 	"patchmon-agent/internal/network"
 	"patchmon-agent/internal/packages"
+	"patchmon-agent/internal/reporting"
 	"patchmon-agent/internal/repositories"
 	"patchmon-agent/internal/system"
 	"patchmon-agent/internal/version"
@@ -22,17 +25,52 @@ import (
 var reportCmd = &cobra.Command{
 	Use:   "report",
 	Short: "Report system and package information to server",
-	Long:  "Collect and report system, package, and repository information to the PatchMon server.",
+	Long: `Collect and report system, package, and repository information to the PatchMon server.
+
+With --via-daemon the running agent service sends the report, so it does not
+race the service's own reports. Without a running service the report is sent
+directly.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if err := checkRoot(); err != nil {
 			return err
 		}
 
-		return sendReport()
+		if viaDaemon, _ := cmd.Flags().GetBool("via-daemon"); viaDaemon {
+			err := reportViaDaemon(cmd.Context())
+			if !errors.Is(err, control.ErrNotRunning) {
+				return err
+			}
+			fmt.Println("Agent service is not running, sending the report directly")
+		}
+		return sendReport(cmd.Context())
 	},
 }
 
-func sendReport() error {
+func init() {
+	reportCmd.Flags().Bool("via-daemon", false, "Have the running agent service send the report")
+}
+
+// reports serialises report runs in serve mode; it is nil otherwise
+var reports *reporting.Coordinator
+
+// reportRunKey marks the context of a coordinated report run
+type reportRunKey struct{}
+
+// requestReport sends a report. In serve mode the run goes through the
+// coordinator: callers wait for it, except from within a report run (an
+// auto-update during a report), where the request is queued as a follow-up.
+func requestReport(ctx context.Context, reason string) error {
+	if reports == nil {
+		return sendReport(ctx)
+	}
+	if ctx.Value(reportRunKey{}) != nil {
+		reports.Trigger(reason)
+		return nil
+	}
+	return reports.Run(ctx, reason)
+}
+
+func sendReport(ctx context.Context) error {
 	// Start tracking execution time
 	startTime := time.Now()
 	logger.Debug("Starting report process")
@@ -81,6 +119,11 @@ func sendReport() error {
 	logger.Info("Collecting network information...")
 	networkInfo := networkMgr.GetNetworkInfo()
 
+	// Package collection is the slow part; don't start it when shutting down
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("report aborted: %w", err)
+	}
+
 	// Get package information
 	logger.Info("Collecting package information...")
 	packageList, err := packageMgr.GetPackages()
@@ -110,6 +153,7 @@ func sendReport() error {
 		logger.WithFields(logrus.Fields{
 			"name":    pkg.Name,
 			"version": pkg.CurrentVersion,
+			"source":  pkg.Source,
 			"status":  updateMsg,
 		}).Debug("Package info")
 	}
@@ -165,10 +209,13 @@ func sendReport() error {
 		ExecutionTime:     executionTime,
 	}
 
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("report aborted: %w", err)
+	}
+
 	// Send report
 	logger.Info("Sending report to PatchMon server...")
 	httpClient := client.New(cfgManager, logger)
-	ctx := context.Background()
 	response, err := httpClient.SendUpdate(ctx, payload)
 	if err != nil {
 		return fmt.Errorf("failed to send report: %w", err)
@@ -177,40 +224,17 @@ func sendReport() error {
 	logger.Info("Report sent successfully")
 	logger.WithField("count", response.PackagesProcessed).Info("Processed packages")
 
-	// Handle agent auto-update (server-initiated)
+	// Handle agent auto-update, subject to the update policy
 	if response.AutoUpdate != nil && response.AutoUpdate.ShouldUpdate {
 		logger.WithFields(logrus.Fields{
 			"current": response.AutoUpdate.CurrentVersion,
 			"latest":  response.AutoUpdate.LatestVersion,
 			"message": response.AutoUpdate.Message,
 		}).Info("PatchMon agent update detected")
-
-		logger.Info("Automatically updating PatchMon agent to latest version...")
-		if err := updateAgent(); err != nil {
-			logger.WithError(err).Warn("PatchMon agent update failed, but data was sent successfully")
-		} else {
-			logger.Info("PatchMon agent update completed successfully")
-		}
-	} else {
-		// Proactive update check after report
-		logger.Info("Checking for agent updates...")
-		versionInfo, err := getServerVersionInfo()
-		if err != nil {
-			logger.WithError(err).Warn("Failed to check for updates after report")
-		} else if versionInfo.HasUpdate {
-			logger.WithFields(logrus.Fields{
-				"current": versionInfo.CurrentVersion,
-				"latest":  versionInfo.LatestVersion,
-			}).Info("Update available, automatically updating...")
-
-			if err := updateAgent(); err != nil {
-				logger.WithError(err).Warn("PatchMon agent update failed, but data was sent successfully")
-			} else {
-				logger.Info("PatchMon agent update completed successfully")
-			}
-		} else {
-			logger.WithField("version", versionInfo.CurrentVersion).Debug("Agent is up to date")
-		}
+	}
+	// The service checks for agent updates itself, off the report run
+	if ctx.Value(reportRunKey{}) == nil && autoUpdateAgent(ctx, httpClient, payload.MachineID) {
+		finishAgentUpdate(ctx)
 	}
 
 	logger.Debug("Report process completed")
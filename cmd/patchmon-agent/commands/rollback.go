@@ -0,0 +1,289 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+
+	"patchmon-agent/internal/backups"
+	"patchmon-agent/internal/client"
+	"patchmon-agent/internal/config"
+	"patchmon-agent/internal/probation"
+	"patchmon-agent/internal/version"
+	"patchmon-agent/pkg/models"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// probationPeriod is how long a freshly installed agent has to reach the
+	// server before the previous binary is restored
+	probationPeriod = 10 * time.Minute
+	// probationPoll is how often the watchdog checks the probation state
+	probationPoll = 5 * time.Second
+	// confirmRetry is how often the new agent retries reaching the server
+	confirmRetry = 15 * time.Second
+)
+
+// rollbackCmd lists the agent builds kept by self-updates or restores one
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback",
+	Short: "List or restore agent builds kept by self-updates",
+	Long: `List the agent builds kept by self-updates, or restore one of them.
+
+Examples:
+  patchmon-agent rollback              # List the retained builds
+  patchmon-agent rollback --to 1.3.0   # Restore version 1.3.0 and restart the service`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkRoot(); err != nil {
+			return err
+		}
+
+		to, _ := cmd.Flags().GetString("to")
+		if to == "" {
+			return listBackups()
+		}
+		return rollbackTo(to)
+	},
+}
+
+func init() {
+	rollbackCmd.Flags().String("to", "", "Version to restore")
+}
+
+// rollbackWatchdogCmd waits for a self-update to be confirmed and restores
+// the previous binary otherwise. It is started from the previous binary by
+// finishAgentUpdate, outside the service, so restarting the service does not
+// stop it.
+var rollbackWatchdogCmd = &cobra.Command{
+	Use:    "rollback-watchdog",
+	Short:  "Restore the previous agent if an update does not come up healthy",
+	Hidden: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkRoot(); err != nil {
+			return err
+		}
+
+		return runRollbackWatchdog(cmd.Context())
+	},
+}
+
+// startProbation records the update just installed as pending confirmation
+func startProbation(previousVersion, newVersion, executablePath, backupPath string) error {
+	sha, err := probation.FileSHA256(executablePath)
+	if err != nil {
+		return fmt.Errorf("failed to hash new executable: %w", err)
+	}
+
+	now := time.Now()
+	return probation.Save(config.DefaultUpdateStateFile, &probation.State{
+		Status:          probation.StatusPending,
+		PreviousVersion: previousVersion,
+		NewVersion:      newVersion,
+		NewSHA256:       sha,
+		Executable:      executablePath,
+		BackupPath:      backupPath,
+		InstalledAt:     now,
+		Deadline:        now.Add(probationPeriod),
+	})
+}
+
+// cancelProbation drops a pending probation, for updates that are not
+// started as a service and so cannot be judged by it
+func cancelProbation() {
+	if err := os.Remove(config.DefaultUpdateStateFile); err != nil && !os.IsNotExist(err) {
+		logger.WithError(err).Warn("Failed to remove update state")
+	}
+}
+
+// startRollbackWatchdog runs the watchdog from the backup of the previous
+// binary. systemd-run puts it in its own unit, so that restarting the agent
+// service does not kill it; without systemd it runs in a new session.
+func startRollbackWatchdog(state *probation.State) error {
+	args := []string{state.BackupPath, "rollback-watchdog", "--config", configFile}
+
+	if systemdRun, err := exec.LookPath("systemd-run"); err == nil {
+		unit := fmt.Sprintf("--unit=patchmon-agent-rollback-%d", time.Now().Unix())
+		cmd := exec.Command(systemdRun, append([]string{unit, "--collect", "--quiet"}, args...)...)
+		output, err := cmd.CombinedOutput()
+		if err == nil {
+			return nil
+		}
+		logger.WithError(err).WithField("output", string(output)).Warn("systemd-run failed, starting rollback watchdog directly")
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	return cmd.Process.Release()
+}
+
+// runRollbackWatchdog waits until the pending update is confirmed or its
+// deadline passes, and rolls it back in the latter case
+func runRollbackWatchdog(ctx context.Context) error {
+	for {
+		state, err := probation.Load(config.DefaultUpdateStateFile)
+		if err != nil {
+			return err
+		}
+		if state == nil || state.Status != probation.StatusPending {
+			logger.Info("Update probation ended, rollback watchdog exiting")
+			return nil
+		}
+		if time.Now().After(state.Deadline) {
+			reason := fmt.Sprintf("version %s did not reach the server within %s of being installed",
+				state.NewVersion, probationPeriod)
+			return rollBackUpdate(ctx, state, reason)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(probationPoll):
+		}
+	}
+}
+
+// rollBackUpdate restores the previous binary, restarts the service onto it
+// and tells the server which version failed
+func rollBackUpdate(ctx context.Context, state *probation.State, reason string) error {
+	log := logger.WithFields(logrus.Fields{
+		"failed_version":   state.NewVersion,
+		"restored_version": state.PreviousVersion,
+	})
+	log.WithField("reason", reason).Error("Agent update failed its health check, rolling back")
+
+	if err := probation.Restore(state); err != nil {
+		return fmt.Errorf("failed to restore previous agent: %w", err)
+	}
+	state.Status = probation.StatusRolledBack
+	state.Reason = reason
+	if err := probation.Save(config.DefaultUpdateStateFile, state); err != nil {
+		log.WithError(err).Warn("Failed to record rollback")
+	}
+
+	if err := restartService(); err != nil {
+		log.WithError(err).Warn("Failed to restart service after rollback")
+	}
+	log.Info("Previous agent restored")
+
+	if err := cfgManager.LoadCredentials(); err != nil {
+		return fmt.Errorf("failed to report rollback: %w", err)
+	}
+	err := client.New(cfgManager, logger).ReportRollback(ctx, &models.AgentRollbackPayload{
+		FailedVersion:   state.NewVersion,
+		RestoredVersion: state.PreviousVersion,
+		Reason:          reason,
+		InstalledAt:     state.InstalledAt,
+		RolledBackAt:    time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to report rollback: %w", err)
+	}
+	return nil
+}
+
+// confirmUpdate ends the probation of a freshly installed agent once it has
+// reached the server. It returns at once when nothing awaits confirmation.
+func confirmUpdate(ctx context.Context, httpClient *client.Client) {
+	state, err := probation.Load(config.DefaultUpdateStateFile)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to read update state")
+		return
+	}
+	if state == nil || state.Status != probation.StatusPending {
+		return
+	}
+	executablePath, err := os.Executable()
+	if err != nil {
+		return
+	}
+	sha, err := probation.FileSHA256(executablePath)
+	if err != nil || !state.PendingFor(sha) {
+		return
+	}
+
+	for {
+		_, err := httpClient.Ping(ctx)
+		if err == nil {
+			if _, err := probation.Confirm(config.DefaultUpdateStateFile, sha); err != nil {
+				logger.WithError(err).Warn("Failed to confirm agent update")
+				return
+			}
+			logger.WithField("version", state.NewVersion).Info("Agent update confirmed healthy")
+			return
+		}
+		logger.WithError(err).Warn("New agent cannot reach the server yet")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(confirmRetry):
+		}
+	}
+}
+
+// listBackups prints the retained agent builds, newest first
+func listBackups() error {
+	list, err := backups.List(config.DefaultBackupDir)
+	if err != nil {
+		return err
+	}
+	if len(list) == 0 {
+		fmt.Printf("No agent backups in %s\n", config.DefaultBackupDir)
+		return nil
+	}
+
+	fmt.Printf("Agent backups in %s (running version %s):\n\n", config.DefaultBackupDir, version.Version)
+	fmt.Printf("%-16s %-20s %-10s %s\n", "VERSION", "CREATED", "SIZE", "SHA256")
+	for _, b := range list {
+		fmt.Printf("%-16s %-20s %-10s %s\n", b.Version, b.CreatedAt.Local().Format("2006-01-02 15:04:05"),
+			fmt.Sprintf("%.1f MB", float64(b.Size)/(1024*1024)), b.SHA256)
+	}
+	return nil
+}
+
+// rollbackTo restores the newest retained build of the given version. The
+// running build is kept as a backup, so the rollback can be undone.
+func rollbackTo(target string) error {
+	backup, err := backups.Find(config.DefaultBackupDir, target)
+	if err != nil {
+		return err
+	}
+	if err := backup.Verify(); err != nil {
+		return err
+	}
+
+	executablePath, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to get executable path: %w", err)
+	}
+
+	current, err := backups.Save(config.DefaultBackupDir, executablePath, strings.TrimPrefix(version.Version, "v"), time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to back up running agent: %w", err)
+	}
+	logger.WithField("path", current.Path).Info("Backup saved")
+
+	if err := backup.Restore(executablePath); err != nil {
+		return fmt.Errorf("failed to restore agent %s: %w", backup.Version, err)
+	}
+	// A rollback ends any update still on probation
+	cancelProbation()
+	pruneBackups(executablePath)
+
+	logger.Info("Restarting patchmon-agent service...")
+	if err := restartService(); err != nil {
+		logger.WithError(err).Warn("Failed to restart service (this is not critical)")
+	}
+
+	fmt.Printf("✅ Restored patchmon-agent %s (sha256 %s)\n", backup.Version, backup.SHA256)
+	return nil
+}
@@ -56,6 +56,10 @@ func init() {
 	rootCmd.AddCommand(updateAgentCmd)
 	rootCmd.AddCommand(diagnosticsCmd)
 	rootCmd.AddCommand(uninstallCmd)
+	rootCmd.AddCommand(auditCmd)
+	rootCmd.AddCommand(statusCmd)
+	rootCmd.AddCommand(rollbackCmd)
+	rootCmd.AddCommand(rollbackWatchdogCmd)
 }
 
 // initialiseAgent initialises the configuration manager and logger
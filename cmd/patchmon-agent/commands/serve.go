@@ -2,14 +2,29 @@ package commands
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
+	"patchmon-agent/internal/audit"
 	"patchmon-agent/internal/client"
+	"patchmon-agent/internal/config"
+	"patchmon-agent/internal/control"
+	"patchmon-agent/internal/patching"
+	"patchmon-agent/internal/reporting"
+	"patchmon-agent/internal/sdnotify"
+	"patchmon-agent/internal/system"
+	"patchmon-agent/internal/wsproto"
+	"patchmon-agent/pkg/models"
 
 	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
@@ -21,7 +36,7 @@ var serveCmd = &cobra.Command{
 		if err := checkRoot(); err != nil {
 			return err
 		}
-		return runService()
+		return runService(cmd.Context())
 	},
 }
 
@@ -29,90 +44,471 @@ func init() {
 	rootCmd.AddCommand(serveCmd)
 }
 
-func runService() error {
+// shutdownGrace is how long serve waits for in-flight apply_updates runs and
+// agent updates on shutdown before cancelling them
+const shutdownGrace = 60 * time.Second
+
+// agentUpdateTimeout bounds downloading and installing an agent update
+const agentUpdateTimeout = time.Hour
+
+func runService(ctx context.Context) error {
+	serviceStatus.started = time.Now()
 	if err := cfgManager.LoadCredentials(); err != nil {
 		return err
 	}
 
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	// Package upgrades must not be killed halfway by a stop request, so they
+	// run on their own context which is only cancelled after shutdownGrace
+	workCtx, cancelWork := context.WithCancel(context.Background())
+	defer cancelWork()
+	var inflight sync.WaitGroup
+
 	httpClient := client.New(cfgManager, logger)
-	ctx := context.Background()
 
-	// obtain initial interval
+	// obtain initial interval and any schedule set on the server
 	intervalMinutes := 60
-	if resp, err := httpClient.GetUpdateInterval(ctx); err == nil && resp.UpdateInterval > 0 {
-		intervalMinutes = resp.UpdateInterval
+	var serverSchedule *models.ReportSchedule
+	if resp, err := httpClient.GetUpdateInterval(ctx); err == nil {
+		if resp.UpdateInterval > 0 {
+			intervalMinutes = resp.UpdateInterval
+		}
+		serverSchedule = resp.Schedule
 	}
 
-	ticker := time.NewTicker(time.Duration(intervalMinutes) * time.Minute)
-	defer ticker.Stop()
+	// Reports are spread over the interval per host, so a fleet restarted
+	// or reconfigured at once does not report in the same second
+	machineID := system.New(logger).GetMachineID()
+	schedule := reporting.NewSchedule(machineID,
+		time.Duration(intervalMinutes)*time.Minute, cfgManager.GetConfig().ReportJitter)
+	applyReportSchedule(schedule, serverSchedule)
+	startupPending := true
+	startup := schedule.Startup(time.Now())
+	timer := time.NewTimer(time.Until(startup))
+	defer timer.Stop()
+	serviceStatus.setSchedule(schedule)
+	serviceStatus.setNextReport(startup)
+
+	updateRunner = patching.New(logger)
+	notifier := sdnotify.New()
+	reports = reporting.New(ctx, logger, func(ctx context.Context, reasons []string) error {
+		err := sendReport(context.WithValue(ctx, reportRunKey{}, reasons))
+		outcome := "succeeded"
+		if err != nil {
+			outcome = "failed: " + err.Error()
+		}
+		notify(notifier.Status(fmt.Sprintf("Last report at %s %s", time.Now().Format(time.RFC3339), outcome)))
+		// The download may take long; the report run must not wait for it
+		if err == nil && ctx.Err() == nil {
+			startAgentUpdate(workCtx, &inflight, func(ctx context.Context) bool {
+				return autoUpdateAgent(ctx, client.New(cfgManager, logger), machineID)
+			})
+		}
+		return err
+	})
 
-	// initial report on boot
-	if err := sendReport(); err != nil {
-		logger.WithError(err).Warn("initial report failed")
+	// The CLI reaches the service through the control socket instead of
+	// running its own reports alongside it
+	controlServer := control.NewServer(logger, config.DefaultControlSocket, serviceStatus)
+	if err := controlServer.Start(); err != nil {
+		logger.WithError(err).Warn("Control socket unavailable")
 	}
 
 	// start websocket loop
 	messages := make(chan wsMsg, 10)
-	go wsLoop(messages)
+	ws := startWSLoop(ctx, messages)
+
+	// With WatchdogSec= systemd restarts the service unless pinged; pings
+	// come from this loop and only while nothing is stuck
+	var watchdog <-chan time.Time
+	if interval := notifier.WatchdogInterval(); interval > 0 {
+		watchdogTicker := time.NewTicker(interval / 2)
+		defer watchdogTicker.Stop()
+		watchdog = watchdogTicker.C
+		logger.WithField("timeout", interval.String()).Info("systemd watchdog enabled")
+	}
+	notify(notifier.Ready())
+
+	// A freshly updated agent confirms it works before the watchdog of the
+	// previous version rolls it back
+	go confirmUpdate(ctx, httpClient)
+	notify(notifier.Status("Running, first report at " + startup.Format(time.RFC3339)))
 
 	for {
 		select {
-		case <-ticker.C:
-			if err := sendReport(); err != nil {
-				logger.WithError(err).Warn("periodic report failed")
+		case <-ctx.Done():
+			logger.Info("Shutting down")
+			notify(notifier.Stopping())
+			ws.stop()
+			if err := controlServer.Close(5 * time.Second); err != nil {
+				logger.WithError(err).Debug("Failed to close control socket")
+			}
+			// Report runs may start agent updates, so they end first
+			reports.Wait()
+			waitForCommands(&inflight, cancelWork)
+			logger.Info("Shutdown complete")
+			return nil
+		case <-hup:
+			logger.Info("SIGHUP received, reloading configuration")
+			ws.stop()
+			if err := reloadConfig(); err != nil {
+				logger.WithError(err).Error("Failed to reload configuration")
+			}
+			schedule.SetJitter(cfgManager.GetConfig().ReportJitter)
+			applyReportSchedule(schedule, serverSchedule)
+			serviceStatus.setSchedule(schedule)
+			if !startupPending {
+				resetReportTimer(timer, schedule)
+			}
+			ws = startWSLoop(ctx, messages)
+		case <-watchdog:
+			if err := serviceStatus.health(time.Now()); err != nil {
+				logger.WithError(err).Error("Service unhealthy, withholding systemd watchdog ping")
+				continue
+			}
+			notify(notifier.Watchdog())
+		case <-timer.C:
+			reason := reporting.ReasonSchedule
+			if startupPending {
+				reason = reporting.ReasonStartup
+				startupPending = false
 			}
+			reports.Trigger(reason)
+			resetReportTimer(timer, schedule)
 		case m := <-messages:
+			if !authorizeCommand(&m) {
+				continue
+			}
+			m.reply.progress(wsProgress{Stage: "started"})
 			switch m.kind {
 			case "settings_update":
 				if m.interval > 0 {
-					ticker.Stop()
-					ticker = time.NewTicker(time.Duration(m.interval) * time.Minute)
+					schedule.SetInterval(time.Duration(m.interval) * time.Minute)
 					logger.WithField("new_interval", m.interval).Info("interval updated, no report sent")
 				}
-			case "report_now":
-				if err := sendReport(); err != nil {
-					logger.WithError(err).Warn("report_now failed")
+				if m.schedule != nil {
+					serverSchedule = m.schedule
+					applyReportSchedule(schedule, serverSchedule)
 				}
-			case "update_agent":
-				if err := updateAgent(); err != nil {
-					logger.WithError(err).Warn("update_agent failed")
+				serviceStatus.setSchedule(schedule)
+				// The startup report keeps its slot; later ones move to the
+				// new schedule, on this host's phase for intervals
+				if !startupPending {
+					resetReportTimer(timer, schedule)
 				}
+				finishCommand(m, map[string]interface{}{
+					"update_interval": m.interval,
+					"schedule":        schedule.Describe(),
+				}, nil, nil)
+			case "report_now":
+				// Wait for the run off the main loop so commands keep flowing
+				inflight.Add(1)
+				go func() {
+					defer inflight.Done()
+					finishCommand(m, nil, reports.Run(ctx, reporting.ReasonServerRequest), nil)
+				}()
+			case "update_agent":
+				startAgentUpdate(workCtx, &inflight, func(ctx context.Context) bool { return runAgentUpdate(ctx, m) })
 			case "update_notification":
 				logger.WithField("version", m.version).Info("Update notification received from server")
 				if m.force {
 					logger.Info("Force update requested, updating agent now")
-					if err := updateAgent(); err != nil {
-						logger.WithError(err).Warn("forced update failed")
-					}
-				} else {
-					logger.Info("Update available, run 'patchmon-agent update-agent' to update")
+					startAgentUpdate(workCtx, &inflight, func(ctx context.Context) bool { return runAgentUpdate(ctx, m) })
+					continue
 				}
+				logger.Info("Update available, run 'patchmon-agent update-agent' to update")
+				finishCommand(m, map[string]bool{"updated": false}, nil, nil)
+			case "apply_updates":
+				// Upgrades can run for a long time; keep serving reports meanwhile
+				inflight.Add(1)
+				go func() {
+					defer inflight.Done()
+					runApplyUpdates(workCtx, m)
+				}()
 			}
 		}
 	}
 }
 
+// applyReportSchedule applies the report schedule from the config file, or
+// the one pushed by the server when the config file sets none. An invalid
+// schedule is logged and the previous one kept.
+func applyReportSchedule(schedule *reporting.Schedule, server *models.ReportSchedule) {
+	spec, source := cfgManager.GetConfig().Schedule, "config"
+	if spec.IsZero() && server != nil {
+		spec, source = *server, "server"
+	} else if server != nil && !server.IsZero() {
+		logger.Info("Report schedule from the config file overrides the one set on the server")
+	}
+
+	if err := schedule.SetSpec(spec); err != nil {
+		logger.WithError(err).WithField("source", source).Error("Invalid report schedule, keeping the previous one")
+		return
+	}
+	logger.WithFields(logrus.Fields{
+		"schedule": schedule.Describe(),
+		"source":   source,
+	}).Info("Report schedule applied")
+}
+
+// notify logs a failure to notify systemd, which never stops the service
+func notify(err error) {
+	if err != nil {
+		logger.WithError(err).Debug("Failed to notify systemd")
+	}
+}
+
+// resetReportTimer arms timer for the next scheduled report
+func resetReportTimer(timer *time.Timer, schedule *reporting.Schedule) {
+	next := schedule.Next(time.Now())
+	serviceStatus.setNextReport(next)
+	if next.IsZero() {
+		timer.Stop()
+		logger.Warn("No report time outside the blackout windows, scheduled reports stopped")
+		return
+	}
+	timer.Reset(time.Until(next))
+	logger.WithField("next_report", next.Format(time.RFC3339)).Debug("Scheduled next report")
+}
+
+// waitForCommands waits for in-flight commands to finish, cancelling them
+// once shutdownGrace has passed
+func waitForCommands(inflight *sync.WaitGroup, cancel context.CancelFunc) {
+	done := make(chan struct{})
+	go func() {
+		inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(shutdownGrace):
+		logger.Warn("In-flight commands did not finish in time, cancelling them")
+		cancel()
+		<-done
+	}
+}
+
+// reloadConfig re-reads the config and credentials files, re-applying the
+// configured log level unless it was given on the command line
+func reloadConfig() error {
+	if err := cfgManager.LoadConfig(); err != nil {
+		return err
+	}
+	if err := cfgManager.LoadCredentials(); err != nil {
+		return err
+	}
+
+	if flag := rootCmd.PersistentFlags().Lookup("log-level"); flag == nil || !flag.Changed {
+		if level, err := logrus.ParseLevel(cfgManager.GetConfig().LogLevel); err == nil {
+			logger.SetLevel(level)
+		}
+	}
+	return nil
+}
+
+// startAgentUpdate runs install off the main loop, which must keep pinging
+// the systemd watchdog while the binary downloads, and off report runs. The
+// install is tracked by inflight so a stop request does not cut it short;
+// the service restart that follows when it reports success is not, as it
+// stops this process.
+func startAgentUpdate(ctx context.Context, inflight *sync.WaitGroup, install func(context.Context) bool) {
+	inflight.Add(1)
+	go func() {
+		installCtx, cancel := context.WithTimeout(ctx, agentUpdateTimeout)
+		installed := install(installCtx)
+		cancel()
+		inflight.Done()
+		if installed {
+			finishAgentUpdate(ctx)
+		}
+	}()
+}
+
+// runAgentUpdate replaces the agent binary for update_agent or a forced
+// update_notification. The outcome is replied and audited before the
+// service restart terminates this process. It reports whether the new
+// binary was installed.
+func runAgentUpdate(ctx context.Context, m wsMsg) bool {
+	newVersion, err := installAgentUpdate(ctx)
+	if err != nil {
+		logger.WithError(err).Warn("agent update failed")
+		finishCommand(m, nil, err, nil)
+		return false
+	}
+
+	m.reply.result(map[string]interface{}{"updated": true, "version": newVersion})
+	recordCommand(m, audit.OutcomeSucceeded, "", newVersion)
+	return true
+}
+
 type wsMsg struct {
 	kind     string
 	interval int
 	version  string
 	force    bool
+	mode     string                 // apply_updates mode: all, security or packages
+	packages []string               // apply_updates package list
+	schedule *models.ReportSchedule // settings_update report schedule, nil if unchanged
+	exclude  []string               // Package patterns the local policy keeps untouched
+	reply    wsReply                // Sends ack, progress and result frames to the server
 }
 
-func wsLoop(out chan<- wsMsg) {
+// params returns the command parameters recorded in the audit log
+func (m wsMsg) params() map[string]interface{} {
+	switch m.kind {
+	case "settings_update":
+		params := map[string]interface{}{"update_interval": m.interval}
+		if m.schedule != nil {
+			params["schedule"] = m.schedule
+		}
+		return params
+	case "update_notification":
+		return map[string]interface{}{"version": m.version, "force": m.force}
+	case "apply_updates":
+		params := map[string]interface{}{"mode": m.mode}
+		if len(m.packages) > 0 {
+			params["packages"] = m.packages
+		}
+		if len(m.exclude) > 0 {
+			params["exclude"] = m.exclude
+		}
+		return params
+	}
+	return nil
+}
+
+// wsWriter serializes writes to the current WebSocket connection, which
+// gorilla/websocket does not allow concurrently
+type wsWriter struct {
+	mu   sync.Mutex
+	conn *websocket.Conn
+}
+
+// wsOut is the writer for messages sent back to the server
+var wsOut = &wsWriter{}
+
+func (w *wsWriter) setConn(conn *websocket.Conn) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.conn = conn
+}
+
+// send writes v as a JSON message, failing while disconnected
+func (w *wsWriter) send(v interface{}) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn == nil {
+		return errors.New("websocket not connected")
+	}
+	_ = w.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return w.conn.WriteJSON(v)
+}
+
+// sendEnvelope writes a protocol frame, logging failures
+func (w *wsWriter) sendEnvelope(env wsproto.Envelope) {
+	if err := w.send(env); err != nil {
+		logger.WithError(err).WithFields(map[string]interface{}{
+			"type":     env.Type,
+			"reply_to": env.ReplyTo,
+		}).Debug("Failed to send WebSocket frame")
+	}
+}
+
+// wsReply sends the reply frames for one command. Bare legacy commands
+// without an ID cannot be correlated and get no replies.
+type wsReply struct {
+	id string
+}
+
+func (r wsReply) send(frameType string, payload interface{}) {
+	if r.id == "" {
+		return
+	}
+	env, err := wsproto.NewReply(frameType, r.id, payload)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to build WebSocket reply")
+		return
+	}
+	wsOut.sendEnvelope(env)
+}
+
+// ack confirms that the command was accepted
+func (r wsReply) ack() {
+	r.send(wsproto.TypeAck, nil)
+}
+
+// progress reports an intermediate state of a running command
+func (r wsReply) progress(payload interface{}) {
+	r.send(wsproto.TypeProgress, payload)
+}
+
+// result reports that the command completed successfully
+func (r wsReply) result(payload interface{}) {
+	r.send(wsproto.TypeResult, payload)
+}
+
+// fail reports that the command failed or was rejected
+func (r wsReply) fail(err error, details interface{}) {
+	if r.id == "" {
+		return
+	}
+	wsOut.sendEnvelope(wsproto.NewErrorReply(r.id, err, details))
+}
+
+// wsProgress is the payload of the progress frame sent when a command starts
+type wsProgress struct {
+	Stage string `json:"stage"`
+}
+
+// wsSession is a running wsLoop
+type wsSession struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// startWSLoop runs wsLoop until ctx is cancelled or the session is stopped
+func startWSLoop(ctx context.Context, out chan<- wsMsg) *wsSession {
+	ctx, cancel := context.WithCancel(ctx)
+	session := &wsSession{cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(session.done)
+		wsLoop(ctx, out)
+	}()
+	return session
+}
+
+// stop closes the connection and waits for the loop to exit
+func (s *wsSession) stop() {
+	s.cancel()
+	<-s.done
+}
+
+func wsLoop(ctx context.Context, out chan<- wsMsg) {
 	backoff := time.Second
 	for {
-		if err := connectOnce(out); err != nil {
+		err := connectOnce(ctx, out)
+		serviceStatus.wsDisconnected(err)
+		if err != nil && ctx.Err() == nil {
 			logger.WithError(err).Warn("ws disconnected; retrying")
 		}
-		time.Sleep(backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
 		if backoff < 30*time.Second {
 			backoff *= 2
 		}
 	}
 }
 
-func connectOnce(out chan<- wsMsg) error {
+func connectOnce(ctx context.Context, out chan<- wsMsg) error {
 	server := cfgManager.GetConfig().PatchmonServer
 	if server == "" {
 		return nil
@@ -135,63 +531,149 @@ func connectOnce(out chan<- wsMsg) error {
 	header.Set("X-API-ID", apiID)
 	header.Set("X-API-KEY", apiKey)
 
-	conn, _, err := websocket.DefaultDialer.Dial(wsURL, header)
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, wsURL, header)
 	if err != nil {
 		return err
 	}
 	defer func() { _ = conn.Close() }()
 
+	connDone := make(chan struct{})
+	defer close(connDone)
+
+	// Close the connection on shutdown or reload, which unblocks ReadMessage
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, "agent disconnecting"),
+				time.Now().Add(time.Second))
+			_ = conn.Close()
+		case <-connDone:
+		}
+	}()
+
+	wsOut.setConn(conn)
+	defer wsOut.setConn(nil)
+
 	// ping loop
 	go func() {
 		t := time.NewTicker(30 * time.Second)
 		defer t.Stop()
-		for range t.C {
-			_ = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(5*time.Second))
+		for {
+			select {
+			case <-t.C:
+				_ = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(5*time.Second))
+			case <-connDone:
+				return
+			}
 		}
 	}()
 
 	// Set read deadlines and extend them on pong frames to avoid idle timeouts
 	_ = conn.SetReadDeadline(time.Now().Add(90 * time.Second))
 	conn.SetPongHandler(func(string) error {
+		serviceStatus.wsAlive()
 		return conn.SetReadDeadline(time.Now().Add(90 * time.Second))
 	})
 
 	logger.WithField("url", wsURL).Info("WebSocket connected")
+	serviceStatus.wsConnected(wsURL)
 	for {
 		_, data, err := conn.ReadMessage()
 		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
 			return err
 		}
+		serviceStatus.wsAlive()
+
+		env, err := wsproto.Decode(data)
+		if err != nil {
+			logger.WithError(err).Warn("Rejected malformed WebSocket message")
+			wsOut.sendEnvelope(wsproto.NewErrorReply(env.ID, err, nil))
+			continue
+		}
+
+		reply := wsReply{id: env.ID}
+		m, err := parseCommand(env)
+		if err != nil {
+			logger.WithError(err).WithField("type", env.Type).Warn("Rejected WebSocket command")
+			reply.fail(err, nil)
+			recordCommand(wsMsg{kind: env.Type, reply: reply}, audit.OutcomeRefused, err.Error(), "")
+			continue
+		}
+		m.reply = reply
+		reply.ack()
+		select {
+		case out <- m:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// parseCommand validates a command and its payload. Versioned envelopes carry
+// the fields in the payload, bare legacy messages at the top level.
+func parseCommand(env wsproto.Envelope) (wsMsg, error) {
+	switch env.Type {
+	case "settings_update":
 		var payload struct {
-			Type           string `json:"type"`
-			UpdateInterval int    `json:"update_interval"`
-			Version        string `json:"version"`
-			Force          bool   `json:"force"`
-			Message        string `json:"message"`
-		}
-		if json.Unmarshal(data, &payload) == nil {
-			switch payload.Type {
-			case "settings_update":
-				logger.WithField("interval", payload.UpdateInterval).Info("settings_update received")
-				out <- wsMsg{kind: "settings_update", interval: payload.UpdateInterval}
-			case "report_now":
-				logger.Info("report_now received")
-				out <- wsMsg{kind: "report_now"}
-			case "update_agent":
-				logger.Info("update_agent received")
-				out <- wsMsg{kind: "update_agent"}
-			case "update_notification":
-				logger.WithFields(map[string]interface{}{
-					"version": payload.Version,
-					"force":   payload.Force,
-					"message": payload.Message,
-				}).Info("update_notification received")
-				out <- wsMsg{
-					kind:    "update_notification",
-					version: payload.Version,
-					force:   payload.Force,
-				}
+			UpdateInterval int                    `json:"update_interval"`
+			Schedule       *models.ReportSchedule `json:"schedule"`
+		}
+		if err := env.DecodePayload(&payload); err != nil {
+			return wsMsg{}, err
+		}
+		// Legacy servers may send a zero interval, which is ignored. A
+		// schedule may be pushed without changing the interval.
+		if !env.Legacy() && (payload.UpdateInterval < 0 || (payload.UpdateInterval == 0 && payload.Schedule == nil)) {
+			return wsMsg{}, wsproto.Errorf(wsproto.ErrCodeInvalidPayload, "update_interval must be positive")
+		}
+		if payload.Schedule != nil {
+			if err := reporting.ValidateSpec(*payload.Schedule); err != nil {
+				return wsMsg{}, wsproto.Errorf(wsproto.ErrCodeInvalidPayload, "schedule: %v", err)
 			}
 		}
+		logger.WithField("interval", payload.UpdateInterval).Info("settings_update received")
+		return wsMsg{kind: env.Type, interval: payload.UpdateInterval, schedule: payload.Schedule}, nil
+	case "report_now", "update_agent":
+		logger.Info(env.Type + " received")
+		return wsMsg{kind: env.Type}, nil
+	case "update_notification":
+		var payload struct {
+			Version string `json:"version"`
+			Force   bool   `json:"force"`
+			Message string `json:"message"`
+		}
+		if err := env.DecodePayload(&payload); err != nil {
+			return wsMsg{}, err
+		}
+		logger.WithFields(map[string]interface{}{
+			"version": payload.Version,
+			"force":   payload.Force,
+			"message": payload.Message,
+		}).Info("update_notification received")
+		return wsMsg{kind: env.Type, version: payload.Version, force: payload.Force}, nil
+	case "apply_updates":
+		var payload struct {
+			Mode     string   `json:"mode"`
+			Packages []string `json:"packages"`
+		}
+		if err := env.DecodePayload(&payload); err != nil {
+			return wsMsg{}, err
+		}
+		req := patching.Request{Mode: patching.Mode(payload.Mode), Packages: payload.Packages}
+		if err := patching.ValidateRequest(req); err != nil {
+			return wsMsg{}, wsproto.Errorf(wsproto.ErrCodeInvalidPayload, "%v", err)
+		}
+		logger.WithFields(map[string]interface{}{
+			"id":       env.ID,
+			"mode":     payload.Mode,
+			"packages": payload.Packages,
+		}).Info("apply_updates received")
+		return wsMsg{kind: env.Type, mode: payload.Mode, packages: payload.Packages}, nil
+	default:
+		return wsMsg{}, wsproto.Errorf(wsproto.ErrCodeUnknownCommand, "unknown command %q", env.Type)
 	}
 }
@@ -0,0 +1,238 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"patchmon-agent/internal/config"
+	"patchmon-agent/internal/control"
+	"patchmon-agent/internal/reporting"
+	"patchmon-agent/internal/version"
+
+	"github.com/spf13/cobra"
+)
+
+// statusCmd represents the status command
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the state of the running agent service",
+	Long: `Show the state of the agent service started with 'patchmon-agent serve':
+its report schedule, the last and next report, and the WebSocket connection.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkRoot(); err != nil {
+			return err
+		}
+
+		asJSON, _ := cmd.Flags().GetBool("json")
+		return showStatus(cmd.Context(), asJSON)
+	},
+}
+
+func init() {
+	statusCmd.Flags().Bool("json", false, "Print the status as JSON")
+}
+
+func showStatus(ctx context.Context, asJSON bool) error {
+	status, err := control.NewClient(config.DefaultControlSocket).Status(ctx)
+	if errors.Is(err, control.ErrNotRunning) {
+		fmt.Println("Agent service: not running")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		out, err := json.MarshalIndent(status, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+
+	fmt.Printf("Agent service: running (pid %d, version %s, up %s)\n",
+		status.PID, status.Version, time.Since(status.Started).Round(time.Second))
+	fmt.Printf("  Schedule: %s\n", status.Schedule)
+	if status.NextReport != nil {
+		fmt.Printf("  Next report: %s (in %s)\n", status.NextReport.Format(time.RFC3339),
+			time.Until(*status.NextReport).Round(time.Second))
+	}
+	if status.Reports.Running {
+		fmt.Printf("  Report running: %s\n", strings.Join(status.Reports.CurrentReasons, ", "))
+	}
+	if last := status.Reports.Last; last != nil {
+		outcome := "succeeded"
+		if last.Error != "" {
+			outcome = "failed: " + last.Error
+		}
+		fmt.Printf("  Last report: %s, %s (%s)\n", last.Finished.Format(time.RFC3339), outcome,
+			strings.Join(last.Reasons, ", "))
+	} else {
+		fmt.Printf("  Last report: none yet\n")
+	}
+
+	ws := status.WebSocket
+	state := "disconnected"
+	if ws.Connected {
+		state = "connected to " + ws.URL
+	}
+	if ws.Since != nil {
+		state += " since " + ws.Since.Format(time.RFC3339)
+	}
+	fmt.Printf("  WebSocket: %s\n", state)
+	if !ws.Connected && ws.LastError != "" {
+		fmt.Printf("  WebSocket error: %s\n", ws.LastError)
+	}
+
+	return nil
+}
+
+// reportViaDaemon has the running service send a report and waits for it.
+// It returns control.ErrNotRunning when there is no service.
+func reportViaDaemon(ctx context.Context) error {
+	result, err := control.NewClient(config.DefaultControlSocket).Report(ctx)
+	if err != nil {
+		return err
+	}
+
+	reasons := ""
+	if result.Run != nil {
+		reasons = " (" + strings.Join(result.Run.Reasons, ", ") + ")"
+	}
+	fmt.Printf("✅ Report sent by the agent service%s\n", reasons)
+	return nil
+}
+
+// serviceState is the serve daemon state exposed on the control socket
+type serviceState struct {
+	started time.Time
+
+	mu              sync.Mutex
+	intervalMinutes int
+	schedule        string
+	nextReport      time.Time
+	ws              control.WebSocketStatus
+	wsSeen          time.Time // Last sign of life from the WebSocket loop
+}
+
+// Limits beyond which the service counts as stuck, so the systemd watchdog
+// is no longer pinged and systemd restarts it
+const (
+	wsStallTimeout          = 5 * time.Minute
+	reportStallTimeout      = 30 * time.Minute
+	applyStallTimeout       = applyUpdatesTimeout + 10*time.Minute
+	agentUpdateStallTimeout = agentUpdateTimeout + 10*time.Minute
+)
+
+// serviceStatus is updated by the serve loop and the WebSocket loop
+var serviceStatus = &serviceState{}
+
+// setSchedule records the report schedule in force
+func (s *serviceState) setSchedule(schedule *reporting.Schedule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.intervalMinutes = int(schedule.Interval() / time.Minute)
+	s.schedule = schedule.Describe()
+}
+
+// setNextReport records when the next scheduled report runs
+func (s *serviceState) setNextReport(next time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextReport = next
+}
+
+// wsConnected records a successful WebSocket connection
+func (s *serviceState) wsConnected(url string) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ws = control.WebSocketStatus{Connected: true, URL: url, Since: &now}
+	s.wsSeen = now
+}
+
+// wsAlive records traffic on the WebSocket connection
+func (s *serviceState) wsAlive() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.wsSeen = time.Now()
+}
+
+// wsDisconnected records a lost or failed WebSocket connection
+func (s *serviceState) wsDisconnected(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ws.Connected || s.ws.Since == nil {
+		now := time.Now()
+		s.ws.Since = &now
+	}
+	s.ws.Connected = false
+	if err != nil {
+		s.ws.LastError = err.Error()
+	}
+	s.wsSeen = time.Now()
+}
+
+// health returns an error when part of the service has stopped making
+// progress: the WebSocket loop, a report run or an apply_updates run
+func (s *serviceState) health(now time.Time) error {
+	s.mu.Lock()
+	wsSeen := s.wsSeen
+	s.mu.Unlock()
+	if !wsSeen.IsZero() && now.Sub(wsSeen) > wsStallTimeout {
+		return fmt.Errorf("WebSocket loop inactive since %s", wsSeen.Format(time.RFC3339))
+	}
+
+	if reports != nil {
+		if started := reports.Status().CurrentStarted; started != nil && now.Sub(*started) > reportStallTimeout {
+			return fmt.Errorf("report run stuck since %s", started.Format(time.RFC3339))
+		}
+	}
+
+	if updateRunner != nil {
+		if started, running := updateRunner.Running(); running && now.Sub(started) > applyStallTimeout {
+			return fmt.Errorf("apply_updates run stuck since %s", started.Format(time.RFC3339))
+		}
+	}
+
+	if started, running := agentUpdates.Running(); running && now.Sub(started) > agentUpdateStallTimeout {
+		return fmt.Errorf("agent update stuck since %s", started.Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+// Status implements control.Handler
+func (s *serviceState) Status() control.Status {
+	s.mu.Lock()
+	status := control.Status{
+		Version:         version.Version,
+		PID:             os.Getpid(),
+		Started:         s.started,
+		IntervalMinutes: s.intervalMinutes,
+		Schedule:        s.schedule,
+		WebSocket:       s.ws,
+	}
+	if !s.nextReport.IsZero() {
+		next := s.nextReport
+		status.NextReport = &next
+	}
+	s.mu.Unlock()
+
+	if reports != nil {
+		status.Reports = reports.Status()
+	}
+	return status
+}
+
+// Report implements control.Handler
+func (s *serviceState) Report(ctx context.Context) error {
+	return requestReport(ctx, reporting.ReasonLocalRequest)
+}
@@ -9,6 +9,8 @@ import (
 	"path/filepath"
 	"strings"
 
+	"patchmon-agent/internal/backups"
+	"patchmon-agent/internal/config"
 	"patchmon-agent/internal/crontab"
 
 	"github.com/spf13/cobra"
@@ -111,8 +113,12 @@ func performUninstall(removeConfig, removeLogs, force bool) error {
 
 	// Check for backup files
 	backupFiles := findBackupFiles(resolvedPath)
-	if len(backupFiles) > 0 {
-		fmt.Printf("  - Backup files (%d found)\n", len(backupFiles))
+	storedBackups, err := backups.List(config.DefaultBackupDir)
+	if err != nil {
+		logger.WithError(err).Warn("Could not list agent backups")
+	}
+	if count := len(backupFiles) + len(storedBackups); count > 0 {
+		fmt.Printf("  - Backup files (%d found)\n", count)
 	}
 
 	if removeConfig {
@@ -158,7 +164,7 @@ func performUninstall(removeConfig, removeLogs, force bool) error {
 	}
 
 	// Remove backup files
-	if len(backupFiles) > 0 {
+	if len(backupFiles) > 0 || len(storedBackups) > 0 {
 		logger.Info("Removing backup files...")
 		for _, backup := range backupFiles {
 			if err := os.Remove(backup); err != nil {
@@ -167,6 +173,13 @@ func performUninstall(removeConfig, removeLogs, force bool) error {
 				logger.WithField("path", backup).Info("Removed backup file")
 			}
 		}
+		for _, backup := range storedBackups {
+			if err := backup.Remove(); err != nil {
+				logger.WithError(err).WithField("path", backup.Path).Warn("Failed to remove backup file")
+			} else {
+				logger.WithField("path", backup.Path).Info("Removed backup file")
+			}
+		}
 	}
 
 	// Remove additional binaries
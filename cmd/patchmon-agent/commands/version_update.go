@@ -2,25 +2,39 @@ package commands
 
 import (
 	"context"
-	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	neturl "net/url"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
+	"patchmon-agent/internal/autoupdate"
+	"patchmon-agent/internal/backups"
+	"patchmon-agent/internal/client"
 	"patchmon-agent/internal/config"
+	"patchmon-agent/internal/probation"
+	"patchmon-agent/internal/reporting"
+	"patchmon-agent/internal/signing"
 	"patchmon-agent/internal/version"
+	"patchmon-agent/internal/wsproto"
 
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
 const (
 	serverTimeout = 30 * time.Second
+	// maxBinarySize caps the agent binary download
+	maxBinarySize = 256 * 1024 * 1024
 )
 
 type ServerVersionResponse struct {
@@ -29,7 +43,7 @@ type ServerVersionResponse struct {
 	Size         int64  `json:"size"`
 	Hash         string `json:"hash"`
 	DownloadURL  string `json:"downloadUrl"`
-	BinaryData   []byte `json:"-"` // Binary data (not serialized to JSON)
+	Path         string `json:"-"` // Downloaded binary on disk (not serialized to JSON)
 }
 
 type ServerVersionInfo struct {
@@ -50,7 +64,7 @@ var checkVersionCmd = &cobra.Command{
 			return err
 		}
 
-		return checkVersion()
+		return checkVersion(cmd.Context())
 	},
 }
 
@@ -64,14 +78,14 @@ var updateAgentCmd = &cobra.Command{
 			return err
 		}
 
-		return updateAgent()
+		return updateAgent(cmd.Context())
 	},
 }
 
-func checkVersion() error {
+func checkVersion(ctx context.Context) error {
 	logger.Info("Checking for agent updates...")
 
-	versionInfo, err := getServerVersionInfo()
+	versionInfo, err := getServerVersionInfo(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to check for updates: %w", err)
 	}
@@ -92,51 +106,242 @@ func checkVersion() error {
 	return nil
 }
 
-func updateAgent() error {
+func updateAgent(ctx context.Context) error {
+	if _, err := installAgentUpdate(ctx); err != nil {
+		return err
+	}
+
+	finishAgentUpdate(ctx)
+	return nil
+}
+
+// autoUpdateAgent installs an agent update after a report when a newer
+// version is available and both the local update policy and the server's
+// auto-update settings for the host allow it. It reports whether the new
+// binary was installed; the caller then runs finishAgentUpdate.
+func autoUpdateAgent(ctx context.Context, httpClient *client.Client, machineID string) bool {
+	updatePolicy, err := autoupdate.New(cfgManager.GetConfig().AutoUpdate, machineID)
+	if err != nil {
+		logger.WithError(err).Warn("Invalid auto_update configuration, not updating the agent")
+		return false
+	}
+
+	logger.Info("Checking for agent updates...")
+	versionInfo, err := getServerVersionInfo(ctx)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to check for updates after report")
+		return false
+	}
+	if !versionInfo.HasUpdate {
+		logger.WithField("version", versionInfo.CurrentVersion).Debug("Agent is up to date")
+		return false
+	}
+
+	settings, err := httpClient.GetHostSettings(ctx)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to get auto-update settings, not updating the agent")
+		return false
+	}
+
+	now := time.Now()
+	release := autoupdate.Release{
+		Version:    versionInfo.LatestVersion,
+		ReleasedAt: releaseTime(ctx, httpClient, versionInfo.LatestVersion, now),
+	}
+	fields := logrus.Fields{
+		"current": versionInfo.CurrentVersion,
+		"latest":  versionInfo.LatestVersion,
+		"channel": updatePolicy.Channel(),
+	}
+	if decision := updatePolicy.Evaluate(settings, release, now); !decision.Update {
+		logger.WithFields(fields).WithField("reason", decision.Reason).Info("Agent update available but held back")
+		return false
+	}
+
+	logger.WithFields(fields).Info("Update available, automatically updating...")
+	_, err = installAgentUpdate(ctx)
+	switch {
+	case errors.Is(err, errAgentUpdateBusy):
+		logger.Info("Another agent update is in progress, not updating the agent")
+	case err != nil:
+		logger.WithError(err).Warn("PatchMon agent update failed, but data was sent successfully")
+	default:
+		logger.Info("PatchMon agent update completed successfully")
+	}
+	return err == nil
+}
+
+// releaseTime returns when version was published according to the server,
+// or else when this host was first offered it
+func releaseTime(ctx context.Context, httpClient *client.Client, version string, now time.Time) time.Time {
+	version = strings.TrimPrefix(version, "v")
+	timestamp, err := httpClient.GetAgentTimestamp(ctx)
+	if err == nil && timestamp.Exists && timestamp.Timestamp > 0 && strings.TrimPrefix(timestamp.Version, "v") == version {
+		return time.Unix(timestamp.Timestamp, 0)
+	}
+
+	seen, err := autoupdate.FirstSeen(config.DefaultUpdateSeenFile, version, now)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to record when the agent release was first seen")
+	}
+	return seen
+}
+
+// updateChannel returns the update channel to ask the server for, empty
+// for the server's default
+func updateChannel() string {
+	return cfgManager.GetConfig().AutoUpdate.Channel
+}
+
+// errAgentUpdateBusy is returned when another agent update is running, in
+// this process or another
+var errAgentUpdateBusy = wsproto.Errorf(wsproto.ErrCodeBusy, "an agent update is already in progress")
+
+// agentUpdater records when the agent update of this process started, for
+// the health check
+type agentUpdater struct {
+	mu      sync.Mutex
+	started time.Time // Zero when idle
+}
+
+// agentUpdates tracks the agent update run by this process
+var agentUpdates = &agentUpdater{}
+
+// begin claims the updater, reporting false if an update is already running
+func (u *agentUpdater) begin(now time.Time) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if !u.started.IsZero() {
+		return false
+	}
+	u.started = now
+	return true
+}
+
+func (u *agentUpdater) end() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.started = time.Time{}
+}
+
+// Running returns when the update in progress started, or false when idle
+func (u *agentUpdater) Running() (time.Time, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.started, !u.started.IsZero()
+}
+
+// lockAgentUpdate claims the agent update for this process and takes the
+// update lock file, which update-agent runs in other processes share, so
+// that one download at a time writes to the executable's .new file. The
+// returned function releases both.
+func lockAgentUpdate() (func(), error) {
+	if !agentUpdates.begin(time.Now()) {
+		return nil, errAgentUpdateBusy
+	}
+
+	lockPath := config.DefaultUpdateLockFile
+	if err := os.MkdirAll(filepath.Dir(lockPath), 0700); err != nil {
+		agentUpdates.end()
+		return nil, fmt.Errorf("failed to create update lock directory: %w", err)
+	}
+	f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		agentUpdates.end()
+		return nil, fmt.Errorf("failed to open update lock: %w", err)
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		_ = f.Close()
+		agentUpdates.end()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, errAgentUpdateBusy
+		}
+		return nil, fmt.Errorf("failed to take update lock: %w", err)
+	}
+
+	return func() {
+		// Closing the file releases the lock
+		_ = f.Close()
+		agentUpdates.end()
+	}, nil
+}
+
+// installAgentUpdate downloads the latest agent, verifies it and replaces
+// the current executable, returning the installed version. The running
+// process keeps the old binary until finishAgentUpdate restarts it.
+func installAgentUpdate(ctx context.Context) (string, error) {
+	unlock, err := lockAgentUpdate()
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
 	logger.Info("Updating agent...")
 
 	// Get current executable path
 	executablePath, err := os.Executable()
 	if err != nil {
-		return fmt.Errorf("failed to get executable path: %w", err)
+		return "", fmt.Errorf("failed to get executable path: %w", err)
 	}
 
-	// Get latest binary info from server
-	binaryInfo, err := getLatestBinaryFromServer()
+	// Download next to the executable, so the rename below stays on one
+	// filesystem. An interrupted download is resumed on the next attempt.
+	tempPath := executablePath + ".new"
+	binaryInfo, err := getLatestBinaryFromServer(ctx, tempPath)
 	if err != nil {
-		return fmt.Errorf("failed to get latest binary information: %w", err)
+		return "", fmt.Errorf("failed to get latest binary information: %w", err)
+	}
+	discard := func() {
+		if removeErr := os.Remove(tempPath); removeErr != nil {
+			logger.WithError(removeErr).Warn("Failed to remove downloaded agent binary")
+		}
 	}
 
-	logger.WithField("version", binaryInfo.Version).Info("Found latest version")
+	// The download does not say which version it is; ask the server
+	newVersion := binaryInfo.Version
+	if versionInfo, err := getServerVersionInfo(ctx); err == nil && versionInfo.LatestVersion != "" {
+		newVersion = strings.TrimPrefix(versionInfo.LatestVersion, "v")
+	}
+	logger.WithField("version", newVersion).Info("Found latest version")
 
 	logger.Info("Using downloaded agent binary...")
 
-	// Use the binary data directly from the server response
-	newAgentData := binaryInfo.BinaryData
-	if len(newAgentData) == 0 {
-		return fmt.Errorf("no binary data received from server")
+	if binaryInfo.Size == 0 {
+		discard()
+		return "", fmt.Errorf("no binary data received from server")
 	}
 
-	// Create backup of current executable
-	backupPath := fmt.Sprintf("%s.backup.%s", executablePath, time.Now().Format("20060102_150405"))
-	if err := copyFile(executablePath, backupPath); err != nil {
-		return fmt.Errorf("failed to create backup: %w", err)
+	// Don't reinstall a build that was already rolled back
+	if state, err := probation.Load(config.DefaultUpdateStateFile); err == nil && state != nil &&
+		state.Status == probation.StatusRolledBack && state.NewSHA256 == binaryInfo.Hash {
+		discard()
+		return "", fmt.Errorf("version %s was rolled back after failing its health check: %s", state.NewVersion, state.Reason)
 	}
-	logger.WithField("path", backupPath).Info("Backup saved")
 
-	// Write new version to temporary file
-	tempPath := executablePath + ".new"
-	if err := os.WriteFile(tempPath, newAgentData, 0755); err != nil {
-		return fmt.Errorf("failed to write new agent: %w", err)
+	// The new binary runs as root, so nothing is executed or installed
+	// unless a trusted key signed it
+	if err := verifyAgentBinary(ctx, tempPath); err != nil {
+		discard()
+		return "", err
+	}
+	if err := os.Chmod(tempPath, 0755); err != nil {
+		discard()
+		return "", fmt.Errorf("failed to make new agent executable: %w", err)
+	}
+
+	// Create backup of current executable
+	previousVersion := strings.TrimPrefix(version.Version, "v")
+	backup, err := backupAgent(executablePath, previousVersion)
+	if err != nil {
+		discard()
+		return "", fmt.Errorf("failed to create backup: %w", err)
 	}
 
 	// Verify the new executable works
 	testCmd := exec.Command(tempPath, "check-version")
 	if err := testCmd.Run(); err != nil {
-		if removeErr := os.Remove(tempPath); removeErr != nil {
-			logger.WithError(removeErr).Warn("Failed to remove temporary file after validation failure")
-		}
-		return fmt.Errorf("new agent executable is invalid: %w", err)
+		discard()
+		return "", fmt.Errorf("new agent executable is invalid: %w", err)
 	}
 
 	// Replace current executable
@@ -144,49 +349,105 @@ func updateAgent() error {
 		if removeErr := os.Remove(tempPath); removeErr != nil {
 			logger.WithError(removeErr).Warn("Failed to remove temporary file after rename failure")
 		}
-		return fmt.Errorf("failed to replace executable: %w", err)
+		return "", fmt.Errorf("failed to replace executable: %w", err)
 	}
 
-	logger.WithField("version", binaryInfo.Version).Info("Agent updated successfully")
+	logger.WithField("version", newVersion).Info("Agent updated successfully")
+
+	if err := startProbation(previousVersion, newVersion, executablePath, backup.Path); err != nil {
+		logger.WithError(err).Warn("Failed to start update probation, the update cannot be rolled back automatically")
+	}
+
+	return newVersion, nil
+}
+
+// finishAgentUpdate restarts the service onto the new binary and reports
+// the new version to PatchMon
+func finishAgentUpdate(ctx context.Context) {
+	// Watch the new version from the previous binary; the restart below may
+	// end this process
+	if state, err := probation.Load(config.DefaultUpdateStateFile); err == nil && state != nil && state.Status == probation.StatusPending {
+		if err := startRollbackWatchdog(state); err != nil {
+			logger.WithError(err).Warn("Failed to start rollback watchdog, the update cannot be rolled back automatically")
+		}
+	}
 
 	// Restart the systemd service to pick up the new binary
 	logger.Info("Restarting patchmon-agent service...")
 	if err := restartService(); err != nil {
 		logger.WithError(err).Warn("Failed to restart service (this is not critical)")
+		// Without the service nothing can confirm the update in time
+		cancelProbation()
 	} else {
 		logger.Info("Service restarted successfully")
 	}
 
 	// Send updated information to PatchMon
 	logger.Info("Sending updated information to PatchMon...")
-	if err := sendReport(); err != nil {
+	if err := requestReport(ctx, reporting.ReasonAgentUpdated); err != nil {
 		logger.WithError(err).Warn("Failed to send updated information to PatchMon (this is not critical)")
 	} else {
 		logger.Info("Successfully sent updated information to PatchMon")
 	}
+}
+
+// verifyAgentBinary checks the downloaded binary against its detached
+// signature from the server
+func verifyAgentBinary(ctx context.Context, path string) error {
+	keyring, err := updateKeyring()
+	if err != nil {
+		return fmt.Errorf("invalid update signing keys: %w", err)
+	}
+	if keyring.Len() == 0 {
+		return fmt.Errorf("refusing to install agent update: %w", signing.ErrNoKeys)
+	}
+
+	signature, err := getBinarySignature(ctx)
+	if err != nil {
+		return fmt.Errorf("refusing to install unsigned agent update: %w", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
 
+	sig, err := keyring.Verify(f, signature)
+	if err != nil {
+		return fmt.Errorf("refusing to install agent update: %w", err)
+	}
+
+	logger.WithFields(logrus.Fields{
+		"key_id":          sig.KeyID.String(),
+		"trusted_comment": sig.TrustedComment,
+	}).Info("Agent binary signature verified")
 	return nil
 }
 
-// getServerVersionInfo fetches version information from the PatchMon server
-func getServerVersionInfo() (*ServerVersionInfo, error) {
-	cfgManager := config.New()
-	if err := cfgManager.LoadConfig(); err != nil {
-		return nil, fmt.Errorf("failed to load config: %w", err)
-	}
+// updateKeyring returns the keys trusted to sign agent binaries: those built
+// into the agent and those pinned in the config file, minus revoked ones
+func updateKeyring() (*signing.Keyring, error) {
 	cfg := cfgManager.GetConfig()
+	trusted := append(signing.SplitKeys(signing.EmbeddedKeys), cfg.UpdatePublicKeys...)
+	return signing.NewKeyring(trusted, cfg.UpdateRevokedKeys)
+}
 
-	// Load credentials for API authentication
+// getBinarySignature fetches the minisign signature of the latest binary
+// from the PatchMon server
+func getBinarySignature(ctx context.Context) ([]byte, error) {
+	cfg := cfgManager.GetConfig()
 	if err := cfgManager.LoadCredentials(); err != nil {
 		return nil, fmt.Errorf("failed to load credentials: %w", err)
 	}
 	credentials := cfgManager.GetCredentials()
 
-	architecture := getArchitecture()
-	currentVersion := strings.TrimPrefix(version.Version, "v")
-	url := fmt.Sprintf("%s/api/v1/hosts/agent/version?arch=%s&type=go&currentVersion=%s", cfg.PatchmonServer, architecture, currentVersion)
+	url := fmt.Sprintf("%s/api/v1/hosts/agent/signature?arch=%s", cfg.PatchmonServer, getArchitecture())
+	if channel := updateChannel(); channel != "" {
+		url += "&channel=" + neturl.QueryEscape(channel)
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), serverTimeout)
+	ctx, cancel := context.WithTimeout(ctx, serverTimeout)
 	defer cancel()
 
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
@@ -208,20 +469,23 @@ func getServerVersionInfo() (*ServerVersionInfo, error) {
 		}
 	}()
 
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("server has no signature for the agent binary")
+	}
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("server returned status %d", resp.StatusCode)
+		return nil, fmt.Errorf("signature request returned status %d", resp.StatusCode)
 	}
 
-	var versionInfo ServerVersionInfo
-	if err := json.NewDecoder(resp.Body).Decode(&versionInfo); err != nil {
-		return nil, fmt.Errorf("failed to decode version info: %w", err)
+	// Signature files are a few hundred bytes
+	signature, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signature: %w", err)
 	}
-
-	return &versionInfo, nil
+	return signature, nil
 }
 
-// getLatestBinaryFromServer fetches the latest binary information from the PatchMon server
-func getLatestBinaryFromServer() (*ServerVersionResponse, error) {
+// getServerVersionInfo fetches version information from the PatchMon server
+func getServerVersionInfo(ctx context.Context) (*ServerVersionInfo, error) {
 	cfgManager := config.New()
 	if err := cfgManager.LoadConfig(); err != nil {
 		return nil, fmt.Errorf("failed to load config: %w", err)
@@ -235,9 +499,13 @@ func getLatestBinaryFromServer() (*ServerVersionResponse, error) {
 	credentials := cfgManager.GetCredentials()
 
 	architecture := getArchitecture()
-	url := fmt.Sprintf("%s/api/v1/hosts/agent/download?arch=%s", cfg.PatchmonServer, architecture)
+	currentVersion := strings.TrimPrefix(version.Version, "v")
+	url := fmt.Sprintf("%s/api/v1/hosts/agent/version?arch=%s&type=go&currentVersion=%s", cfg.PatchmonServer, architecture, currentVersion)
+	if channel := updateChannel(); channel != "" {
+		url += "&channel=" + neturl.QueryEscape(channel)
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), serverTimeout)
+	ctx, cancel := context.WithTimeout(ctx, serverTimeout)
 	defer cancel()
 
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
@@ -263,22 +531,40 @@ func getLatestBinaryFromServer() (*ServerVersionResponse, error) {
 		return nil, fmt.Errorf("server returned status %d", resp.StatusCode)
 	}
 
-	// Read the binary data
-	binaryData, err := io.ReadAll(resp.Body)
+	var versionInfo ServerVersionInfo
+	if err := json.NewDecoder(resp.Body).Decode(&versionInfo); err != nil {
+		return nil, fmt.Errorf("failed to decode version info: %w", err)
+	}
+
+	return &versionInfo, nil
+}
+
+// getLatestBinaryFromServer downloads the latest binary from the PatchMon
+// server to path
+func getLatestBinaryFromServer(ctx context.Context, path string) (*ServerVersionResponse, error) {
+	if err := cfgManager.LoadCredentials(); err != nil {
+		return nil, fmt.Errorf("failed to load credentials: %w", err)
+	}
+
+	architecture := getArchitecture()
+	httpClient := client.New(cfgManager, logger)
+	size, err := httpClient.DownloadAgentBinary(ctx, architecture, updateChannel(), path, maxBinarySize)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read binary data: %w", err)
+		return nil, err
 	}
 
 	// Calculate hash
-	hash := fmt.Sprintf("%x", sha256.Sum256(binaryData))
+	hash, err := probation.FileSHA256(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash binary: %w", err)
+	}
 
 	return &ServerVersionResponse{
 		Version:      version.Version, // We'll get the actual version from the server later
 		Architecture: architecture,
-		Size:         int64(len(binaryData)),
+		Size:         size,
 		Hash:         hash,
-		DownloadURL:  url,
-		BinaryData:   binaryData, // Store the binary data directly
+		Path:         path,
 	}, nil
 }
 
@@ -287,14 +573,40 @@ func getArchitecture() string {
 	return runtime.GOARCH
 }
 
-// copyFile copies a file from src to dst
-func copyFile(src, dst string) error {
-	data, err := os.ReadFile(src)
+// backupAgent keeps a copy of the executable in the backup directory and
+// prunes backups beyond the configured retention
+func backupAgent(executablePath, currentVersion string) (*backups.Backup, error) {
+	backup, err := backups.Save(config.DefaultBackupDir, executablePath, currentVersion, time.Now())
 	if err != nil {
-		return err
+		return nil, err
 	}
+	logger.WithFields(logrus.Fields{
+		"path":   backup.Path,
+		"sha256": backup.SHA256,
+	}).Info("Backup saved")
 
-	return os.WriteFile(dst, data, 0755)
+	pruneBackups(executablePath)
+	return backup, nil
+}
+
+// pruneBackups removes backups beyond the configured retention, and those
+// earlier versions left next to the executable
+func pruneBackups(executablePath string) {
+	removed, err := backups.Prune(config.DefaultBackupDir, cfgManager.GetConfig().BackupRetention)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to prune old backups")
+	}
+	for _, b := range removed {
+		logger.WithFields(logrus.Fields{"path": b.Path, "version": b.Version}).Info("Removed old backup")
+	}
+
+	for _, legacy := range findBackupFiles(executablePath) {
+		if err := os.Remove(legacy); err != nil {
+			logger.WithError(err).WithField("path", legacy).Warn("Failed to remove old backup")
+		} else {
+			logger.WithField("path", legacy).Info("Removed old backup")
+		}
+	}
 }
 
 // restartService restarts the patchmon-agent systemd service
@@ -0,0 +1,267 @@
+// Package audit keeps a tamper-evident log of server-initiated actions.
+//
+// The log is a file of JSON lines. Each entry carries the SHA-256 hash of the
+// previous entry and its own hash over its content, so editing, removing or
+// reordering entries breaks the chain and is detected by Read.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Outcomes recorded for a command
+const (
+	OutcomeAccepted  = "accepted"
+	OutcomeRefused   = "refused"
+	OutcomeSucceeded = "succeeded"
+	OutcomeFailed    = "failed"
+)
+
+// GenesisHash is the previous hash of the first entry
+var GenesisHash = strings.Repeat("0", sha256.Size*2)
+
+// Entry is one audit record
+type Entry struct {
+	Seq           int64          `json:"seq"`
+	Time          time.Time      `json:"time"`
+	Command       string         `json:"command"`
+	ID            string         `json:"id,omitempty"`
+	Params        map[string]any `json:"params,omitempty"`
+	Outcome       string         `json:"outcome"`
+	Reason        string         `json:"reason,omitempty"`
+	VersionBefore string         `json:"version_before,omitempty"`
+	VersionAfter  string         `json:"version_after,omitempty"`
+	PrevHash      string         `json:"prev_hash"`
+	Hash          string         `json:"hash"`
+}
+
+// computeHash hashes the entry's JSON encoding with the hash field empty
+func (e Entry) computeHash() (string, error) {
+	e.Hash = ""
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Log appends entries to an audit log file
+type Log struct {
+	path string
+
+	mu       sync.Mutex
+	loaded   bool
+	lastSeq  int64
+	lastHash string
+}
+
+// New creates an audit log writing to path
+func New(path string) *Log {
+	return &Log{path: path}
+}
+
+// Path returns the audit log file path
+func (l *Log) Path() string {
+	return l.path
+}
+
+// Append links the entry to the end of the chain and writes it. Seq, Time
+// (if unset), PrevHash and Hash are filled in.
+func (l *Log) Append(entry Entry) (Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.loaded {
+		seq, hash, err := readTail(l.path)
+		if err != nil {
+			return entry, err
+		}
+		l.lastSeq, l.lastHash, l.loaded = seq, hash, true
+	}
+
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	entry.Time = entry.Time.UTC()
+	entry.Seq = l.lastSeq + 1
+	entry.PrevHash = l.lastHash
+	params, err := normalizeParams(entry.Params)
+	if err != nil {
+		return entry, fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+	entry.Params = params
+	hash, err := entry.computeHash()
+	if err != nil {
+		return entry, fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+	entry.Hash = hash
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return entry, fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(l.path), 0700); err != nil {
+		return entry, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return entry, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return entry, fmt.Errorf("failed to write audit log: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return entry, fmt.Errorf("failed to sync audit log: %w", err)
+	}
+
+	l.lastSeq, l.lastHash = entry.Seq, entry.Hash
+	return entry, nil
+}
+
+// normalizeParams round-trips params through JSON, so that the hash is
+// computed over the same values Read decodes from the log. Struct fields
+// otherwise encode in declaration order, while decoded maps encode sorted.
+func normalizeParams(params map[string]any) (map[string]any, error) {
+	if params == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	var normalized map[string]any
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
+
+// readTail returns the sequence number and hash of the last entry in the
+// log, or the genesis values for a missing or empty log
+func readTail(path string) (int64, string, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, GenesisHash, nil
+	}
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to stat audit log: %w", err)
+	}
+
+	// Read backwards until the buffer holds a complete last line
+	size := info.Size()
+	chunk := int64(4096)
+	for {
+		if chunk > size {
+			chunk = size
+		}
+		buf := make([]byte, chunk)
+		if _, err := file.ReadAt(buf, size-chunk); err != nil && err != io.EOF {
+			return 0, "", fmt.Errorf("failed to read audit log: %w", err)
+		}
+		buf = bytes.TrimRight(buf, "\n")
+		if len(buf) == 0 {
+			return 0, GenesisHash, nil
+		}
+
+		idx := bytes.LastIndexByte(buf, '\n')
+		if idx < 0 && chunk < size {
+			chunk *= 2
+			continue
+		}
+
+		var last Entry
+		if err := json.Unmarshal(buf[idx+1:], &last); err != nil {
+			return 0, "", fmt.Errorf("audit log ends with a corrupt entry: %w", err)
+		}
+		return last.Seq, last.Hash, nil
+	}
+}
+
+// VerifyError describes where the chain is broken
+type VerifyError struct {
+	Line   int
+	Reason string
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("audit log line %d: %s", e.Line, e.Reason)
+}
+
+// Read parses and verifies the audit log. The entries read before a broken
+// link are returned together with a *VerifyError.
+func Read(path string) ([]Entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	return verify(file)
+}
+
+// verify reads entries from r and checks the hash chain
+func verify(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	prevHash := GenesisHash
+	var prevSeq int64
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		data := scanner.Bytes()
+		if len(bytes.TrimSpace(data)) == 0 {
+			continue
+		}
+
+		var entry Entry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return entries, &VerifyError{Line: line, Reason: fmt.Sprintf("invalid entry: %v", err)}
+		}
+		if entry.Seq != prevSeq+1 {
+			return entries, &VerifyError{Line: line, Reason: fmt.Sprintf("sequence %d follows %d", entry.Seq, prevSeq)}
+		}
+		if entry.PrevHash != prevHash {
+			return entries, &VerifyError{Line: line, Reason: "previous hash does not match the preceding entry"}
+		}
+		hash, err := entry.computeHash()
+		if err != nil {
+			return entries, &VerifyError{Line: line, Reason: err.Error()}
+		}
+		if hash != entry.Hash {
+			return entries, &VerifyError{Line: line, Reason: "entry hash does not match its content"}
+		}
+
+		entries = append(entries, entry)
+		prevHash, prevSeq = entry.Hash, entry.Seq
+	}
+	if err := scanner.Err(); err != nil {
+		return entries, fmt.Errorf("failed to read audit log: %w", err)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,158 @@
+package audit
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeEntries(t *testing.T, path string) {
+	t.Helper()
+	log := New(path)
+
+	_, err := log.Append(Entry{
+		Command:       "apply_updates",
+		ID:            "c1",
+		Params:        map[string]any{"mode": "packages", "packages": []string{"openssl"}},
+		Outcome:       OutcomeAccepted,
+		VersionBefore: "1.3.0",
+	})
+	require.NoError(t, err)
+	_, err = log.Append(Entry{Command: "apply_updates", ID: "c1", Outcome: OutcomeSucceeded, VersionBefore: "1.3.0", VersionAfter: "1.3.0"})
+	require.NoError(t, err)
+	_, err = log.Append(Entry{Command: "update_agent", ID: "c2", Outcome: OutcomeRefused, Reason: "command update_agent is denied by policy"})
+	require.NoError(t, err)
+}
+
+func TestLog_Append(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "audit.log")
+	writeEntries(t, path)
+
+	entries, err := Read(path)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, int64(1), entries[0].Seq)
+	assert.Equal(t, GenesisHash, entries[0].PrevHash)
+	assert.Equal(t, entries[0].Hash, entries[1].PrevHash)
+	assert.Equal(t, entries[1].Hash, entries[2].PrevHash)
+	assert.Equal(t, []any{"openssl"}, entries[0].Params["packages"])
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// A new writer continues the existing chain
+	entry, err := New(path).Append(Entry{Command: "report_now", Outcome: OutcomeSucceeded, Time: time.Date(2024, 6, 1, 3, 0, 0, 0, time.Local)})
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), entry.Seq)
+	assert.Equal(t, entries[2].Hash, entry.PrevHash)
+
+	entries, err = Read(path)
+	require.NoError(t, err)
+	assert.Len(t, entries, 4)
+}
+
+func TestLog_Append_StructParams(t *testing.T) {
+	// Fields in an order that differs from the sorted keys of a decoded map
+	type window struct {
+		Start string   `json:"start"`
+		End   string   `json:"end"`
+		Days  []string `json:"days,omitempty"`
+	}
+	type schedule struct {
+		Timezone string   `json:"timezone"`
+		Windows  []window `json:"blackout_windows"`
+	}
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	log := New(path)
+	entry, err := log.Append(Entry{
+		Command: "settings_update",
+		Params: map[string]any{
+			"schedule": &schedule{Timezone: "UTC", Windows: []window{{Start: "22:00", End: "06:00", Days: []string{"sat"}}}},
+			"interval": 60,
+		},
+		Outcome: OutcomeSucceeded,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, float64(60), entry.Params["interval"])
+
+	_, err = log.Append(Entry{Command: "report_now", Outcome: OutcomeSucceeded})
+	require.NoError(t, err)
+
+	entries, err := Read(path)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, entry.Hash, entries[0].Hash)
+	assert.Equal(t, entries[0].Params, entry.Params)
+}
+
+func TestRead_Tampering(t *testing.T) {
+	tamper := map[string]func(lines []string) []string{
+		"edited entry": func(lines []string) []string {
+			lines[1] = strings.Replace(lines[1], `"succeeded"`, `"failed"`, 1)
+			return lines
+		},
+		"removed entry": func(lines []string) []string {
+			return append(lines[:1], lines[2:]...)
+		},
+		"reordered entries": func(lines []string) []string {
+			lines[1], lines[2] = lines[2], lines[1]
+			return lines
+		},
+		"garbage": func(lines []string) []string {
+			lines[2] = "not json"
+			return lines
+		},
+	}
+
+	for name, modify := range tamper {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "audit.log")
+			writeEntries(t, path)
+
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+			lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+			require.NoError(t, os.WriteFile(path, []byte(strings.Join(modify(lines), "\n")+"\n"), 0600))
+
+			entries, err := Read(path)
+			var verifyErr *VerifyError
+			require.True(t, errors.As(err, &verifyErr), "expected verification error, got %v", err)
+			assert.Len(t, entries, verifyErr.Line-1)
+		})
+	}
+}
+
+func TestReadTail(t *testing.T) {
+	dir := t.TempDir()
+
+	seq, hash, err := readTail(filepath.Join(dir, "missing.log"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), seq)
+	assert.Equal(t, GenesisHash, hash)
+
+	// Entries longer than the initial read chunk
+	path := filepath.Join(dir, "audit.log")
+	log := New(path)
+	var last Entry
+	for i := 0; i < 3; i++ {
+		last, err = log.Append(Entry{Command: "apply_updates", Outcome: OutcomeSucceeded, Reason: strings.Repeat("x", 5000)})
+		require.NoError(t, err)
+	}
+
+	seq, hash, err = readTail(path)
+	require.NoError(t, err)
+	assert.Equal(t, last.Seq, seq)
+	assert.Equal(t, last.Hash, hash)
+
+	require.NoError(t, os.WriteFile(path, []byte("{broken\n"), 0600))
+	_, _, err = readTail(path)
+	assert.Error(t, err)
+}
@@ -0,0 +1,211 @@
+// Package autoupdate decides whether the agent updates itself automatically.
+//
+// The local update policy lives in the auto_update section of config.yml:
+//
+//	auto_update:
+//	  channel: stable
+//	  pin: "1.3.1"
+//	  minimum_age: 72h
+//	  rollout: 24h
+//	  timezone: Europe/Berlin
+//	  windows:
+//	    - days: [mon, tue, wed, thu]
+//	      start: "09:00"
+//	      end: "16:00"
+//
+// A release is adopted only when the server's auto-update settings allow it
+// for the host as well.
+package autoupdate
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"patchmon-agent/internal/policy"
+	"patchmon-agent/pkg/models"
+)
+
+// Update channels
+const (
+	ChannelStable = "stable"
+	ChannelBeta   = "beta"
+)
+
+// Policy is the validated local update policy of a host
+type Policy struct {
+	channel    string
+	pin        string
+	minimumAge time.Duration
+	rollout    time.Duration
+	location   *time.Location
+	windows    []policy.Window
+	machineID  string
+}
+
+// Release is an agent version offered by the server
+type Release struct {
+	Version string
+	// ReleasedAt is when the release was published, or when this host was
+	// first offered it if the server does not say
+	ReleasedAt time.Time
+}
+
+// Decision is the outcome of evaluating a release
+type Decision struct {
+	Update bool
+	Reason string // Why the release is held back
+}
+
+// New validates the update policy of the host with the given machine ID
+func New(cfg models.UpdatePolicy, machineID string) (*Policy, error) {
+	p := &Policy{
+		channel:    cfg.Channel,
+		pin:        strings.TrimPrefix(cfg.Pin, "v"),
+		minimumAge: cfg.MinimumAge,
+		rollout:    cfg.Rollout,
+		location:   time.Local,
+		machineID:  machineID,
+	}
+
+	switch p.channel {
+	case "":
+		p.channel = ChannelStable
+	case ChannelStable, ChannelBeta:
+	default:
+		return nil, fmt.Errorf("unknown update channel %q, expected %s or %s", cfg.Channel, ChannelStable, ChannelBeta)
+	}
+	if p.minimumAge < 0 || p.rollout < 0 {
+		return nil, fmt.Errorf("minimum_age and rollout must not be negative")
+	}
+
+	if cfg.Timezone != "" {
+		location, err := time.LoadLocation(cfg.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone %q: %w", cfg.Timezone, err)
+		}
+		p.location = location
+	}
+
+	for i, w := range cfg.Windows {
+		window := policy.Window{Days: w.Days, Start: w.Start, End: w.End}
+		if err := window.Parse(); err != nil {
+			return nil, fmt.Errorf("update window %d: %w", i+1, err)
+		}
+		p.windows = append(p.windows, window)
+	}
+
+	return p, nil
+}
+
+// Channel returns the update channel to ask the server for
+func (p *Policy) Channel() string {
+	return p.channel
+}
+
+// Evaluate decides whether the host adopts release at time now
+func (p *Policy) Evaluate(settings *models.HostSettingsResponse, release Release, now time.Time) Decision {
+	version := strings.TrimPrefix(release.Version, "v")
+
+	switch {
+	case settings == nil:
+		return Decision{Reason: "auto-update settings are unknown"}
+	case !settings.AutoUpdate:
+		return Decision{Reason: "auto-update is disabled on the server"}
+	case !settings.HostAutoUpdate:
+		return Decision{Reason: "auto-update is disabled for this host on the server"}
+	}
+
+	if p.pin != "" && version != p.pin {
+		return Decision{Reason: fmt.Sprintf("agent is pinned to version %s", p.pin)}
+	}
+	if p.channel == ChannelStable && p.pin == "" && isPrerelease(version) {
+		return Decision{Reason: fmt.Sprintf("version %s is a pre-release and the update channel is %s", version, p.channel)}
+	}
+
+	if adopt := release.ReleasedAt.Add(p.minimumAge + p.rolloutDelay(version)); now.Before(adopt) {
+		return Decision{Reason: fmt.Sprintf("version %s is adopted by this host from %s", version, adopt.Format(time.RFC3339))}
+	}
+
+	if !p.inWindow(now) {
+		return Decision{Reason: "outside the update windows"}
+	}
+
+	return Decision{Update: true}
+}
+
+// rolloutDelay is this host's place in the rollout of version. Hosts take
+// a different place for each release, so no host always goes first.
+func (p *Policy) rolloutDelay(version string) time.Duration {
+	if p.rollout <= 0 {
+		return 0
+	}
+	sum := sha256.Sum256([]byte(p.machineID + "\x00" + version))
+	return time.Duration(binary.BigEndian.Uint64(sum[:8]) % uint64(p.rollout))
+}
+
+// inWindow reports whether t falls inside an update window. Without
+// windows there is no restriction.
+func (p *Policy) inWindow(t time.Time) bool {
+	if len(p.windows) == 0 {
+		return true
+	}
+	t = t.In(p.location)
+	for i := range p.windows {
+		if p.windows[i].Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPrerelease reports whether a semantic version has a pre-release suffix
+// such as 1.4.0-beta.1
+func isPrerelease(version string) bool {
+	version, _, _ = strings.Cut(version, "+")
+	return strings.Contains(version, "-")
+}
+
+// seen records when the latest release was first offered to the host
+type seen struct {
+	Version   string    `json:"version"`
+	FirstSeen time.Time `json:"first_seen"`
+}
+
+// FirstSeen returns when version was first offered to the host, recording
+// now in the file at path if it was not offered before
+func FirstSeen(path, version string, now time.Time) (time.Time, error) {
+	version = strings.TrimPrefix(version, "v")
+
+	var record seen
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return now, fmt.Errorf("error reading %s: %w", path, err)
+	default:
+		// A corrupt file is replaced below
+		if json.Unmarshal(data, &record) == nil && record.Version == version && !record.FirstSeen.IsZero() {
+			return record.FirstSeen, nil
+		}
+	}
+
+	data, err = json.Marshal(seen{Version: version, FirstSeen: now})
+	if err != nil {
+		return now, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return now, fmt.Errorf("error creating state directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return now, fmt.Errorf("error writing %s: %w", path, err)
+	}
+	return now, nil
+}
@@ -0,0 +1,171 @@
+package autoupdate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"patchmon-agent/pkg/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         models.UpdatePolicy
+		expectError bool
+	}{
+		{name: "empty", cfg: models.UpdatePolicy{}},
+		{name: "beta", cfg: models.UpdatePolicy{Channel: "beta", MinimumAge: time.Hour}},
+		{name: "unknown channel", cfg: models.UpdatePolicy{Channel: "nightly"}, expectError: true},
+		{name: "negative age", cfg: models.UpdatePolicy{MinimumAge: -time.Hour}, expectError: true},
+		{name: "bad timezone", cfg: models.UpdatePolicy{Timezone: "Mars/Olympus"}, expectError: true},
+		{
+			name:        "bad window",
+			cfg:         models.UpdatePolicy{Windows: []models.UpdateWindow{{Start: "25:00", End: "06:00"}}},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := New(tt.cfg, "machine")
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.NotEmpty(t, p.Channel())
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	enabled := &models.HostSettingsResponse{AutoUpdate: true, HostAutoUpdate: true}
+	// Wednesday
+	now := time.Date(2024, 6, 5, 12, 0, 0, 0, time.UTC)
+	released := now.Add(-48 * time.Hour)
+
+	tests := []struct {
+		name     string
+		cfg      models.UpdatePolicy
+		settings *models.HostSettingsResponse
+		release  Release
+		expected bool
+	}{
+		{name: "defaults", settings: enabled, release: Release{"1.3.1", released}, expected: true},
+		{name: "settings unknown", release: Release{"1.3.1", released}},
+		{
+			name:     "disabled on the server",
+			settings: &models.HostSettingsResponse{AutoUpdate: false, HostAutoUpdate: true},
+			release:  Release{"1.3.1", released},
+		},
+		{
+			name:     "disabled for the host",
+			settings: &models.HostSettingsResponse{AutoUpdate: true, HostAutoUpdate: false},
+			release:  Release{"1.3.1", released},
+		},
+		{name: "pinned elsewhere", cfg: models.UpdatePolicy{Pin: "1.3.0"}, settings: enabled, release: Release{"1.3.1", released}},
+		{name: "pinned version", cfg: models.UpdatePolicy{Pin: "v1.3.1"}, settings: enabled, release: Release{"v1.3.1", released}, expected: true},
+		{name: "pre-release on stable", settings: enabled, release: Release{"1.4.0-beta.1", released}},
+		{name: "pre-release on beta", cfg: models.UpdatePolicy{Channel: "beta"}, settings: enabled, release: Release{"1.4.0-beta.1", released}, expected: true},
+		{name: "build metadata", settings: enabled, release: Release{"1.3.1+build-7", released}, expected: true},
+		{name: "too new", cfg: models.UpdatePolicy{MinimumAge: 72 * time.Hour}, settings: enabled, release: Release{"1.3.1", released}},
+		{name: "old enough", cfg: models.UpdatePolicy{MinimumAge: 24 * time.Hour}, settings: enabled, release: Release{"1.3.1", released}, expected: true},
+		{
+			name:     "rollout not reached",
+			cfg:      models.UpdatePolicy{MinimumAge: 48 * time.Hour, Rollout: 1000 * time.Hour},
+			settings: enabled,
+			release:  Release{"1.3.1", now},
+		},
+		{
+			name:     "rollout complete",
+			cfg:      models.UpdatePolicy{Rollout: 24 * time.Hour},
+			settings: enabled,
+			release:  Release{"1.3.1", released},
+			expected: true,
+		},
+		{
+			name:     "inside window",
+			cfg:      models.UpdatePolicy{Windows: []models.UpdateWindow{{Days: []string{"wed"}, Start: "09:00", End: "16:00"}}},
+			settings: enabled,
+			release:  Release{"1.3.1", released},
+			expected: true,
+		},
+		{
+			name:     "outside window",
+			cfg:      models.UpdatePolicy{Windows: []models.UpdateWindow{{Days: []string{"sat", "sun"}, Start: "02:00", End: "06:00"}}},
+			settings: enabled,
+			release:  Release{"1.3.1", released},
+		},
+		{
+			name: "window in timezone",
+			cfg: models.UpdatePolicy{
+				Timezone: "Asia/Tokyo",
+				Windows:  []models.UpdateWindow{{Start: "20:00", End: "23:00"}},
+			},
+			settings: enabled,
+			release:  Release{"1.3.1", released},
+			expected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := New(tt.cfg, "machine")
+			require.NoError(t, err)
+
+			decision := p.Evaluate(tt.settings, tt.release, now)
+			assert.Equal(t, tt.expected, decision.Update, decision.Reason)
+			if !tt.expected {
+				assert.NotEmpty(t, decision.Reason)
+			}
+		})
+	}
+}
+
+func TestRolloutDelay(t *testing.T) {
+	cfg := models.UpdatePolicy{Rollout: 24 * time.Hour}
+	a, err := New(cfg, "machine-a")
+	require.NoError(t, err)
+	b, err := New(cfg, "machine-b")
+	require.NoError(t, err)
+
+	delay := a.rolloutDelay("1.3.1")
+	assert.GreaterOrEqual(t, delay, time.Duration(0))
+	assert.Less(t, delay, 24*time.Hour)
+	assert.Equal(t, delay, a.rolloutDelay("1.3.1"))
+	assert.NotEqual(t, delay, b.rolloutDelay("1.3.1"))
+
+	none, err := New(models.UpdatePolicy{}, "machine-a")
+	require.NoError(t, err)
+	assert.Zero(t, none.rolloutDelay("1.3.1"))
+}
+
+func TestFirstSeen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "update-seen.json")
+	first := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+
+	seen, err := FirstSeen(path, "1.3.1", first)
+	require.NoError(t, err)
+	assert.Equal(t, first, seen)
+
+	// The same version keeps its first sighting
+	seen, err = FirstSeen(path, "v1.3.1", first.Add(time.Hour))
+	require.NoError(t, err)
+	assert.True(t, first.Equal(seen))
+
+	// A new version starts over
+	seen, err = FirstSeen(path, "1.3.2", first.Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, first.Add(2*time.Hour), seen)
+
+	// A corrupt file is replaced
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0600))
+	seen, err = FirstSeen(path, "1.3.2", first.Add(3*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, first.Add(3*time.Hour), seen)
+}
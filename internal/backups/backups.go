@@ -0,0 +1,244 @@
+// Package backups keeps the agent builds replaced by self-updates in a
+// state directory, so that an update can be rolled back.
+//
+// Each backup is a copy of the executable next to a JSON file with its
+// version and SHA-256:
+//
+//	/var/lib/patchmon/backups/patchmon-agent-1.3.0-20240601_100000
+//	/var/lib/patchmon/backups/patchmon-agent-1.3.0-20240601_100000.json
+package backups
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when no backup of a version is retained
+var ErrNotFound = errors.New("no backup of that version")
+
+// Backup describes a retained build
+type Backup struct {
+	Version   string    `json:"version"`
+	SHA256    string    `json:"sha256"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+	Source    string    `json:"source"` // Executable the build was copied from
+
+	// Path is the copy of the build, next to its metadata
+	Path string `json:"-"`
+}
+
+// Save copies the executable into dir as a backup of the given version
+func Save(dir, executable, version string, now time.Time) (*Backup, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("error creating backup directory: %w", err)
+	}
+
+	name := fmt.Sprintf("%s-%s-%s", filepath.Base(executable), safeName(version), now.Format("20060102_150405"))
+	b := &Backup{
+		Version:   version,
+		CreatedAt: now,
+		Source:    executable,
+		Path:      filepath.Join(dir, name),
+	}
+
+	sum, size, err := copyFile(executable, b.Path)
+	if err != nil {
+		return nil, err
+	}
+	b.SHA256, b.Size = sum, size
+
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(b.Path+".json", data, 0600); err != nil {
+		_ = os.Remove(b.Path)
+		return nil, fmt.Errorf("error writing backup metadata: %w", err)
+	}
+	return b, nil
+}
+
+// List returns the backups in dir, newest first. Builds without readable
+// metadata are skipped.
+func List(dir string) ([]Backup, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading backup directory: %w", err)
+	}
+
+	var list []Backup
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		var b Backup
+		if err := json.Unmarshal(data, &b); err != nil {
+			continue
+		}
+		b.Path = filepath.Join(dir, name)
+		if _, err := os.Stat(b.Path); err != nil {
+			continue
+		}
+		list = append(list, b)
+	}
+
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].CreatedAt.After(list[j].CreatedAt)
+	})
+	return list, nil
+}
+
+// Find returns the newest backup of version
+func Find(dir, version string) (*Backup, error) {
+	list, err := List(dir)
+	if err != nil {
+		return nil, err
+	}
+	version = strings.TrimPrefix(version, "v")
+	for i := range list {
+		if strings.TrimPrefix(list[i].Version, "v") == version {
+			return &list[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNotFound, version)
+}
+
+// Prune removes all but the newest keep backups in dir, and returns the
+// removed ones. At least one backup is always kept, as the last one is
+// needed to roll back the update that made it.
+func Prune(dir string, keep int) ([]Backup, error) {
+	list, err := List(dir)
+	if err != nil {
+		return nil, err
+	}
+	keep = max(keep, 1)
+	if len(list) <= keep {
+		return nil, nil
+	}
+
+	var removed []Backup
+	for _, b := range list[keep:] {
+		if err := b.Remove(); err != nil {
+			return removed, err
+		}
+		removed = append(removed, b)
+	}
+	return removed, nil
+}
+
+// Remove deletes the backup and its metadata
+func (b *Backup) Remove() error {
+	if err := os.Remove(b.Path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("error removing backup: %w", err)
+	}
+	if err := os.Remove(b.Path + ".json"); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("error removing backup metadata: %w", err)
+	}
+	return nil
+}
+
+// Verify checks the backup against its recorded SHA-256
+func (b *Backup) Verify() error {
+	f, err := os.Open(b.Path)
+	if err != nil {
+		return fmt.Errorf("error opening backup: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return fmt.Errorf("error reading backup: %w", err)
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != b.SHA256 {
+		return fmt.Errorf("backup %s is corrupt: sha256 %s, expected %s", b.Path, sum, b.SHA256)
+	}
+	return nil
+}
+
+// Restore verifies the backup and installs it over the executable
+func (b *Backup) Restore(executable string) error {
+	if err := b.Verify(); err != nil {
+		return err
+	}
+	return Install(b.Path, executable)
+}
+
+// Install copies src over the executable. The copy is written next to the
+// executable and renamed into place, so the executable is never left
+// half-written.
+func Install(src, executable string) error {
+	tempPath := executable + ".rollback"
+	if _, _, err := copyFile(src, tempPath); err != nil {
+		return err
+	}
+	if err := os.Chmod(tempPath, 0755); err != nil {
+		_ = os.Remove(tempPath)
+		return fmt.Errorf("error writing restored executable: %w", err)
+	}
+	if err := os.Rename(tempPath, executable); err != nil {
+		_ = os.Remove(tempPath)
+		return fmt.Errorf("error replacing executable: %w", err)
+	}
+	return nil
+}
+
+// copyFile copies src to dst with mode 0755, syncs it to disk and returns
+// its SHA-256 and size
+func copyFile(src, dst string) (string, int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return "", 0, fmt.Errorf("error opening %s: %w", src, err)
+	}
+	defer func() { _ = in.Close() }()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		return "", 0, fmt.Errorf("error creating %s: %w", dst, err)
+	}
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(out, h), in)
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(dst)
+		return "", 0, fmt.Errorf("error writing %s: %w", dst, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+// safeName makes a version usable in a file name
+func safeName(version string) string {
+	version = strings.TrimPrefix(version, "v")
+	if version == "" {
+		return "unknown"
+	}
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == os.PathSeparator || r < ' ' {
+			return '_'
+		}
+		return r
+	}, version)
+}
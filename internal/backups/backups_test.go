@@ -0,0 +1,130 @@
+package backups
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveList(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "backups")
+	executable := filepath.Join(t.TempDir(), "patchmon-agent")
+	require.NoError(t, os.WriteFile(executable, []byte("abc"), 0755))
+
+	now := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	saved, err := Save(dir, executable, "v1.3.0", now)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "patchmon-agent-1.3.0-20240601_100000"), saved.Path)
+	assert.Equal(t, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad", saved.SHA256)
+	assert.Equal(t, int64(3), saved.Size)
+
+	require.NoError(t, os.WriteFile(executable, []byte("abcd"), 0755))
+	_, err = Save(dir, executable, "1.3.1", now.Add(time.Hour))
+	require.NoError(t, err)
+
+	// Stray files are not backups
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("x"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "orphan.json"), []byte(`{"version":"1.0.0"}`), 0600))
+
+	list, err := List(dir)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, "1.3.1", list[0].Version)
+	assert.Equal(t, "v1.3.0", list[1].Version)
+	assert.Equal(t, saved.Path, list[1].Path)
+	assert.True(t, saved.CreatedAt.Equal(list[1].CreatedAt))
+
+	list, err = List(filepath.Join(t.TempDir(), "missing"))
+	require.NoError(t, err)
+	assert.Empty(t, list)
+}
+
+func TestFind(t *testing.T) {
+	dir := t.TempDir()
+	executable := filepath.Join(t.TempDir(), "patchmon-agent")
+	require.NoError(t, os.WriteFile(executable, []byte("agent"), 0755))
+
+	now := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	_, err := Save(dir, executable, "1.3.0", now)
+	require.NoError(t, err)
+	newest, err := Save(dir, executable, "1.3.0", now.Add(time.Hour))
+	require.NoError(t, err)
+
+	found, err := Find(dir, "v1.3.0")
+	require.NoError(t, err)
+	assert.Equal(t, newest.Path, found.Path)
+
+	_, err = Find(dir, "1.2.0")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestPrune(t *testing.T) {
+	tests := []struct {
+		name            string
+		keep            int
+		expectedRemoved int
+	}{
+		{name: "keep some", keep: 2, expectedRemoved: 2},
+		{name: "keep all", keep: 5, expectedRemoved: 0},
+		{name: "keep at least one", keep: 0, expectedRemoved: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			executable := filepath.Join(t.TempDir(), "patchmon-agent")
+			require.NoError(t, os.WriteFile(executable, []byte("agent"), 0755))
+
+			now := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+			for i, version := range []string{"1.0.0", "1.1.0", "1.2.0", "1.3.0"} {
+				_, err := Save(dir, executable, version, now.Add(time.Duration(i)*time.Hour))
+				require.NoError(t, err)
+			}
+
+			removed, err := Prune(dir, tt.keep)
+			require.NoError(t, err)
+			assert.Len(t, removed, tt.expectedRemoved)
+			for _, b := range removed {
+				_, err := os.Stat(b.Path)
+				assert.True(t, os.IsNotExist(err))
+				_, err = os.Stat(b.Path + ".json")
+				assert.True(t, os.IsNotExist(err))
+			}
+
+			list, err := List(dir)
+			require.NoError(t, err)
+			require.Len(t, list, 4-tt.expectedRemoved)
+			assert.Equal(t, "1.3.0", list[0].Version)
+		})
+	}
+}
+
+func TestRestore(t *testing.T) {
+	dir := t.TempDir()
+	executable := filepath.Join(t.TempDir(), "patchmon-agent")
+	require.NoError(t, os.WriteFile(executable, []byte("previous release"), 0755))
+
+	b, err := Save(dir, executable, "1.3.0", time.Now())
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(executable, []byte("broken release"), 0700))
+
+	require.NoError(t, b.Restore(executable))
+	data, err := os.ReadFile(executable)
+	require.NoError(t, err)
+	assert.Equal(t, "previous release", string(data))
+	info, err := os.Stat(executable)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+
+	// A corrupt backup is not installed
+	require.NoError(t, os.WriteFile(b.Path, []byte("tampered"), 0755))
+	require.NoError(t, os.WriteFile(executable, []byte("current release"), 0755))
+	assert.ErrorContains(t, b.Restore(executable), "corrupt")
+	data, err = os.ReadFile(executable)
+	require.NoError(t, err)
+	assert.Equal(t, "current release", string(data))
+}
@@ -16,7 +16,7 @@ import (
 type Client struct {
 	client      *resty.Client
 	config      *models.Config
-	credentials *models.Credentials
+	credentials func() *models.Credentials
 	logger      *logrus.Logger
 }
 
@@ -33,11 +33,21 @@ func New(configMgr *config.Manager, logger *logrus.Logger) *Client {
 	return &Client{
 		client:      client,
 		config:      configMgr.GetConfig(),
-		credentials: configMgr.GetCredentials(),
+		credentials: configMgr.GetCredentials,
 		logger:      logger,
 	}
 }
 
+// authHeaders returns the API credential headers. The credentials are read
+// for each request, as a configuration reload may replace them.
+func (c *Client) authHeaders() map[string]string {
+	credentials := c.credentials()
+	return map[string]string{
+		"X-API-ID":  credentials.APIID,
+		"X-API-KEY": credentials.APIKey,
+	}
+}
+
 // Ping sends a ping request to the server
 func (c *Client) Ping(ctx context.Context) (*models.PingResponse, error) {
 	url := fmt.Sprintf("%s/api/%s/hosts/ping", c.config.PatchmonServer, c.config.APIVersion)
@@ -50,8 +60,7 @@ func (c *Client) Ping(ctx context.Context) (*models.PingResponse, error) {
 	resp, err := c.client.R().
 		SetContext(ctx).
 		SetHeader("Content-Type", "application/json").
-		SetHeader("X-API-ID", c.credentials.APIID).
-		SetHeader("X-API-KEY", c.credentials.APIKey).
+		SetHeaders(c.authHeaders()).
 		SetResult(&models.PingResponse{}).
 		Post(url)
 
@@ -83,8 +92,7 @@ func (c *Client) SendUpdate(ctx context.Context, payload *models.ReportPayload)
 	resp, err := c.client.R().
 		SetContext(ctx).
 		SetHeader("Content-Type", "application/json").
-		SetHeader("X-API-ID", c.credentials.APIID).
-		SetHeader("X-API-KEY", c.credentials.APIKey).
+		SetHeaders(c.authHeaders()).
 		SetBody(payload).
 		SetResult(&models.UpdateResponse{}).
 		Post(url)
@@ -105,6 +113,33 @@ func (c *Client) SendUpdate(ctx context.Context, payload *models.ReportPayload)
 	return result, nil
 }
 
+// ReportRollback tells the server that a self-update was rolled back
+func (c *Client) ReportRollback(ctx context.Context, payload *models.AgentRollbackPayload) error {
+	url := fmt.Sprintf("%s/api/%s/hosts/agent/rollback", c.config.PatchmonServer, c.config.APIVersion)
+
+	c.logger.WithFields(logrus.Fields{
+		"url":    url,
+		"method": "POST",
+	}).Debug("Reporting agent rollback to server")
+
+	resp, err := c.client.R().
+		SetContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetHeaders(c.authHeaders()).
+		SetBody(payload).
+		Post(url)
+
+	if err != nil {
+		return fmt.Errorf("rollback report failed: %w", err)
+	}
+
+	if resp.StatusCode() != 200 {
+		return fmt.Errorf("rollback report failed with status %d: %s", resp.StatusCode(), resp.String())
+	}
+
+	return nil
+}
+
 // GetUpdateInterval gets the current update interval from server
 func (c *Client) GetUpdateInterval(ctx context.Context) (*models.UpdateIntervalResponse, error) {
 	url := fmt.Sprintf("%s/api/%s/settings/update-interval", c.config.PatchmonServer, c.config.APIVersion)
@@ -114,8 +149,7 @@ func (c *Client) GetUpdateInterval(ctx context.Context) (*models.UpdateIntervalR
 	resp, err := c.client.R().
 		SetContext(ctx).
 		SetHeader("Content-Type", "application/json").
-		SetHeader("X-API-ID", c.credentials.APIID).
-		SetHeader("X-API-KEY", c.credentials.APIKey).
+		SetHeaders(c.authHeaders()).
 		SetResult(&models.UpdateIntervalResponse{}).
 		Get(url)
 
@@ -134,3 +168,62 @@ func (c *Client) GetUpdateInterval(ctx context.Context) (*models.UpdateIntervalR
 
 	return result, nil
 }
+
+// GetHostSettings gets the server's auto-update settings for this host
+func (c *Client) GetHostSettings(ctx context.Context) (*models.HostSettingsResponse, error) {
+	url := fmt.Sprintf("%s/api/%s/hosts/settings", c.config.PatchmonServer, c.config.APIVersion)
+
+	c.logger.Debug("Getting host settings from server")
+
+	resp, err := c.client.R().
+		SetContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetHeaders(c.authHeaders()).
+		SetResult(&models.HostSettingsResponse{}).
+		Get(url)
+
+	if err != nil {
+		return nil, fmt.Errorf("host settings request failed: %w", err)
+	}
+
+	if resp.StatusCode() != 200 {
+		return nil, fmt.Errorf("host settings request failed with status %d: %s", resp.StatusCode(), resp.String())
+	}
+
+	result, ok := resp.Result().(*models.HostSettingsResponse)
+	if !ok {
+		return nil, fmt.Errorf("invalid response format")
+	}
+
+	return result, nil
+}
+
+// GetAgentTimestamp gets the version and publication time of the agent
+// binary the server offers
+func (c *Client) GetAgentTimestamp(ctx context.Context) (*models.AgentTimestampResponse, error) {
+	url := fmt.Sprintf("%s/api/%s/hosts/agent/timestamp", c.config.PatchmonServer, c.config.APIVersion)
+
+	c.logger.Debug("Getting agent timestamp from server")
+
+	resp, err := c.client.R().
+		SetContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetHeaders(c.authHeaders()).
+		SetResult(&models.AgentTimestampResponse{}).
+		Get(url)
+
+	if err != nil {
+		return nil, fmt.Errorf("agent timestamp request failed: %w", err)
+	}
+
+	if resp.StatusCode() != 200 {
+		return nil, fmt.Errorf("agent timestamp request failed with status %d: %s", resp.StatusCode(), resp.String())
+	}
+
+	result, ok := resp.Result().(*models.AgentTimestampResponse)
+	if !ok {
+		return nil, fmt.Errorf("invalid response format")
+	}
+
+	return result, nil
+}
@@ -0,0 +1,56 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"patchmon-agent/internal/config"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_ReloadedCredentials(t *testing.T) {
+	var keys []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("X-API-KEY"))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"message":"pong"}`))
+	}))
+	t.Cleanup(server.Close)
+
+	dir := t.TempDir()
+	credentialsFile := filepath.Join(dir, "credentials.yml")
+	configFile := filepath.Join(dir, "config.yml")
+	writeCredentials := func(key string) {
+		require.NoError(t, os.WriteFile(credentialsFile, []byte(fmt.Sprintf("api_id: id\napi_key: %s\n", key)), 0600))
+	}
+	require.NoError(t, os.WriteFile(configFile, []byte(fmt.Sprintf("patchmon_server: %s\napi_version: v1\ncredentials_file: %s\n", server.URL, credentialsFile)), 0600))
+	writeCredentials("old")
+
+	configMgr := config.New()
+	configMgr.SetConfigFile(configFile)
+	require.NoError(t, configMgr.LoadConfig())
+	require.NoError(t, configMgr.LoadCredentials())
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	c := New(configMgr, logger)
+
+	_, err := c.Ping(context.Background())
+	require.NoError(t, err)
+
+	// A client created before a reload sends the new credentials
+	writeCredentials("new")
+	require.NoError(t, configMgr.LoadCredentials())
+	_, err = c.Ping(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"old", "new"}, keys)
+}
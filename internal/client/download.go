@@ -0,0 +1,336 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"patchmon-agent/internal/version"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	downloadAttempts    = 5                // Attempts before giving up on a download
+	downloadRetryWait   = 5 * time.Second  // Wait between attempts
+	downloadIdleTimeout = 60 * time.Second // Abort an attempt that receives nothing for this long
+	downloadProgressLog = 10 * time.Second // How often download progress is logged
+)
+
+var (
+	// ErrDownloadTooLarge is returned when a download exceeds its size limit
+	ErrDownloadTooLarge = errors.New("download exceeds size limit")
+
+	errDownloadStalled = errors.New("download stalled")
+)
+
+// DownloadAgentBinary streams the agent binary for arch from the given
+// update channel (the server's default if empty) into path and returns its
+// size. A partial file left by an interrupted attempt, in this process or an
+// earlier one, is resumed with an HTTP Range request conditional on the
+// ETag or Last-Modified it started with, which is kept next to it. The
+// download is capped at maxSize bytes and synced to disk before returning,
+// so the caller can rename it into place.
+//
+// Unlike the other requests there is no overall timeout, as the binary may
+// take long to arrive over a slow link; an attempt is only aborted when no
+// data arrives for a while.
+func (c *Client) DownloadAgentBinary(ctx context.Context, arch, channel, path string, maxSize int64) (int64, error) {
+	query := url.Values{"arch": {arch}}
+	if channel != "" {
+		query.Set("channel", channel)
+	}
+	d := &download{
+		client:  c,
+		http:    &http.Client{},
+		url:     fmt.Sprintf("%s/api/%s/hosts/agent/download?%s", c.config.PatchmonServer, c.config.APIVersion, query.Encode()),
+		path:    path,
+		maxSize: maxSize,
+	}
+	if data, err := os.ReadFile(d.validatorPath()); err == nil {
+		d.validator = strings.TrimSpace(string(data))
+	}
+
+	var err error
+	for attempt := 1; attempt <= downloadAttempts; attempt++ {
+		var retry bool
+		retry, err = d.attempt(ctx)
+		if err == nil {
+			return d.size, nil
+		}
+		if !retry || ctx.Err() != nil || attempt == downloadAttempts {
+			break
+		}
+
+		c.logger.WithError(err).WithField("attempt", attempt).Warn("Agent download interrupted, resuming")
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(downloadRetryWait):
+		}
+	}
+	return 0, err
+}
+
+// download is the state of one DownloadAgentBinary call across attempts
+type download struct {
+	client  *Client
+	http    *http.Client
+	url     string
+	path    string
+	maxSize int64
+
+	// validator is the ETag or Last-Modified of the response the partial file
+	// started with, sent with resumed requests so that a changed binary is
+	// downloaded from the start
+	validator string
+	size      int64
+}
+
+// attempt runs one request, appending to what is already on disk. It
+// reports whether a failure is worth retrying.
+func (d *download) attempt(ctx context.Context) (bool, error) {
+	f, err := os.OpenFile(d.path, os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return false, fmt.Errorf("failed to open download file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return false, err
+	}
+	// Without a validator the partial file may be of another build
+	if offset > d.maxSize || (offset > 0 && d.validator == "") {
+		if offset, err = truncate(f); err != nil {
+			return false, err
+		}
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", d.url, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("User-Agent", fmt.Sprintf("patchmon-agent/%s", version.Version))
+	credentials := d.client.credentials()
+	req.Header.Set("X-API-ID", credentials.APIID)
+	req.Header.Set("X-API-KEY", credentials.APIKey)
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		if d.validator != "" {
+			req.Header.Set("If-Range", d.validator)
+		}
+	}
+
+	d.client.logger.WithFields(logrus.Fields{
+		"url":    d.url,
+		"offset": offset,
+	}).Debug("Downloading agent binary")
+
+	resp, err := d.http.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("download request failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	total := int64(-1)
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// The whole binary, either because nothing was resumed or because
+		// the server ignored the range
+		if offset, err = truncate(f); err != nil {
+			return false, err
+		}
+		total = resp.ContentLength
+		if err := d.saveValidator(validator(resp.Header)); err != nil {
+			return false, err
+		}
+	case http.StatusPartialContent:
+		start, size, err := parseContentRange(resp.Header.Get("Content-Range"))
+		if err != nil || start != offset {
+			if _, err := truncate(f); err != nil {
+				return false, err
+			}
+			return true, fmt.Errorf("server resumed download at the wrong offset: %q", resp.Header.Get("Content-Range"))
+		}
+		total = size
+	case http.StatusRequestedRangeNotSatisfiable:
+		// Nothing is left to download if the file on disk is already complete
+		if _, size, err := parseContentRange(resp.Header.Get("Content-Range")); err == nil && size == offset {
+			return d.finish(f, offset)
+		}
+		if _, err := truncate(f); err != nil {
+			return false, err
+		}
+		return true, fmt.Errorf("server refused to resume download at %d bytes", offset)
+	default:
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return retry, fmt.Errorf("server returned status %d", resp.StatusCode)
+	}
+
+	if total > d.maxSize {
+		d.discard(f)
+		return false, fmt.Errorf("%w: agent binary is %d bytes, limit is %d", ErrDownloadTooLarge, total, d.maxSize)
+	}
+
+	stall := time.AfterFunc(downloadIdleTimeout, func() { cancel(errDownloadStalled) })
+	defer stall.Stop()
+	body := &idleReader{r: resp.Body, timer: stall}
+	progress := &progressWriter{logger: d.client.logger, written: offset, total: total, last: time.Now()}
+
+	// Read one byte past the limit to detect oversized bodies without a length
+	n, err := io.Copy(io.MultiWriter(f, progress), io.LimitReader(body, d.maxSize-offset+1))
+	written := offset + n
+	if written > d.maxSize {
+		d.discard(f)
+		return false, fmt.Errorf("%w: limit is %d bytes", ErrDownloadTooLarge, d.maxSize)
+	}
+	if err != nil {
+		if cause := context.Cause(ctx); errors.Is(cause, errDownloadStalled) {
+			err = cause
+		}
+		return true, fmt.Errorf("download interrupted after %d bytes: %w", written, err)
+	}
+	if total >= 0 && written != total {
+		return true, fmt.Errorf("download ended after %d of %d bytes", written, total)
+	}
+
+	return d.finish(f, written)
+}
+
+// finish syncs the completed file to disk
+func (d *download) finish(f *os.File, size int64) (bool, error) {
+	if err := f.Sync(); err != nil {
+		return false, fmt.Errorf("failed to sync download: %w", err)
+	}
+	d.size = size
+	d.removeValidator()
+	d.client.logger.WithField("bytes", size).Info("Agent binary downloaded")
+	return false, nil
+}
+
+// discard removes a download that must not be resumed
+func (d *download) discard(f *os.File) {
+	_ = f.Close()
+	if err := os.Remove(d.path); err != nil && !os.IsNotExist(err) {
+		d.client.logger.WithError(err).Warn("Failed to remove download file")
+	}
+	d.removeValidator()
+}
+
+// validatorPath is where the validator of a partial download is kept
+func (d *download) validatorPath() string {
+	return d.path + ".validator"
+}
+
+// saveValidator records the validator of a download starting over. A
+// response without one leaves nothing to resume against.
+func (d *download) saveValidator(value string) error {
+	d.validator = value
+	if value == "" {
+		d.removeValidator()
+		return nil
+	}
+	if err := os.WriteFile(d.validatorPath(), []byte(value+"\n"), 0600); err != nil {
+		return fmt.Errorf("failed to save download validator: %w", err)
+	}
+	return nil
+}
+
+func (d *download) removeValidator() {
+	if err := os.Remove(d.validatorPath()); err != nil && !os.IsNotExist(err) {
+		d.client.logger.WithError(err).Warn("Failed to remove download validator")
+	}
+}
+
+// truncate empties f so a download starts over
+func truncate(f *os.File) (int64, error) {
+	if err := f.Truncate(0); err != nil {
+		return 0, fmt.Errorf("failed to reset download file: %w", err)
+	}
+	return f.Seek(0, io.SeekStart)
+}
+
+// validator returns the header a resumed request must match, preferring a
+// strong ETag over Last-Modified
+func validator(h http.Header) string {
+	if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return h.Get("Last-Modified")
+}
+
+// parseContentRange parses "bytes start-end/size" and "bytes */size",
+// returning the start (-1 for the latter) and the complete size
+func parseContentRange(value string) (int64, int64, error) {
+	spec, ok := strings.CutPrefix(value, "bytes ")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid content range %q", value)
+	}
+	rng, sizeText, ok := strings.Cut(spec, "/")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid content range %q", value)
+	}
+	size, err := strconv.ParseInt(sizeText, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid content range %q", value)
+	}
+	if rng == "*" {
+		return -1, size, nil
+	}
+	startText, _, ok := strings.Cut(rng, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid content range %q", value)
+	}
+	start, err := strconv.ParseInt(startText, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid content range %q", value)
+	}
+	return start, size, nil
+}
+
+// idleReader pushes back its timer on every read that returns data
+type idleReader struct {
+	r     io.Reader
+	timer *time.Timer
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.timer.Reset(downloadIdleTimeout)
+	}
+	return n, err
+}
+
+// progressWriter logs the download progress periodically
+type progressWriter struct {
+	logger  *logrus.Logger
+	written int64
+	total   int64
+	last    time.Time
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.written += int64(len(p))
+	if time.Since(w.last) >= downloadProgressLog {
+		w.last = time.Now()
+		fields := logrus.Fields{"bytes": w.written}
+		if w.total > 0 {
+			fields["total"] = w.total
+			fields["percent"] = w.written * 100 / w.total
+		}
+		w.logger.WithFields(fields).Info("Downloading agent binary")
+	}
+	return len(p), nil
+}
@@ -0,0 +1,163 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"patchmon-agent/pkg/models"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// binaryETag is the ETag newDownloadServer serves the binary with
+const binaryETag = `"agent-1.3.1"`
+
+// newDownloadServer serves binary as the agent download and records the
+// Range header of each request
+func newDownloadServer(t *testing.T, binary []byte) (*Client, *[]string) {
+	t.Helper()
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-API-ID") != "id" || r.Header.Get("X-API-KEY") != "key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		assert.Equal(t, "/api/v1/hosts/agent/download", r.URL.Path)
+		assert.Equal(t, "arm64", r.URL.Query().Get("arch"))
+		assert.False(t, r.URL.Query().Has("channel"))
+		ranges = append(ranges, r.Header.Get("Range"))
+		w.Header().Set("ETag", binaryETag)
+		http.ServeContent(w, r, "patchmon-agent", time.Time{}, bytes.NewReader(binary))
+	}))
+	t.Cleanup(server.Close)
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	c := &Client{
+		config:      &models.Config{PatchmonServer: server.URL, APIVersion: "v1"},
+		credentials: func() *models.Credentials { return &models.Credentials{APIID: "id", APIKey: "key"} },
+		logger:      logger,
+	}
+	return c, &ranges
+}
+
+func TestDownloadAgentBinary(t *testing.T) {
+	binary := bytes.Repeat([]byte("\x7fELF agent binary "), 4096)
+
+	tests := []struct {
+		name          string
+		partial       []byte
+		validator     string
+		expectedRange string
+	}{
+		{name: "fresh download", expectedRange: ""},
+		{name: "resume partial file", partial: binary[:1000], validator: binaryETag, expectedRange: "bytes=1000-"},
+		{name: "partial file already complete", partial: binary, validator: binaryETag, expectedRange: "bytes=73728-"},
+		// The server sends the whole binary when If-Range does not match
+		{name: "partial file of another build", partial: []byte("old build"), validator: `"agent-1.3.0"`, expectedRange: "bytes=9-"},
+		{name: "partial file without validator", partial: []byte("old build"), expectedRange: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, ranges := newDownloadServer(t, binary)
+			path := filepath.Join(t.TempDir(), "patchmon-agent.new")
+			if tt.partial != nil {
+				require.NoError(t, os.WriteFile(path, tt.partial, 0600))
+			}
+			if tt.validator != "" {
+				require.NoError(t, os.WriteFile(path+".validator", []byte(tt.validator+"\n"), 0600))
+			}
+
+			size, err := c.DownloadAgentBinary(context.Background(), "arm64", "", path, 1<<20)
+			require.NoError(t, err)
+			assert.Equal(t, int64(len(binary)), size)
+			assert.Equal(t, []string{tt.expectedRange}, *ranges)
+
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+			assert.Equal(t, binary, data)
+
+			// Nothing is left to resume against once complete
+			_, err = os.Stat(path + ".validator")
+			assert.True(t, os.IsNotExist(err))
+		})
+	}
+}
+
+func TestDownloadAgentBinary_SavesValidator(t *testing.T) {
+	binary := bytes.Repeat([]byte("x"), 2048)
+	c, _ := newDownloadServer(t, binary)
+	path := filepath.Join(t.TempDir(), "patchmon-agent.new")
+
+	// A download cut off by the size limit keeps no validator behind
+	_, err := c.DownloadAgentBinary(context.Background(), "arm64", "", path, 1024)
+	assert.ErrorIs(t, err, ErrDownloadTooLarge)
+	_, err = os.Stat(path + ".validator")
+	assert.True(t, os.IsNotExist(err))
+
+	// The validator of an interrupted download is kept for the next process
+	d := &download{client: c, path: path}
+	require.NoError(t, d.saveValidator(binaryETag))
+	data, err := os.ReadFile(path + ".validator")
+	require.NoError(t, err)
+	assert.Equal(t, binaryETag+"\n", string(data))
+}
+
+func TestDownloadAgentBinary_TooLarge(t *testing.T) {
+	c, _ := newDownloadServer(t, bytes.Repeat([]byte("x"), 2048))
+	path := filepath.Join(t.TempDir(), "patchmon-agent.new")
+
+	_, err := c.DownloadAgentBinary(context.Background(), "arm64", "", path, 1024)
+	assert.ErrorIs(t, err, ErrDownloadTooLarge)
+
+	// Nothing is left behind to resume
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDownloadAgentBinary_Unauthorized(t *testing.T) {
+	c, ranges := newDownloadServer(t, []byte("agent"))
+	c.credentials = func() *models.Credentials { return &models.Credentials{APIID: "id", APIKey: "wrong"} }
+
+	_, err := c.DownloadAgentBinary(context.Background(), "arm64", "", filepath.Join(t.TempDir(), "agent"), 1024)
+	assert.ErrorContains(t, err, "status 401")
+	assert.Empty(t, *ranges)
+}
+
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		value         string
+		expectedStart int64
+		expectedSize  int64
+		expectError   bool
+	}{
+		{value: "bytes 1000-4095/4096", expectedStart: 1000, expectedSize: 4096},
+		{value: "bytes */4096", expectedStart: -1, expectedSize: 4096},
+		{value: "bytes 0-10/*", expectError: true},
+		{value: "items 0-10/20", expectError: true},
+		{value: "bytes 10/20", expectError: true},
+		{value: "", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			start, size, err := parseContentRange(tt.value)
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedStart, start)
+			assert.Equal(t, tt.expectedSize, size)
+		})
+	}
+}
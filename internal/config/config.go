@@ -6,6 +6,7 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"time"
 
 	"patchmon-agent/pkg/models"
 
@@ -16,8 +17,17 @@ const (
 	DefaultAPIVersion      = "v1"
 	DefaultConfigFile      = "/etc/patchmon/config.yml"
 	DefaultCredentialsFile = "/etc/patchmon/credentials.yml"
+	DefaultPolicyFile      = "/etc/patchmon/policy.yml"
+	DefaultAuditFile       = "/var/lib/patchmon/audit.log"
+	DefaultControlSocket   = "/run/patchmon/agent.sock"
+	DefaultUpdateStateFile = "/var/lib/patchmon/update-state.json"
+	DefaultUpdateSeenFile  = "/var/lib/patchmon/update-seen.json"
+	DefaultUpdateLockFile  = "/var/lib/patchmon/agent-update.lock"
+	DefaultBackupDir       = "/var/lib/patchmon/backups"
+	DefaultBackupRetention = 3
 	DefaultLogFile         = "/etc/patchmon/logs/patchmon-agent.log"
 	DefaultLogLevel        = "info"
+	DefaultReportJitter    = 30 * time.Second
 	CronFilePath           = "/etc/cron.d/patchmon-agent"
 )
 
@@ -37,6 +47,8 @@ func New() *Manager {
 			CredentialsFile: DefaultCredentialsFile,
 			LogFile:         DefaultLogFile,
 			LogLevel:        DefaultLogLevel,
+			ReportJitter:    DefaultReportJitter,
+			BackupRetention: DefaultBackupRetention,
 		},
 		configFile: DefaultConfigFile,
 	}
@@ -150,6 +162,28 @@ func (m *Manager) SaveConfig() error {
 	configViper.Set("credentials_file", m.config.CredentialsFile)
 	configViper.Set("log_file", m.config.LogFile)
 	configViper.Set("log_level", m.config.LogLevel)
+	configViper.Set("report_jitter", m.config.ReportJitter.String())
+	configViper.Set("backup_retention", m.config.BackupRetention)
+	if !m.config.Schedule.IsZero() {
+		configViper.Set("schedule", m.config.Schedule)
+	}
+	if len(m.config.UpdatePublicKeys) > 0 {
+		configViper.Set("update_public_keys", m.config.UpdatePublicKeys)
+	}
+	if len(m.config.UpdateRevokedKeys) > 0 {
+		configViper.Set("update_revoked_keys", m.config.UpdateRevokedKeys)
+	}
+	if autoUpdate := m.config.AutoUpdate; !autoUpdate.IsZero() {
+		// Durations are written as strings like report_jitter
+		configViper.Set("auto_update", map[string]interface{}{
+			"channel":     autoUpdate.Channel,
+			"pin":         autoUpdate.Pin,
+			"minimum_age": autoUpdate.MinimumAge.String(),
+			"rollout":     autoUpdate.Rollout.String(),
+			"timezone":    autoUpdate.Timezone,
+			"windows":     autoUpdate.Windows,
+		})
+	}
 
 	if err := configViper.WriteConfigAs(m.configFile); err != nil {
 		return fmt.Errorf("error writing config file: %w", err)
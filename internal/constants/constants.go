@@ -50,6 +50,29 @@ const (
 	RepoTypeDeb    = "deb"
 	RepoTypeDebSrc = "deb-src"
 	RepoTypeRPM    = "rpm"
+	RepoTypePacman = "pacman"
+	RepoTypeAPK    = "apk"
+)
+
+// Package source constants
+const (
+	PackageSourceSnap    = "snap"
+	PackageSourceFlatpak = "flatpak"
+)
+
+// Advisory type constants, as used in repository updateinfo metadata
+const (
+	AdvisoryTypeSecurity    = "security"
+	AdvisoryTypeBugfix      = "bugfix"
+	AdvisoryTypeEnhancement = "enhancement"
+	AdvisoryTypeNewPackage  = "newpackage"
+)
+
+// Hold state constants, explaining why a package is not being updated
+const (
+	HoldStateKeptBack      = "kept-back"      // Update needs new dependencies or removals; apt upgrade skips it
+	HoldStateHeld          = "held"           // Held with apt-mark/dpkg
+	HoldStateVersionLocked = "version-locked" // Locked with dnf/yum versionlock
 )
 
 // Log level constants
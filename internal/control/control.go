@@ -0,0 +1,284 @@
+// Package control implements the local control socket of the serve daemon.
+//
+// The daemon serves a small JSON API over HTTP on a root-only Unix socket,
+// which CLI commands use to query its state and hand it work instead of
+// racing it with a separate run:
+//
+//	GET  /v1/status  daemon, schedule, report and WebSocket state
+//	POST /v1/report  run a report through the daemon and wait for it
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"patchmon-agent/internal/reporting"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrNotRunning is returned by the client when no daemon listens on the
+// socket
+var ErrNotRunning = errors.New("agent service is not running")
+
+// Status is the daemon state returned by GET /v1/status
+type Status struct {
+	Version         string           `json:"version"`
+	PID             int              `json:"pid"`
+	Started         time.Time        `json:"started"`
+	IntervalMinutes int              `json:"interval_minutes"`
+	Schedule        string           `json:"schedule"`
+	NextReport      *time.Time       `json:"next_report,omitempty"`
+	Reports         reporting.Status `json:"reports"`
+	WebSocket       WebSocketStatus  `json:"websocket"`
+}
+
+// WebSocketStatus describes the daemon's connection to the server
+type WebSocketStatus struct {
+	Connected bool       `json:"connected"`
+	URL       string     `json:"url,omitempty"`
+	Since     *time.Time `json:"since,omitempty"` // Connected or disconnected since
+	LastError string     `json:"last_error,omitempty"`
+}
+
+// ReportResult is the response of POST /v1/report
+type ReportResult struct {
+	Run   *reporting.RunInfo `json:"run,omitempty"`
+	Error string             `json:"error,omitempty"`
+}
+
+// Handler provides the daemon state and actions behind the socket
+type Handler interface {
+	Status() Status
+	Report(ctx context.Context) error
+}
+
+// Server serves the control API on a Unix socket
+type Server struct {
+	logger   *logrus.Logger
+	path     string
+	handler  Handler
+	listener net.Listener
+	http     *http.Server
+}
+
+// connKey stores the accepted connection in request contexts
+type connKey struct{}
+
+// NewServer creates a control server for the socket at path
+func NewServer(logger *logrus.Logger, path string, handler Handler) *Server {
+	return &Server{
+		logger:  logger,
+		path:    path,
+		handler: handler,
+	}
+}
+
+// Start creates the socket and serves requests in the background. A stale
+// socket left by a crashed daemon is replaced; a live one is an error.
+func (s *Server) Start() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("error creating socket directory: %w", err)
+	}
+
+	if _, err := os.Stat(s.path); err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		_, err := NewClient(s.path).Status(ctx)
+		cancel()
+		if err == nil {
+			return fmt.Errorf("another agent service is listening on %s", s.path)
+		}
+		if err := os.Remove(s.path); err != nil {
+			return fmt.Errorf("error removing stale socket: %w", err)
+		}
+	}
+
+	listener, err := net.Listen("unix", s.path)
+	if err != nil {
+		return fmt.Errorf("error listening on %s: %w", s.path, err)
+	}
+	if err := os.Chmod(s.path, 0600); err != nil {
+		_ = listener.Close()
+		return fmt.Errorf("error setting socket permissions: %w", err)
+	}
+	s.listener = listener
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/status", s.handleStatus)
+	mux.HandleFunc("POST /v1/report", s.handleReport)
+
+	s.http = &http.Server{
+		Handler:           s.authorize(mux),
+		ReadHeaderTimeout: 5 * time.Second,
+		ConnContext: func(ctx context.Context, conn net.Conn) context.Context {
+			return context.WithValue(ctx, connKey{}, conn)
+		},
+	}
+	go func() {
+		if err := s.http.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.WithError(err).Error("Control socket stopped")
+		}
+	}()
+
+	s.logger.WithField("socket", s.path).Info("Control socket listening")
+	return nil
+}
+
+// Close stops serving, waiting up to timeout for requests in flight, and
+// removes the socket
+func (s *Server) Close(timeout time.Duration) error {
+	if s.http == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err := s.http.Shutdown(ctx)
+	if removeErr := os.Remove(s.path); removeErr != nil && !errors.Is(removeErr, fs.ErrNotExist) && err == nil {
+		err = removeErr
+	}
+	return err
+}
+
+// authorize only lets root and the daemon's own user through. The socket
+// permissions already restrict access; this also covers a socket directory
+// created with looser permissions.
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uid, err := peerUID(r.Context())
+		if err != nil {
+			s.logger.WithError(err).Warn("Control socket: failed to identify peer")
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "cannot identify peer"})
+			return
+		}
+		if uid != 0 && int(uid) != os.Geteuid() {
+			s.logger.WithField("uid", uid).Warn("Control socket: refused unprivileged peer")
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "permission denied"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// peerUID returns the user ID of the process on the other end of the
+// request's connection
+func peerUID(ctx context.Context) (uint32, error) {
+	conn, ok := ctx.Value(connKey{}).(*net.UnixConn)
+	if !ok {
+		return 0, errors.New("not a unix socket connection")
+	}
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	var cred *syscall.Ucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	}); err != nil {
+		return 0, err
+	}
+	if credErr != nil {
+		return 0, credErr
+	}
+	return cred.Uid, nil
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.handler.Status())
+}
+
+func (s *Server) handleReport(w http.ResponseWriter, r *http.Request) {
+	s.logger.Info("Report requested over the control socket")
+	err := s.handler.Report(r.Context())
+
+	result := ReportResult{Run: s.handler.Status().Reports.Last}
+	status := http.StatusOK
+	if err != nil {
+		result.Error = err.Error()
+		status = http.StatusInternalServerError
+	}
+	writeJSON(w, status, result)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// Client talks to the daemon over the control socket
+type Client struct {
+	http *http.Client
+}
+
+// NewClient creates a client for the socket at path
+func NewClient(path string) *Client {
+	dialer := &net.Dialer{Timeout: 2 * time.Second}
+	return &Client{
+		http: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return dialer.DialContext(ctx, "unix", path)
+				},
+			},
+		},
+	}
+}
+
+// Status returns the daemon state
+func (c *Client) Status(ctx context.Context) (*Status, error) {
+	status := &Status{}
+	if _, err := c.do(ctx, http.MethodGet, "/v1/status", status); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// Report runs a report through the daemon and waits for it to finish
+func (c *Client) Report(ctx context.Context) (*ReportResult, error) {
+	result := &ReportResult{}
+	code, err := c.do(ctx, http.MethodPost, "/v1/report", result)
+	if err != nil && code != http.StatusInternalServerError {
+		return nil, err
+	}
+	if result.Error != "" {
+		return result, errors.New(result.Error)
+	}
+	return result, nil
+}
+
+// do sends a request and decodes the JSON response into v. Responses other
+// than 200 are returned as errors, with v still decoded.
+func (c *Client) do(ctx context.Context, method, path string, v interface{}) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, "http://patchmon-agent"+path, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		if errors.Is(err, syscall.ENOENT) || errors.Is(err, syscall.ECONNREFUSED) {
+			return 0, ErrNotRunning
+		}
+		return 0, fmt.Errorf("control socket request failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return resp.StatusCode, fmt.Errorf("invalid control socket response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, fmt.Errorf("control socket request failed with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
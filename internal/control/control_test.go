@@ -0,0 +1,105 @@
+package control
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"patchmon-agent/internal/reporting"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeHandler struct {
+	status    Status
+	reportErr error
+	reports   int
+}
+
+func (h *fakeHandler) Status() Status {
+	return h.status
+}
+
+func (h *fakeHandler) Report(ctx context.Context) error {
+	h.reports++
+	h.status.Reports.Runs++
+	h.status.Reports.Last = &reporting.RunInfo{Reasons: []string{reporting.ReasonLocalRequest}}
+	return h.reportErr
+}
+
+func startTestServer(t *testing.T, handler Handler) (*Server, string) {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	path := filepath.Join(t.TempDir(), "run", "agent.sock")
+	server := NewServer(logger, path, handler)
+	require.NoError(t, server.Start())
+	t.Cleanup(func() { _ = server.Close(time.Second) })
+	return server, path
+}
+
+func TestServer_Status(t *testing.T) {
+	handler := &fakeHandler{status: Status{
+		Version:         "1.2.3",
+		IntervalMinutes: 60,
+		WebSocket:       WebSocketStatus{Connected: true, URL: "wss://patchmon.example.com/api/v1/agents/ws"},
+	}}
+	_, path := startTestServer(t, handler)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	status, err := NewClient(path).Status(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "1.2.3", status.Version)
+	assert.Equal(t, 60, status.IntervalMinutes)
+	assert.True(t, status.WebSocket.Connected)
+}
+
+func TestServer_Report(t *testing.T) {
+	handler := &fakeHandler{}
+	_, path := startTestServer(t, handler)
+	client := NewClient(path)
+
+	result, err := client.Report(context.Background())
+	require.NoError(t, err)
+	require.NotNil(t, result.Run)
+	assert.Equal(t, []string{reporting.ReasonLocalRequest}, result.Run.Reasons)
+
+	handler.reportErr = errors.New("failed to get packages")
+	result, err = client.Report(context.Background())
+	assert.EqualError(t, err, "failed to get packages")
+	require.NotNil(t, result)
+	assert.Equal(t, 2, handler.reports)
+}
+
+func TestServer_Lifecycle(t *testing.T) {
+	server, path := startTestServer(t, &fakeHandler{})
+
+	// A second daemon must not take over a live socket
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	assert.Error(t, NewServer(logger, path, &fakeHandler{}).Start())
+
+	require.NoError(t, server.Close(time.Second))
+	_, err := os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = NewClient(path).Status(context.Background())
+	assert.ErrorIs(t, err, ErrNotRunning)
+
+	// A stale socket file is replaced
+	require.NoError(t, os.WriteFile(path, nil, 0600))
+	restarted := NewServer(logger, path, &fakeHandler{})
+	require.NoError(t, restarted.Start())
+	defer func() { _ = restarted.Close(time.Second) }()
+	_, err = NewClient(path).Status(context.Background())
+	assert.NoError(t, err)
+}
@@ -0,0 +1,163 @@
+package packages
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"patchmon-agent/internal/pkgversion"
+	"patchmon-agent/pkg/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// APKManager handles apk package information collection on Alpine systems
+type APKManager struct {
+	logger          *logrus.Logger
+	installedDBPath string
+}
+
+// NewAPKManager creates a new apk package manager
+func NewAPKManager(logger *logrus.Logger) *APKManager {
+	return &APKManager{
+		logger:          logger,
+		installedDBPath: "/lib/apk/db/installed",
+	}
+}
+
+// GetPackages gets package information for apk-based systems
+func (m *APKManager) GetPackages() []models.Package {
+	// Update package indexes
+	m.logger.Debug("Updating apk package indexes")
+	updateCmd := exec.Command("apk", "update", "--quiet")
+	if err := updateCmd.Run(); err != nil {
+		m.logger.WithError(err).Warn("Failed to update apk package indexes")
+	}
+
+	// Get installed packages straight from the installed database
+	m.logger.Debug("Getting installed packages...")
+	var installedPackages map[string]string
+	installedData, err := os.ReadFile(m.installedDBPath)
+	if err != nil {
+		m.logger.WithError(err).Warn("Failed to read apk installed database")
+		installedPackages = make(map[string]string)
+	} else {
+		m.logger.Debug("Parsing installed packages...")
+		installedPackages = m.parseInstalledDatabase(string(installedData))
+		m.logger.WithField("count", len(installedPackages)).Debug("Found installed packages")
+	}
+
+	// Get upgradable packages
+	m.logger.Debug("Getting upgradable packages...")
+	versionCmd := exec.Command("apk", "version", "-l", "<")
+	versionOutput, err := versionCmd.Output()
+	var upgradablePackages []models.Package
+	if err != nil {
+		m.logger.WithError(err).Warn("Failed to get apk version output")
+		upgradablePackages = []models.Package{}
+	} else {
+		m.logger.Debug("Parsing apk version output...")
+		upgradablePackages = m.parseUpgradablePackages(string(versionOutput))
+		m.logger.WithField("count", len(upgradablePackages)).Debug("Found upgradable packages")
+	}
+
+	// Merge and deduplicate packages
+	packages := CombinePackageData(installedPackages, upgradablePackages, pkgversion.SchemeNone)
+	m.logger.WithField("total", len(packages)).Debug("Total packages collected")
+
+	return packages
+}
+
+// parseInstalledDatabase parses /lib/apk/db/installed and returns a map of package name to version.
+// Each package is a block of single-letter "K:value" lines separated by a blank line.
+func (m *APKManager) parseInstalledDatabase(content string) map[string]string {
+	installedPackages := make(map[string]string)
+	var name, version string
+
+	flush := func() {
+		if name != "" && version != "" {
+			installedPackages[name] = version
+		}
+		name, version = "", ""
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+
+		switch key {
+		case "P":
+			name = value
+		case "V":
+			version = value
+		}
+	}
+	flush()
+
+	return installedPackages
+}
+
+// parseUpgradablePackages parses apk version -l '<' output
+func (m *APKManager) parseUpgradablePackages(output string) []models.Package {
+	var packages []models.Package
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		// Skip the header and any index/status lines
+		if line == "" || strings.HasPrefix(line, "Installed:") || strings.HasPrefix(line, "WARNING") {
+			continue
+		}
+
+		// Parse the line: name-version < available_version
+		fields := slices.Collect(strings.FieldsSeq(line))
+		if len(fields) < 3 || fields[1] != "<" {
+			m.logger.WithField("line", line).Debug("Skipping malformed apk version line")
+			continue
+		}
+
+		packageName, currentVersion := m.splitNameVersion(fields[0])
+		if packageName == "" {
+			m.logger.WithField("line", line).Debug("Could not split package name and version")
+			continue
+		}
+
+		packages = append(packages, models.Package{
+			Name:             packageName,
+			CurrentVersion:   currentVersion,
+			AvailableVersion: fields[2],
+			NeedsUpdate:      true,
+			IsSecurityUpdate: false,
+		})
+	}
+
+	return packages
+}
+
+// splitNameVersion splits an apk "name-version-rN" string. Package names may
+// contain hyphens but versions never do apart from the -rN release suffix, so
+// the version is the last two hyphen-separated parts.
+func (m *APKManager) splitNameVersion(nameVersion string) (string, string) {
+	releaseIdx := strings.LastIndex(nameVersion, "-")
+	if releaseIdx <= 0 {
+		return "", ""
+	}
+	versionIdx := strings.LastIndex(nameVersion[:releaseIdx], "-")
+	if versionIdx <= 0 {
+		return "", ""
+	}
+
+	return nameVersion[:versionIdx], nameVersion[versionIdx+1:]
+}
@@ -0,0 +1,57 @@
+package packages
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPKManager_parseInstalledDatabase(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewAPKManager(logger)
+
+	input := `C:Q1Gm3q7OCCVCn0SRsHcPcjnDGXjUQ=
+P:musl
+V:1.2.4_git20230717-r4
+A:x86_64
+S:407608
+o:musl
+F:lib
+R:ld-musl-x86_64.so.1
+
+C:Q1i2Z9vJj/y2PV8=
+P:ca-certificates-bundle
+V:20240226-r0
+A:x86_64
+o:ca-certificates
+`
+
+	expected := map[string]string{
+		"musl":                   "1.2.4_git20230717-r4",
+		"ca-certificates-bundle": "20240226-r0",
+	}
+	assert.Equal(t, expected, manager.parseInstalledDatabase(input))
+}
+
+func TestAPKManager_parseUpgradablePackages(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewAPKManager(logger)
+
+	input := `Installed:                                Available:
+busybox-1.36.1-r15                      < 1.36.1-r19
+ca-certificates-bundle-20240226-r0      < 20240705-r0
+`
+
+	result := manager.parseUpgradablePackages(input)
+	require.Len(t, result, 2)
+	assert.Equal(t, "busybox", result[0].Name)
+	assert.Equal(t, "1.36.1-r15", result[0].CurrentVersion)
+	assert.Equal(t, "1.36.1-r19", result[0].AvailableVersion)
+	assert.Equal(t, "ca-certificates-bundle", result[1].Name)
+	assert.Equal(t, "20240226-r0", result[1].CurrentVersion)
+	assert.True(t, result[1].NeedsUpdate)
+}
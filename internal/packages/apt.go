@@ -6,6 +6,8 @@ import (
 	"slices"
 	"strings"
 
+	"patchmon-agent/internal/constants"
+	"patchmon-agent/internal/pkgversion"
 	"patchmon-agent/pkg/models"
 
 	"github.com/sirupsen/logrus"
@@ -14,12 +16,14 @@ import (
 // APTManager handles APT package information collection
 type APTManager struct {
 	logger *logrus.Logger
+	root   string // Filesystem root the dpkg database is read from
 }
 
 // NewAPTManager creates a new APT package manager
 func NewAPTManager(logger *logrus.Logger) *APTManager {
 	return &APTManager{
 		logger: logger,
+		root:   "/",
 	}
 }
 
@@ -48,20 +52,12 @@ func (m *APTManager) GetPackages() []models.Package {
 
 	// Get installed packages
 	m.logger.Debug("Getting installed packages...")
-	installedCmd := exec.Command("dpkg-query", "-W", "-f", "${Package} ${Version}\n")
-	installedOutput, err := installedCmd.Output()
-	var installedPackages map[string]string
-	if err != nil {
-		m.logger.WithError(err).Warn("Failed to get installed packages")
-		installedPackages = make(map[string]string)
-	} else {
-		m.logger.Debug("Parsing installed packages...")
-		installedPackages = m.parseInstalledPackages(string(installedOutput))
-		m.logger.WithField("count", len(installedPackages)).Debug("Found installed packages")
-	}
+	installedPackages := m.getInstalledPackages()
+	m.logger.WithField("count", len(installedPackages)).Debug("Found installed packages")
 
 	// Get upgradable packages using apt simulation
 	m.logger.Debug("Getting upgradable packages...")
+	releases := m.readAptReleases()
 	upgradeCmd := exec.Command(packageManager, "-s", "-o", "Debug::NoLocking=1", "upgrade")
 
 	upgradeOutput, err := upgradeCmd.Output()
@@ -71,18 +67,94 @@ func (m *APTManager) GetPackages() []models.Package {
 		upgradablePackages = []models.Package{}
 	} else {
 		m.logger.Debug("Parsing apt upgrade simulation output...")
-		upgradablePackages = m.parseAPTUpgrade(string(upgradeOutput))
+		upgradablePackages = m.parseAPTUpgrade(string(upgradeOutput), releases)
 		m.logger.WithField("count", len(upgradablePackages)).Debug("Found upgradable packages")
 	}
 
+	// Updates that only dist-upgrade would install are kept back by upgrade
+	distUpgradeCmd := exec.Command(packageManager, "-s", "-o", "Debug::NoLocking=1", "dist-upgrade")
+	distUpgradeOutput, err := distUpgradeCmd.Output()
+	if err != nil {
+		m.logger.WithError(err).Warn("Failed to get dist-upgrade simulation")
+	} else {
+		keptBack := m.findKeptBack(upgradablePackages, m.parseAPTUpgrade(string(distUpgradeOutput), releases))
+		m.logger.WithField("count", len(keptBack)).Debug("Found kept back packages")
+		upgradablePackages = append(upgradablePackages, keptBack...)
+	}
+
+	// Held packages are skipped by both simulations; look up their candidates
+	if held := m.heldPackages(installedPackages); len(held) > 0 {
+		m.logger.WithField("count", len(held)).Debug("Getting candidates for held packages...")
+		policyCmd := exec.Command("apt-cache", append([]string{"policy"}, held...)...)
+		policyOutput, err := policyCmd.Output()
+		if err != nil {
+			m.logger.WithError(err).Warn("Failed to get candidates for held packages")
+		} else {
+			upgradablePackages = append(upgradablePackages, m.parseHeldCandidates(string(policyOutput))...)
+		}
+	}
+
 	// Merge and deduplicate packages
-	packages := CombinePackageData(installedPackages, upgradablePackages)
+	packages := CombinePackageDetails(installedPackages, upgradablePackages, pkgversion.SchemeDpkg)
 
 	return packages
 }
 
-// parseAPTUpgrade parses apt/apt-get upgrade simulation output
-func (m *APTManager) parseAPTUpgrade(output string) []models.Package {
+// getInstalledPackages reads installed packages from the dpkg status database,
+// falling back to dpkg-query if the database cannot be read directly
+func (m *APTManager) getInstalledPackages() map[string]models.Package {
+	db, err := ReadDpkgStatus(m.root)
+	if err == nil {
+		return m.buildInstalledPackages(db)
+	}
+	m.logger.WithError(err).Warn("Failed to read dpkg status database, falling back to dpkg-query")
+
+	installedCmd := exec.Command("dpkg-query", "-W", "-f", "${Package} ${Version}\n")
+	installedOutput, err := installedCmd.Output()
+	if err != nil {
+		m.logger.WithError(err).Warn("Failed to get installed packages")
+		return make(map[string]models.Package)
+	}
+
+	m.logger.Debug("Parsing installed packages...")
+	installedPackages := make(map[string]models.Package)
+	for name, version := range m.parseInstalledPackages(string(installedOutput)) {
+		installedPackages[name] = models.Package{Name: name, CurrentVersion: version}
+	}
+	return installedPackages
+}
+
+// buildInstalledPackages converts dpkg status records into packages keyed by
+// name+arch, skipping packages dpkg only remembers as not-installed
+func (m *APTManager) buildInstalledPackages(db *DpkgDatabase) map[string]models.Package {
+	installedPackages := make(map[string]models.Package)
+
+	for _, record := range db.Packages {
+		if record.State == DpkgStateNotInstalled || record.State == "" {
+			continue
+		}
+
+		key := record.Key(db.NativeArch)
+		pkg := models.Package{
+			Name:           key,
+			CurrentVersion: record.Version,
+			Architecture:   record.Architecture,
+			SourcePackage:  record.Source,
+			InstalledSize:  record.InstalledSize,
+			InstallState:   record.State,
+		}
+		if record.Want == DpkgWantHold {
+			pkg.HoldState = constants.HoldStateHeld
+		}
+		installedPackages[key] = pkg
+	}
+
+	return installedPackages
+}
+
+// parseAPTUpgrade parses apt/apt-get upgrade simulation output, classifying
+// security updates by the releases their candidate versions come from
+func (m *APTManager) parseAPTUpgrade(output string, releases []aptRelease) []models.Package {
 	var packages []models.Package
 
 	scanner := bufio.NewScanner(strings.NewReader(output))
@@ -103,39 +175,21 @@ func (m *APTManager) parseAPTUpgrade(output string) []models.Package {
 
 		packageName := fields[1]
 
-		// Extract current version (in brackets)
-		var currentVersion string
-		for i, field := range fields {
-			if strings.HasPrefix(field, "[") && strings.HasSuffix(field, "]") {
-				currentVersion = strings.Trim(field, "[]")
-				break
-			} else if after, found := strings.CutPrefix(field, "["); found {
-				// Multi-word version, continue until we find the closing bracket
-				versionParts := []string{after}
-				for j := i + 1; j < len(fields); j++ {
-					if strings.HasSuffix(fields[j], "]") {
-						versionParts = append(versionParts, strings.TrimSuffix(fields[j], "]"))
-						break
-					} else {
-						versionParts = append(versionParts, fields[j])
-					}
-				}
-				currentVersion = strings.Join(versionParts, " ")
-				break
+		// Extract current version (in brackets) and available version with its
+		// origins (in parentheses). New installs have no current version. A
+		// trailing [...] lists packages the install would break.
+		var currentVersion, availableVersion, candidateOrigins string
+		if start, end := strings.Index(line, " ("), strings.LastIndex(line, ")"); start >= 0 && end > start {
+			head := line[:start]
+			if openIdx, closeIdx := strings.Index(head, "["), strings.LastIndex(head, "]"); openIdx >= 0 && closeIdx > openIdx {
+				currentVersion = head[openIdx+1 : closeIdx]
 			}
+			candidate := line[start+2 : end]
+			availableVersion, candidateOrigins, _ = strings.Cut(candidate, " ")
 		}
 
-		// Extract available version (in parentheses)
-		var availableVersion string
-		for _, field := range fields {
-			if after, found := strings.CutPrefix(field, "("); found {
-				availableVersion = after
-				break
-			}
-		}
-
-		// Check if it's a security update
-		isSecurityUpdate := strings.Contains(strings.ToLower(line), "security")
+		// Classify by the release origins the candidate version comes from
+		origin, isSecurityUpdate := classifyAptOrigins(parseCandidateOrigins(candidateOrigins), releases)
 
 		if packageName != "" && currentVersion != "" && availableVersion != "" {
 			packages = append(packages, models.Package{
@@ -144,6 +198,78 @@ func (m *APTManager) parseAPTUpgrade(output string) []models.Package {
 				AvailableVersion: availableVersion,
 				NeedsUpdate:      true,
 				IsSecurityUpdate: isSecurityUpdate,
+				Origin:           origin.String(),
+			})
+		}
+	}
+
+	return packages
+}
+
+// findKeptBack returns the dist-upgrade updates that upgrade does not
+// install, marked as kept back
+func (m *APTManager) findKeptBack(upgradable, distUpgradable []models.Package) []models.Package {
+	upgradableNames := make(map[string]bool, len(upgradable))
+	for _, pkg := range upgradable {
+		upgradableNames[pkg.Name] = true
+	}
+
+	var keptBack []models.Package
+	for _, pkg := range distUpgradable {
+		if upgradableNames[pkg.Name] {
+			continue
+		}
+		pkg.HoldState = constants.HoldStateKeptBack
+		keptBack = append(keptBack, pkg)
+	}
+
+	return keptBack
+}
+
+// heldPackages returns the sorted names of installed packages on hold
+func (m *APTManager) heldPackages(installedPackages map[string]models.Package) []string {
+	var held []string
+	for name, pkg := range installedPackages {
+		if pkg.HoldState == constants.HoldStateHeld {
+			held = append(held, name)
+		}
+	}
+	slices.Sort(held)
+	return held
+}
+
+// parseHeldCandidates parses apt-cache policy output for held packages and
+// returns those with a newer candidate version:
+//
+//	openssl:
+//	  Installed: 3.0.2-0ubuntu1.10
+//	  Candidate: 3.0.2-0ubuntu1.12
+func (m *APTManager) parseHeldCandidates(output string) []models.Package {
+	var packages []models.Package
+
+	var name, installed string
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case line != "" && line[0] != ' ' && strings.HasSuffix(line, ":"):
+			name = strings.TrimSuffix(line, ":")
+			installed = ""
+		case strings.HasPrefix(trimmed, "Installed:"):
+			installed = strings.TrimSpace(strings.TrimPrefix(trimmed, "Installed:"))
+		case strings.HasPrefix(trimmed, "Candidate:"):
+			candidate := strings.TrimSpace(strings.TrimPrefix(trimmed, "Candidate:"))
+			if name == "" || installed == "" || installed == "(none)" || candidate == "(none)" || candidate == installed {
+				continue
+			}
+			packages = append(packages, models.Package{
+				Name:             name,
+				CurrentVersion:   installed,
+				AvailableVersion: candidate,
+				NeedsUpdate:      true,
+				HoldState:        constants.HoldStateHeld,
 			})
 		}
 	}
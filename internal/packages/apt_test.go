@@ -7,6 +7,7 @@ import (
 
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestAPTManager_parseInstalledPackages(t *testing.T) {
@@ -59,6 +60,12 @@ func TestAPTManager_parseAPTUpgrade(t *testing.T) {
 	logger.SetLevel(logrus.ErrorLevel)
 	manager := NewAPTManager(logger)
 
+	releases := []aptRelease{
+		{Origin: "Ubuntu", Label: "Ubuntu", Suite: "jammy-updates", Codename: "jammy", Version: "22.04"},
+		{Origin: "Ubuntu", Label: "Ubuntu", Suite: "jammy-security", Codename: "jammy", Version: "22.04"},
+		{Origin: "Debian", Label: "Debian-Security", Suite: "stable-security", Codename: "bookworm-security", Version: "12"},
+	}
+
 	tests := []struct {
 		name     string
 		input    string
@@ -74,6 +81,49 @@ func TestAPTManager_parseAPTUpgrade(t *testing.T) {
 					AvailableVersion: "2:8.2.3995-1ubuntu2.17",
 					NeedsUpdate:      true,
 					IsSecurityUpdate: false,
+					Origin:           "o=Ubuntu,a=jammy-updates,n=jammy,l=Ubuntu",
+				},
+			},
+		},
+		{
+			name:  "security pocket among several origins",
+			input: `Inst openssl [3.0.2-0ubuntu1.10] (3.0.2-0ubuntu1.12 Ubuntu:22.04/jammy-updates, Ubuntu:22.04/jammy-security [amd64])`,
+			expected: []models.Package{
+				{
+					Name:             "openssl",
+					CurrentVersion:   "3.0.2-0ubuntu1.10",
+					AvailableVersion: "3.0.2-0ubuntu1.12",
+					NeedsUpdate:      true,
+					IsSecurityUpdate: true,
+					Origin:           "o=Ubuntu,a=jammy-security,n=jammy,l=Ubuntu",
+				},
+			},
+		},
+		{
+			name:  "debian security label with broken packages",
+			input: `Inst libc6 [2.36-9+deb12u3] (2.36-9+deb12u4 Debian-Security:12/stable-security [amd64]) [libc-bin:amd64 ]`,
+			expected: []models.Package{
+				{
+					Name:             "libc6",
+					CurrentVersion:   "2.36-9+deb12u3",
+					AvailableVersion: "2.36-9+deb12u4",
+					NeedsUpdate:      true,
+					IsSecurityUpdate: true,
+					Origin:           "o=Debian,a=stable-security,n=bookworm-security,l=Debian-Security",
+				},
+			},
+		},
+		{
+			name:  "package name containing security is not a security update",
+			input: `Inst libsecurity-tools [1.0-1] (1.1-1 Ubuntu:22.04/jammy-updates [all])`,
+			expected: []models.Package{
+				{
+					Name:             "libsecurity-tools",
+					CurrentVersion:   "1.0-1",
+					AvailableVersion: "1.1-1",
+					NeedsUpdate:      true,
+					IsSecurityUpdate: false,
+					Origin:           "o=Ubuntu,a=jammy-updates,n=jammy,l=Ubuntu",
 				},
 			},
 		},
@@ -81,8 +131,68 @@ func TestAPTManager_parseAPTUpgrade(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := manager.parseAPTUpgrade(tt.input)
-			assert.Equal(t, len(tt.expected), len(result))
+			result := manager.parseAPTUpgrade(tt.input, releases)
+			assert.Equal(t, tt.expected, result)
 		})
 	}
 }
+
+func TestAPTManager_findKeptBack(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewAPTManager(logger)
+
+	upgradeOutput := `Inst vim [2:8.2.3995-1ubuntu2.16] (2:8.2.3995-1ubuntu2.17 Ubuntu:22.04/jammy-updates [amd64])`
+	distUpgradeOutput := `Inst linux-image-generic [5.15.0.91.88] (5.15.0.92.89 Ubuntu:22.04/jammy-updates [amd64])
+Inst linux-image-5.15.0-92-generic (5.15.0-92.102 Ubuntu:22.04/jammy-updates [amd64])
+Inst vim [2:8.2.3995-1ubuntu2.16] (2:8.2.3995-1ubuntu2.17 Ubuntu:22.04/jammy-updates [amd64])`
+
+	upgradable := manager.parseAPTUpgrade(upgradeOutput, nil)
+	keptBack := manager.findKeptBack(upgradable, manager.parseAPTUpgrade(distUpgradeOutput, nil))
+
+	// Newly installed dependencies have no current version and are not reported
+	require.Len(t, keptBack, 1)
+	assert.Equal(t, "linux-image-generic", keptBack[0].Name)
+	assert.Equal(t, "5.15.0.92.89", keptBack[0].AvailableVersion)
+	assert.Equal(t, "kept-back", keptBack[0].HoldState)
+	assert.True(t, keptBack[0].NeedsUpdate)
+}
+
+func TestAPTManager_parseHeldCandidates(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewAPTManager(logger)
+
+	input := `openssl:
+  Installed: 3.0.2-0ubuntu1.10
+  Candidate: 3.0.2-0ubuntu1.12
+  Version table:
+     3.0.2-0ubuntu1.12 500
+        500 http://archive.ubuntu.com/ubuntu jammy-updates/main amd64 Packages
+ *** 3.0.2-0ubuntu1.10 100
+        100 /var/lib/dpkg/status
+libc6:i386:
+  Installed: 2.35-0ubuntu3.7
+  Candidate: 2.35-0ubuntu3.7
+  Version table:
+ *** 2.35-0ubuntu3.7 500
+        500 http://archive.ubuntu.com/ubuntu jammy-updates/main i386 Packages
+`
+
+	expected := []models.Package{
+		{
+			Name:             "openssl",
+			CurrentVersion:   "3.0.2-0ubuntu1.10",
+			AvailableVersion: "3.0.2-0ubuntu1.12",
+			NeedsUpdate:      true,
+			HoldState:        "held",
+		},
+	}
+
+	assert.Equal(t, expected, manager.parseHeldCandidates(input))
+	assert.Equal(t, []string{"libc6:i386", "openssl"}, manager.heldPackages(map[string]models.Package{
+		"openssl":    {HoldState: "held"},
+		"libc6:i386": {HoldState: "held"},
+		"vim":        {},
+	}))
+}
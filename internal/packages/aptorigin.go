@@ -0,0 +1,262 @@
+package packages
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// aptSecurityOrigins are the release origins whose updates count as security
+// updates, written in unattended-upgrades' Origins-Pattern syntax. They match
+// on Release file metadata rather than mirror host names, so Debian LTS and
+// Ubuntu ESM mirrors are recognized whatever they are called.
+var aptSecurityOrigins = []string{
+	"origin=Debian,label=Debian-Security",
+	"origin=Debian,codename=*-security",
+	"origin=Ubuntu,archive=*-security",
+	"origin=UbuntuESMApps,archive=*-apps-security",
+	"origin=UbuntuESM,archive=*-infra-security",
+}
+
+// aptRelease is the metadata of a repository's Release/InRelease file
+type aptRelease struct {
+	Origin   string
+	Label    string
+	Suite    string
+	Codename string
+	Version  string
+	Site     string
+}
+
+// String formats the release like unattended-upgrades logs origins
+func (r aptRelease) String() string {
+	if r.Origin == "" && r.Suite == "" {
+		return r.Site
+	}
+	parts := []string{"o=" + r.Origin, "a=" + r.Suite}
+	if r.Codename != "" {
+		parts = append(parts, "n="+r.Codename)
+	}
+	if r.Label != "" {
+		parts = append(parts, "l="+r.Label)
+	}
+	return strings.Join(parts, ",")
+}
+
+// aptOriginPattern is a parsed Origins-Pattern entry mapping a release field
+// to a shell-style glob
+type aptOriginPattern map[string]string
+
+// parseOriginPattern parses "key=value,key=value". Short keys (o, l, a, n)
+// are accepted and expanded.
+func parseOriginPattern(pattern string) aptOriginPattern {
+	aliases := map[string]string{"o": "origin", "l": "label", "a": "archive", "n": "codename", "suite": "archive"}
+
+	result := make(aptOriginPattern)
+	for part := range strings.SplitSeq(pattern, ",") {
+		key, value, found := strings.Cut(part, "=")
+		if !found {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		if alias, ok := aliases[key]; ok {
+			key = alias
+		}
+		result[key] = strings.TrimSpace(value)
+	}
+	return result
+}
+
+// matches reports whether every field of the pattern matches the release.
+// Unknown fields never match, as unattended-upgrades does.
+func (p aptOriginPattern) matches(release aptRelease) bool {
+	for key, pattern := range p {
+		var value string
+		switch key {
+		case "origin":
+			value = release.Origin
+		case "label":
+			value = release.Label
+		case "archive":
+			value = release.Suite
+		case "codename":
+			value = release.Codename
+		case "site":
+			value = release.Site
+		default:
+			return false
+		}
+		if matched, err := path.Match(pattern, value); err != nil || !matched {
+			return false
+		}
+	}
+	return len(p) > 0
+}
+
+// readAptReleases reads the Release and InRelease files apt has downloaded.
+// The site is taken from the list file name, e.g. security.ubuntu.com for
+// security.ubuntu.com_ubuntu_dists_jammy-security_InRelease.
+func (m *APTManager) readAptReleases() []aptRelease {
+	listsDir := filepath.Join(m.root, "var/lib/apt/lists")
+
+	entries, err := os.ReadDir(listsDir)
+	if err != nil {
+		m.logger.WithError(err).Warn("Failed to read apt lists directory")
+		return nil
+	}
+
+	var releases []aptRelease
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || (!strings.HasSuffix(name, "_InRelease") && !strings.HasSuffix(name, "_Release")) {
+			continue
+		}
+
+		content, err := os.ReadFile(filepath.Join(listsDir, name))
+		if err != nil {
+			m.logger.WithError(err).WithField("file", name).Debug("Failed to read release file")
+			continue
+		}
+
+		release := parseReleaseFile(string(content))
+		release.Site, _, _ = strings.Cut(name, "_")
+		releases = append(releases, release)
+	}
+
+	return releases
+}
+
+// parseReleaseFile reads the fields of interest from a Release file, or from
+// the signed part of an InRelease file
+func parseReleaseFile(content string) aptRelease {
+	var release aptRelease
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	signed := false
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if line == "-----BEGIN PGP SIGNED MESSAGE-----" {
+			signed = true
+			continue
+		}
+		if signed {
+			// Armor headers (Hash: ...) end at the first blank line
+			if line == "" {
+				signed = false
+			}
+			continue
+		}
+		if line == "-----BEGIN PGP SIGNATURE-----" {
+			break
+		}
+		if line == "" || line[0] == ' ' || line[0] == '\t' {
+			continue
+		}
+
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "Origin":
+			release.Origin = value
+		case "Label":
+			release.Label = value
+		case "Suite":
+			release.Suite = value
+		case "Codename":
+			release.Codename = value
+		case "Version":
+			release.Version = value
+		}
+	}
+
+	return release
+}
+
+// parseCandidateOrigins parses the release list apt prints for a candidate
+// version in simulation output, e.g.
+// "Ubuntu:22.04/jammy-updates, Ubuntu:22.04/jammy-security [amd64]". Each
+// entry is [Label:][Version/]Archive, or a site name for repositories without
+// a Release file.
+func parseCandidateOrigins(value string) []aptRelease {
+	value = strings.TrimSpace(value)
+	if idx := strings.LastIndex(value, " ["); idx >= 0 && strings.HasSuffix(value, "]") {
+		value = value[:idx]
+	}
+
+	var origins []aptRelease
+	for entry := range strings.SplitSeq(value, ", ") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		var origin aptRelease
+		rest := entry
+		if idx := strings.LastIndex(rest, "/"); idx >= 0 {
+			origin.Suite = rest[idx+1:]
+			rest = rest[:idx]
+			if label, version, found := strings.Cut(rest, ":"); found {
+				origin.Label, origin.Version = label, version
+			} else {
+				origin.Version = rest
+			}
+		} else if label, archive, found := strings.Cut(rest, ":"); found {
+			origin.Label, origin.Suite = label, archive
+		} else {
+			// Either a bare archive or the site of a flat repository
+			origin.Suite, origin.Site = rest, rest
+		}
+
+		origins = append(origins, origin)
+	}
+
+	return origins
+}
+
+// resolveOrigin completes a candidate origin from the matching Release file
+func resolveOrigin(candidate aptRelease, releases []aptRelease) aptRelease {
+	if candidate.Suite == "" {
+		return candidate
+	}
+	for _, release := range releases {
+		if release.Suite != candidate.Suite || release.Label != candidate.Label {
+			continue
+		}
+		if candidate.Version != "" && release.Version != candidate.Version {
+			continue
+		}
+		return release
+	}
+	return candidate
+}
+
+// classifyAptOrigins returns the origin that makes an update a security
+// update, or the first candidate origin and false if none does
+func classifyAptOrigins(candidates []aptRelease, releases []aptRelease) (aptRelease, bool) {
+	patterns := make([]aptOriginPattern, 0, len(aptSecurityOrigins))
+	for _, pattern := range aptSecurityOrigins {
+		patterns = append(patterns, parseOriginPattern(pattern))
+	}
+
+	var first aptRelease
+	for i, candidate := range candidates {
+		resolved := resolveOrigin(candidate, releases)
+		if i == 0 {
+			first = resolved
+		}
+		for _, pattern := range patterns {
+			if pattern.matches(resolved) {
+				return resolved, true
+			}
+		}
+	}
+
+	return first, false
+}
@@ -0,0 +1,184 @@
+package packages
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseReleaseFile(t *testing.T) {
+	t.Run("InRelease", func(t *testing.T) {
+		input := `-----BEGIN PGP SIGNED MESSAGE-----
+Hash: SHA512
+
+Origin: Debian
+Label: Debian-Security
+Suite: stable-security
+Version: 12
+Codename: bookworm-security
+Date: Tue, 03 Oct 2023 16:42:11 UTC
+Components: updates/main updates/contrib updates/non-free updates/non-free-firmware
+Description: Debian 12 - Security Updates
+SHA256:
+ 0a1b2c3d 1234 main/binary-amd64/Packages
+-----BEGIN PGP SIGNATURE-----
+
+iQIzBAEBCgAdFiEE
+-----END PGP SIGNATURE-----`
+
+		assert.Equal(t, aptRelease{
+			Origin:   "Debian",
+			Label:    "Debian-Security",
+			Suite:    "stable-security",
+			Codename: "bookworm-security",
+			Version:  "12",
+		}, parseReleaseFile(input))
+	})
+
+	t.Run("Release", func(t *testing.T) {
+		input := `Origin: UbuntuESMApps
+Label: UbuntuESMApps
+Suite: jammy-apps-security
+Codename: jammy`
+
+		assert.Equal(t, aptRelease{
+			Origin:   "UbuntuESMApps",
+			Label:    "UbuntuESMApps",
+			Suite:    "jammy-apps-security",
+			Codename: "jammy",
+		}, parseReleaseFile(input))
+	})
+}
+
+func TestParseCandidateOrigins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []aptRelease
+	}{
+		{
+			input: "Ubuntu:22.04/jammy-updates, Ubuntu:22.04/jammy-security [amd64]",
+			expected: []aptRelease{
+				{Label: "Ubuntu", Version: "22.04", Suite: "jammy-updates"},
+				{Label: "Ubuntu", Version: "22.04", Suite: "jammy-security"},
+			},
+		},
+		{
+			input:    "Debian-Security:12/stable-security [amd64]",
+			expected: []aptRelease{{Label: "Debian-Security", Version: "12", Suite: "stable-security"}},
+		},
+		{
+			input:    "stable [all]",
+			expected: []aptRelease{{Suite: "stable", Site: "stable"}},
+		},
+		{
+			input:    "Docker CE:jammy [amd64]",
+			expected: []aptRelease{{Label: "Docker CE", Suite: "jammy"}},
+		},
+		{
+			input:    "",
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			assert.Equal(t, tt.expected, parseCandidateOrigins(tt.input))
+		})
+	}
+}
+
+func TestClassifyAptOrigins(t *testing.T) {
+	releases := []aptRelease{
+		{Origin: "Ubuntu", Label: "Ubuntu", Suite: "jammy-updates", Codename: "jammy", Version: "22.04"},
+		{Origin: "UbuntuESMApps", Label: "UbuntuESMApps", Suite: "jammy-apps-security", Codename: "jammy"},
+		{Origin: "UbuntuESM", Label: "UbuntuESM", Suite: "jammy-infra-updates", Codename: "jammy"},
+		// Debian LTS served from a mirror with a custom name keeps its metadata
+		{Origin: "Debian", Label: "Debian-Security", Suite: "oldoldstable-security", Codename: "buster-security", Version: "10", Site: "lts.mirror.example.com"},
+		{Origin: "Debian", Label: "Debian", Suite: "stable-updates", Codename: "bookworm-updates", Version: "12"},
+	}
+
+	tests := []struct {
+		name       string
+		candidates []aptRelease
+		security   bool
+		origin     string
+	}{
+		{
+			name:       "ubuntu esm apps",
+			candidates: []aptRelease{{Label: "UbuntuESMApps", Suite: "jammy-apps-security"}},
+			security:   true,
+			origin:     "o=UbuntuESMApps,a=jammy-apps-security,n=jammy,l=UbuntuESMApps",
+		},
+		{
+			name:       "ubuntu esm infra updates",
+			candidates: []aptRelease{{Label: "UbuntuESM", Suite: "jammy-infra-updates"}},
+			security:   false,
+			origin:     "o=UbuntuESM,a=jammy-infra-updates,n=jammy,l=UbuntuESM",
+		},
+		{
+			name:       "debian lts mirror",
+			candidates: []aptRelease{{Label: "Debian-Security", Version: "10", Suite: "oldoldstable-security"}},
+			security:   true,
+			origin:     "o=Debian,a=oldoldstable-security,n=buster-security,l=Debian-Security",
+		},
+		{
+			name:       "debian stable updates",
+			candidates: []aptRelease{{Label: "Debian", Version: "12", Suite: "stable-updates"}},
+			security:   false,
+			origin:     "o=Debian,a=stable-updates,n=bookworm-updates,l=Debian",
+		},
+		{
+			name:       "unknown release",
+			candidates: []aptRelease{{Label: "Example", Suite: "example-security"}},
+			security:   false,
+			origin:     "o=,a=example-security,l=Example",
+		},
+		{
+			name:       "no candidates",
+			candidates: nil,
+			security:   false,
+			origin:     "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			origin, security := classifyAptOrigins(tt.candidates, releases)
+			assert.Equal(t, tt.security, security)
+			assert.Equal(t, tt.origin, origin.String())
+		})
+	}
+}
+
+func TestAptOriginPattern_matches(t *testing.T) {
+	release := aptRelease{Origin: "Ubuntu", Label: "Ubuntu", Suite: "jammy-security", Codename: "jammy", Site: "security.ubuntu.com"}
+
+	assert.True(t, parseOriginPattern("o=Ubuntu,a=*-security").matches(release))
+	assert.True(t, parseOriginPattern("origin=Ubuntu,codename=jammy,site=security.ubuntu.com").matches(release))
+	assert.False(t, parseOriginPattern("origin=Debian,archive=*-security").matches(release))
+	assert.False(t, parseOriginPattern("origin=Ubuntu,component=main").matches(release))
+	assert.False(t, parseOriginPattern("").matches(release))
+}
+
+func TestAPTManager_readAptReleases(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewAPTManager(logger)
+	manager.root = t.TempDir()
+
+	listsDir := filepath.Join(manager.root, "var/lib/apt/lists")
+	require.NoError(t, os.MkdirAll(filepath.Join(listsDir, "partial"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(listsDir, "security.ubuntu.com_ubuntu_dists_jammy-security_InRelease"),
+		[]byte("Origin: Ubuntu\nLabel: Ubuntu\nSuite: jammy-security\nCodename: jammy\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(listsDir, "security.ubuntu.com_ubuntu_dists_jammy-security_main_binary-amd64_Packages"),
+		[]byte("Package: openssl\n"), 0o644))
+
+	releases := manager.readAptReleases()
+	assert.Equal(t, []aptRelease{
+		{Origin: "Ubuntu", Label: "Ubuntu", Suite: "jammy-security", Codename: "jammy", Site: "security.ubuntu.com"},
+	}, releases)
+}
@@ -6,6 +6,9 @@ import (
 	"slices"
 	"strings"
 
+	"patchmon-agent/internal/constants"
+	"patchmon-agent/internal/pkgversion"
+	"patchmon-agent/internal/rpmdb"
 	"patchmon-agent/pkg/models"
 
 	"github.com/sirupsen/logrus"
@@ -14,12 +17,14 @@ import (
 // DNFManager handles dnf/yum package information collection
 type DNFManager struct {
 	logger *logrus.Logger
+	root   string // Filesystem root the rpm database is read from
 }
 
 // NewDNFManager creates a new DNF package manager
 func NewDNFManager(logger *logrus.Logger) *DNFManager {
 	return &DNFManager{
 		logger: logger,
+		root:   "/",
 	}
 }
 
@@ -43,16 +48,13 @@ func (m *DNFManager) GetPackages() []models.Package {
 
 	// Get installed packages
 	m.logger.Debug("Getting installed packages...")
-	listCmd := exec.Command(packageManager, "list", "installed")
-	listOutput, err := listCmd.Output()
-	var installedPackages map[string]string
-	if err != nil {
-		m.logger.WithError(err).Warn("Failed to get installed packages")
-		installedPackages = make(map[string]string)
-	} else {
-		m.logger.Debug("Parsing installed packages...")
-		installedPackages = m.parseInstalledPackages(string(listOutput))
-		m.logger.WithField("count", len(installedPackages)).Debug("Found installed packages")
+	installedPackages := m.getInstalledPackages(packageManager)
+	m.logger.WithField("count", len(installedPackages)).Debug("Found installed packages")
+
+	// Mark version-locked packages; check-update hides their updates
+	if locked := m.getVersionLocks(packageManager); len(locked) > 0 {
+		m.logger.WithField("count", len(locked)).Debug("Found version locks")
+		m.markVersionLocked(installedPackages, locked)
 	}
 
 	// Get upgradable packages
@@ -63,7 +65,7 @@ func (m *DNFManager) GetPackages() []models.Package {
 	var upgradablePackages []models.Package
 	if len(checkOutput) > 0 {
 		m.logger.Debug("Parsing DNF/yum check-update output...")
-		upgradablePackages = m.parseUpgradablePackages(string(checkOutput), packageManager)
+		upgradablePackages = m.parseUpgradablePackages(string(checkOutput), installedPackages)
 		m.logger.WithField("count", len(upgradablePackages)).Debug("Found upgradable packages")
 	} else {
 		m.logger.Debug("No updates available")
@@ -71,14 +73,151 @@ func (m *DNFManager) GetPackages() []models.Package {
 	}
 
 	// Merge and deduplicate packages
-	packages := CombinePackageData(installedPackages, upgradablePackages)
+	packages := CombinePackageDetails(installedPackages, upgradablePackages, pkgversion.SchemeRPM)
+
+	// Attach advisory details from the repositories' updateinfo metadata
+	if len(upgradablePackages) > 0 {
+		m.logger.Debug("Getting update advisories...")
+		advisories, cves := m.getAdvisories(packageManager)
+		m.logger.WithFields(logrus.Fields{
+			"advisories": len(advisories),
+			"cves":       len(cves),
+		}).Debug("Found update advisories")
+		m.applyAdvisories(packages, advisories, cves)
+	}
 	m.logger.WithField("total", len(packages)).Debug("Total packages collected")
 
 	return packages
 }
 
-// parseUpgradablePackages parses dnf/yum check-update output
-func (m *DNFManager) parseUpgradablePackages(output string, packageManager string) []models.Package {
+// getInstalledPackages reads installed packages from the rpm database,
+// falling back to dnf/yum list installed if the database cannot be read directly
+func (m *DNFManager) getInstalledPackages(packageManager string) map[string]models.Package {
+	rpmPackages, err := rpmdb.Read(m.root)
+	if err == nil {
+		return m.buildInstalledPackages(rpmPackages)
+	}
+	m.logger.WithError(err).WithField("manager", packageManager).Warn("Failed to read rpm database, falling back to list installed")
+
+	listCmd := exec.Command(packageManager, "list", "installed")
+	listOutput, err := listCmd.Output()
+	if err != nil {
+		m.logger.WithError(err).Warn("Failed to get installed packages")
+		return make(map[string]models.Package)
+	}
+
+	m.logger.Debug("Parsing installed packages...")
+	installedPackages := make(map[string]models.Package)
+	for name, version := range m.parseInstalledPackages(string(listOutput)) {
+		installedPackages[name] = models.Package{Name: name, CurrentVersion: version}
+	}
+	return installedPackages
+}
+
+// buildInstalledPackages converts rpm database records into packages keyed by
+// name.arch, matching the names dnf/yum print. When several versions of an
+// install-only package (e.g. kernel) are installed, the highest one wins.
+func (m *DNFManager) buildInstalledPackages(rpmPackages []rpmdb.Package) map[string]models.Package {
+	installedPackages := make(map[string]models.Package, len(rpmPackages))
+
+	for _, record := range rpmPackages {
+		key := record.Name
+		if record.Arch != "" {
+			key += "." + record.Arch
+		}
+
+		if existing, ok := installedPackages[key]; ok && pkgversion.CompareRPM(existing.CurrentVersion, record.EVR()) > 0 {
+			continue
+		}
+
+		installedPackages[key] = models.Package{
+			Name:           key,
+			CurrentVersion: record.EVR(),
+			Architecture:   record.Arch,
+			SourcePackage:  record.SourceName(),
+			InstalledSize:  record.Size,
+			InstallState:   "installed",
+		}
+	}
+
+	return installedPackages
+}
+
+// getVersionLocks lists the package names locked with the versionlock plugin
+// (dnf4/yum) or command (dnf5). Hosts without versionlock have no locks.
+func (m *DNFManager) getVersionLocks(packageManager string) map[string]bool {
+	output, err := exec.Command(packageManager, "-q", "versionlock", "list").Output()
+	if err != nil {
+		m.logger.WithError(err).Debug("Failed to list version locks")
+		return nil
+	}
+	return m.parseVersionLocks(string(output))
+}
+
+// parseVersionLocks parses versionlock list output. dnf4 prints one pattern
+// per line (curl-0:7.76.1-26.el9.*), yum puts the epoch first
+// (0:curl-7.29.0-59.el7.*) and dnf5 prints "Package name: curl" records.
+// Exclusions (!pattern) and comments are ignored.
+func (m *DNFManager) parseVersionLocks(output string) map[string]bool {
+	locked := make(map[string]bool)
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") {
+			continue
+		}
+
+		if name, found := strings.CutPrefix(line, "Package name:"); found {
+			if name = strings.TrimSpace(name); name != "" {
+				locked[name] = true
+			}
+			continue
+		}
+		if strings.Contains(line, " ") {
+			// dnf5 record details (evr = ...) and other messages
+			continue
+		}
+
+		nevr := strings.TrimSuffix(strings.TrimSuffix(line, ".*"), "*")
+		relIdx := strings.LastIndex(nevr, "-")
+		if relIdx <= 0 {
+			continue
+		}
+		verIdx := strings.LastIndex(nevr[:relIdx], "-")
+		if verIdx <= 0 {
+			continue
+		}
+		name := nevr[:verIdx]
+		if _, bareName, found := strings.Cut(name, ":"); found {
+			name = bareName
+		}
+		if name != "" {
+			locked[name] = true
+		}
+	}
+
+	return locked
+}
+
+// markVersionLocked sets the hold state of installed packages (keyed by
+// name.arch) whose name is version-locked
+func (m *DNFManager) markVersionLocked(installedPackages map[string]models.Package, locked map[string]bool) {
+	for key, pkg := range installedPackages {
+		name := key
+		if idx := strings.LastIndex(key, "."); idx > 0 {
+			name = key[:idx]
+		}
+		if locked[name] {
+			pkg.HoldState = constants.HoldStateVersionLocked
+			installedPackages[key] = pkg
+		}
+	}
+}
+
+// parseUpgradablePackages parses dnf/yum check-update output, taking current
+// versions from the installed packages
+func (m *DNFManager) parseUpgradablePackages(output string, installedPackages map[string]models.Package) []models.Package {
 	var packages []models.Package
 
 	scanner := bufio.NewScanner(strings.NewReader(output))
@@ -100,20 +239,9 @@ func (m *DNFManager) parseUpgradablePackages(output string, packageManager strin
 		availableVersion := fields[1]
 		repo := fields[2]
 
-		// Get current version
-		getCurrentCmd := exec.Command(packageManager, "list", "installed", packageName)
-		getCurrentOutput, err := getCurrentCmd.Output()
 		var currentVersion string
-		if err == nil {
-			for currentLine := range strings.SplitSeq(string(getCurrentOutput), "\n") {
-				if strings.Contains(currentLine, packageName) && !strings.Contains(currentLine, "Installed") {
-					currentFields := slices.Collect(strings.FieldsSeq(currentLine))
-					if len(currentFields) >= 2 {
-						currentVersion = currentFields[1]
-						break
-					}
-				}
-			}
+		if installed, ok := installedPackages[packageName]; ok {
+			currentVersion = installed.CurrentVersion
 		}
 
 		isSecurityUpdate := strings.Contains(strings.ToLower(repo), "security")
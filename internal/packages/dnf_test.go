@@ -3,6 +3,9 @@ package packages
 import (
 	"testing"
 
+	"patchmon-agent/internal/rpmdb"
+	"patchmon-agent/pkg/models"
+
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 )
@@ -47,25 +50,130 @@ func TestDNFManager_parseUpgradablePackages(t *testing.T) {
 	logger.SetLevel(logrus.ErrorLevel)
 	manager := NewDNFManager(logger)
 
+	installed := map[string]models.Package{
+		"kernel.x86_64":  {Name: "kernel.x86_64", CurrentVersion: "5.14.0-284.25.1.el9_2"},
+		"systemd.x86_64": {Name: "systemd.x86_64", CurrentVersion: "252-14.el9_2.1"},
+	}
+
 	tests := []struct {
 		name     string
 		input    string
-		pkgMgr   string
-		expected int
+		expected []models.Package
 	}{
 		{
 			name: "upgradable packages",
 			input: `kernel.x86_64                     5.14.0-284.30.1.el9_2           baseos
 systemd.x86_64                    252-14.el9_2.2                  baseos`,
-			pkgMgr:   "dnf",
-			expected: 2,
+			expected: []models.Package{
+				{Name: "kernel.x86_64", CurrentVersion: "5.14.0-284.25.1.el9_2", AvailableVersion: "5.14.0-284.30.1.el9_2", NeedsUpdate: true},
+				{Name: "systemd.x86_64", CurrentVersion: "252-14.el9_2.1", AvailableVersion: "252-14.el9_2.2", NeedsUpdate: true},
+			},
+		},
+		{
+			name: "security repo and unknown installed version",
+			input: `Last metadata expiration check: 0:12:01 ago on Mon 02 Oct 2023.
+
+openssl.x86_64                    1:3.0.7-17.el9_2                rhel-9-security`,
+			expected: []models.Package{
+				{Name: "openssl.x86_64", AvailableVersion: "1:3.0.7-17.el9_2", NeedsUpdate: true, IsSecurityUpdate: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := manager.parseUpgradablePackages(tt.input, installed)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestDNFManager_buildInstalledPackages(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewDNFManager(logger)
+
+	epoch := 2
+	result := manager.buildInstalledPackages([]rpmdb.Package{
+		{Name: "vim-enhanced", Epoch: &epoch, Version: "8.2.2637", Release: "20.el9_1", Arch: "x86_64", SourceRPM: "vim-8.2.2637-20.el9_1.src.rpm", Size: 4096},
+		{Name: "kernel", Version: "5.14.0", Release: "284.30.1.el9_2", Arch: "x86_64"},
+		{Name: "kernel", Version: "5.14.0", Release: "284.25.1.el9_2", Arch: "x86_64"},
+		{Name: "tzdata", Version: "2023c", Release: "1.el9", Arch: "noarch"},
+	})
+
+	assert.Len(t, result, 3)
+	assert.Equal(t, models.Package{
+		Name:           "vim-enhanced.x86_64",
+		CurrentVersion: "2:8.2.2637-20.el9_1",
+		Architecture:   "x86_64",
+		SourcePackage:  "vim",
+		InstalledSize:  4096,
+		InstallState:   "installed",
+	}, result["vim-enhanced.x86_64"])
+	assert.Equal(t, "5.14.0-284.30.1.el9_2", result["kernel.x86_64"].CurrentVersion)
+	assert.Equal(t, "2023c-1.el9", result["tzdata.noarch"].CurrentVersion)
+}
+
+func TestDNFManager_parseVersionLocks(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewDNFManager(logger)
+
+	tests := []struct {
+		name     string
+		input    string
+		expected map[string]bool
+	}{
+		{
+			name: "dnf4",
+			input: `curl-0:7.76.1-26.el9.*
+python3-dateutil-1:2.8.1-7.el9.*
+!kernel-0:5.14.0-284.11.1.el9_2.*`,
+			expected: map[string]bool{"curl": true, "python3-dateutil": true},
+		},
+		{
+			name: "yum",
+			input: `0:bash-4.2.46-35.el7_9.*
+# Comment
+`,
+			expected: map[string]bool{"bash": true},
+		},
+		{
+			name: "dnf5",
+			input: `# Added by 'versionlock add' command on 2024-05-02 10:11:12
+Package name: curl
+evr = 8.6.0-7.fc40
+`,
+			expected: map[string]bool{"curl": true},
+		},
+		{
+			name:     "empty",
+			input:    "",
+			expected: map[string]bool{},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := manager.parseUpgradablePackages(tt.input, tt.pkgMgr)
-			assert.Equal(t, tt.expected, len(result))
+			assert.Equal(t, tt.expected, manager.parseVersionLocks(tt.input))
 		})
 	}
 }
+
+func TestDNFManager_markVersionLocked(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewDNFManager(logger)
+
+	installed := map[string]models.Package{
+		"curl.x86_64":       {Name: "curl.x86_64"},
+		"python3.11.x86_64": {Name: "python3.11.x86_64"},
+		"bash.x86_64":       {Name: "bash.x86_64"},
+	}
+
+	manager.markVersionLocked(installed, map[string]bool{"curl": true, "python3.11": true})
+
+	assert.Equal(t, "version-locked", installed["curl.x86_64"].HoldState)
+	assert.Equal(t, "version-locked", installed["python3.11.x86_64"].HoldState)
+	assert.Empty(t, installed["bash.x86_64"].HoldState)
+}
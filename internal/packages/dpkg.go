@@ -0,0 +1,209 @@
+package packages
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// dpkg database locations relative to the filesystem root
+const (
+	dpkgStatusFile    = "var/lib/dpkg/status"
+	dpkgStatusOldFile = "var/lib/dpkg/status-old"
+)
+
+// dpkg install states, as found in the third word of the Status field
+const (
+	DpkgStateInstalled       = "installed"
+	DpkgStateNotInstalled    = "not-installed"
+	DpkgStateConfigFiles     = "config-files"
+	DpkgStateHalfInstalled   = "half-installed"
+	DpkgStateUnpacked        = "unpacked"
+	DpkgStateHalfConfigured  = "half-configured"
+	DpkgStateTriggersAwaited = "triggers-awaited"
+	DpkgStateTriggersPending = "triggers-pending"
+)
+
+// dpkg selection states, as found in the first word of the Status field
+const (
+	DpkgWantInstall   = "install"
+	DpkgWantHold      = "hold"
+	DpkgWantDeinstall = "deinstall"
+	DpkgWantPurge     = "purge"
+)
+
+// DpkgPackage is a single package record from the dpkg status database
+type DpkgPackage struct {
+	Name          string
+	Version       string
+	Architecture  string
+	MultiArch     string
+	Source        string // Source package name, defaults to Name
+	SourceVersion string // Source package version, defaults to Version
+	InstalledSize int64  // In bytes (dpkg records KiB)
+	Want          string // e.g. install, hold, deinstall, purge
+	Flag          string // ok or reinstreq
+	State         string // One of the DpkgState* constants
+}
+
+// Key returns the name+arch identity of the package. Packages of the native
+// architecture or "all" keep their bare name, foreign-architecture packages
+// are qualified as name:arch, matching apt's own output.
+func (p DpkgPackage) Key(nativeArch string) string {
+	if p.Architecture == "" || p.Architecture == "all" || p.Architecture == nativeArch {
+		return p.Name
+	}
+	return p.Name + ":" + p.Architecture
+}
+
+// DpkgDatabase is a parsed dpkg status database
+type DpkgDatabase struct {
+	Packages   []DpkgPackage
+	NativeArch string
+}
+
+// ReadDpkgStatus reads the dpkg status database below root ("/" for the
+// running system), falling back to status-old if status is missing or
+// unreadable, as dpkg itself does after an interrupted write.
+func ReadDpkgStatus(root string) (*DpkgDatabase, error) {
+	var lastErr error
+	for _, name := range []string{dpkgStatusFile, dpkgStatusOldFile} {
+		path := filepath.Join(root, name)
+		file, err := os.Open(path)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		packages, err := parseDpkgStatus(file)
+		_ = file.Close()
+		if err != nil {
+			lastErr = fmt.Errorf("failed to parse %s: %w", path, err)
+			continue
+		}
+
+		return &DpkgDatabase{
+			Packages:   packages,
+			NativeArch: dpkgNativeArch(packages),
+		}, nil
+	}
+
+	if errors.Is(lastErr, fs.ErrNotExist) {
+		return nil, fmt.Errorf("dpkg status database not found below %s", root)
+	}
+	return nil, lastErr
+}
+
+// parseDpkgStatus parses deb822 paragraphs from a dpkg status file
+func parseDpkgStatus(r io.Reader) ([]DpkgPackage, error) {
+	var packages []DpkgPackage
+	fields := make(map[string]string)
+	var lastKey string
+
+	flush := func() {
+		if pkg, ok := newDpkgPackage(fields); ok {
+			packages = append(packages, pkg)
+		}
+		fields = make(map[string]string)
+		lastKey = ""
+	}
+
+	scanner := bufio.NewScanner(r)
+	// Some Description and Conffiles fields are very long
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+
+		// Continuation lines belong to the previous multi-line field
+		if line[0] == ' ' || line[0] == '\t' {
+			if lastKey != "" {
+				fields[lastKey] += "\n" + strings.TrimSpace(line)
+			}
+			continue
+		}
+
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		lastKey = key
+		fields[key] = strings.TrimSpace(value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+
+	return packages, nil
+}
+
+// newDpkgPackage builds a package record from the fields of one paragraph
+func newDpkgPackage(fields map[string]string) (DpkgPackage, bool) {
+	name := fields["Package"]
+	if name == "" {
+		return DpkgPackage{}, false
+	}
+
+	pkg := DpkgPackage{
+		Name:          name,
+		Version:       fields["Version"],
+		Architecture:  fields["Architecture"],
+		MultiArch:     fields["Multi-Arch"],
+		Source:        name,
+		SourceVersion: fields["Version"],
+	}
+
+	// Status: want flag state
+	if status := strings.Fields(fields["Status"]); len(status) == 3 {
+		pkg.Want, pkg.Flag, pkg.State = status[0], status[1], status[2]
+	}
+
+	// Source: name, optionally followed by (version) if it differs
+	if source := fields["Source"]; source != "" {
+		sourceName, sourceVersion, hasVersion := strings.Cut(source, " ")
+		pkg.Source = sourceName
+		if hasVersion {
+			pkg.SourceVersion = strings.Trim(strings.TrimSpace(sourceVersion), "()")
+		}
+	}
+
+	if size, err := strconv.ParseInt(fields["Installed-Size"], 10, 64); err == nil {
+		pkg.InstalledSize = size * 1024
+	}
+
+	return pkg, true
+}
+
+// dpkgNativeArch determines the native dpkg architecture. dpkg itself is
+// always installed for the native architecture, so its record is used when
+// present; otherwise the Go architecture is mapped to the Debian name.
+func dpkgNativeArch(packages []DpkgPackage) string {
+	for _, pkg := range packages {
+		if pkg.Name == "dpkg" && pkg.State == DpkgStateInstalled {
+			return pkg.Architecture
+		}
+	}
+
+	switch runtime.GOARCH {
+	case "386":
+		return "i386"
+	case "arm":
+		return "armhf"
+	case "ppc64le":
+		return "ppc64el"
+	default:
+		return runtime.GOARCH
+	}
+}
@@ -0,0 +1,121 @@
+package packages
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testDpkgStatus = `Package: dpkg
+Status: install ok installed
+Priority: required
+Essential: yes
+Installed-Size: 6733
+Architecture: amd64
+Multi-Arch: foreign
+Version: 1.21.1ubuntu2.3
+Description: Debian package management system
+ This package provides the low-level infrastructure for handling the
+ installation and removal of Debian software packages.
+
+Package: libc6
+Status: install ok installed
+Installed-Size: 13592
+Architecture: amd64
+Multi-Arch: same
+Source: glibc
+Version: 2.35-0ubuntu3.7
+
+Package: libc6
+Status: install ok installed
+Installed-Size: 12876
+Architecture: i386
+Multi-Arch: same
+Source: glibc
+Version: 2.35-0ubuntu3.7
+
+Package: libpython3.10-minimal
+Status: hold ok installed
+Architecture: amd64
+Source: python3.10 (3.10.12-1~22.04.3)
+Version: 3.10.12-1~22.04.3build1
+
+Package: nginx-common
+Status: deinstall ok config-files
+Architecture: all
+Version: 1.18.0-6ubuntu14.4
+
+Package: vim-tiny
+Status: install reinstreq half-installed
+Architecture: amd64
+Version: 2:8.2.3995-1ubuntu2.16
+
+Package: old-removed
+Status: purge ok not-installed
+Architecture: amd64
+`
+
+func TestParseDpkgStatus(t *testing.T) {
+	packages, err := parseDpkgStatus(strings.NewReader(testDpkgStatus))
+	require.NoError(t, err)
+	require.Len(t, packages, 7)
+
+	assert.Equal(t, "dpkg", packages[0].Name)
+	assert.Equal(t, int64(6733*1024), packages[0].InstalledSize)
+	assert.Equal(t, DpkgStateInstalled, packages[0].State)
+
+	assert.Equal(t, "glibc", packages[1].Source)
+	assert.Equal(t, "2.35-0ubuntu3.7", packages[1].SourceVersion)
+
+	assert.Equal(t, "python3.10", packages[3].Source)
+	assert.Equal(t, "3.10.12-1~22.04.3", packages[3].SourceVersion)
+
+	assert.Equal(t, "deinstall", packages[4].Want)
+	assert.Equal(t, DpkgStateConfigFiles, packages[4].State)
+	assert.Equal(t, "reinstreq", packages[5].Flag)
+	assert.Equal(t, DpkgStateHalfInstalled, packages[5].State)
+}
+
+func TestReadDpkgStatus_statusOldFallback(t *testing.T) {
+	root := t.TempDir()
+	dpkgDir := filepath.Join(root, "var", "lib", "dpkg")
+	require.NoError(t, os.MkdirAll(dpkgDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dpkgDir, "status-old"), []byte(testDpkgStatus), 0644))
+
+	db, err := ReadDpkgStatus(root)
+	require.NoError(t, err)
+	assert.Len(t, db.Packages, 7)
+	assert.Equal(t, "amd64", db.NativeArch)
+
+	_, err = ReadDpkgStatus(t.TempDir())
+	assert.Error(t, err)
+}
+
+func TestAPTManager_buildInstalledPackages(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewAPTManager(logger)
+
+	packages, err := parseDpkgStatus(strings.NewReader(testDpkgStatus))
+	require.NoError(t, err)
+
+	result := manager.buildInstalledPackages(&DpkgDatabase{Packages: packages, NativeArch: "amd64"})
+
+	// Multi-arch duplicates are kept apart, not-installed records are dropped
+	require.Len(t, result, 6)
+	assert.Contains(t, result, "libc6")
+	assert.Contains(t, result, "libc6:i386")
+	assert.NotContains(t, result, "old-removed")
+
+	assert.Equal(t, "i386", result["libc6:i386"].Architecture)
+	assert.Equal(t, "glibc", result["libc6:i386"].SourcePackage)
+	assert.Equal(t, DpkgStateConfigFiles, result["nginx-common"].InstallState)
+	assert.Equal(t, "1.18.0-6ubuntu14.4", result["nginx-common"].CurrentVersion)
+	assert.Equal(t, "held", result["libpython3.10-minimal"].HoldState)
+	assert.Empty(t, result["libc6"].HoldState)
+}
@@ -0,0 +1,151 @@
+package packages
+
+import (
+	"bufio"
+	"os/exec"
+	"strings"
+
+	"patchmon-agent/internal/constants"
+	"patchmon-agent/internal/pkgversion"
+	"patchmon-agent/pkg/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// FlatpakManager handles flatpak package information collection for the system installation
+type FlatpakManager struct {
+	logger *logrus.Logger
+}
+
+// flatpakRef is a single row of flatpak list/remote-ls output
+type flatpakRef struct {
+	application string
+	branch      string
+	version     string
+	commit      string
+	runtime     bool
+}
+
+// NewFlatpakManager creates a new flatpak package manager
+func NewFlatpakManager(logger *logrus.Logger) *FlatpakManager {
+	return &FlatpakManager{
+		logger: logger,
+	}
+}
+
+// IsAvailable reports whether flatpak is installed on this system
+func (m *FlatpakManager) IsAvailable() bool {
+	_, err := exec.LookPath("flatpak")
+	return err == nil
+}
+
+// GetPackages gets installed flatpak apps and runtimes and pending updates
+func (m *FlatpakManager) GetPackages() []models.Package {
+	m.logger.Debug("Getting installed flatpaks...")
+	installedPackages := make(map[string]string)
+	listCmd := exec.Command("flatpak", "list", "--system", "--columns=application,branch,version,active,ref")
+	listOutput, err := listCmd.Output()
+	if err != nil {
+		m.logger.WithError(err).Warn("Failed to list installed flatpaks")
+		return []models.Package{}
+	}
+	for _, ref := range m.parseRefs(string(listOutput)) {
+		installedPackages[ref.packageName()] = ref.displayVersion()
+	}
+	m.logger.WithField("count", len(installedPackages)).Debug("Found installed flatpaks")
+
+	m.logger.Debug("Getting flatpak updates...")
+	var upgradablePackages []models.Package
+	updatesCmd := exec.Command("flatpak", "remote-ls", "--system", "--updates", "--columns=application,branch,version,commit,ref")
+	updatesOutput, err := updatesCmd.Output()
+	if err != nil {
+		m.logger.WithError(err).Warn("Failed to get flatpak updates")
+		upgradablePackages = []models.Package{}
+	} else {
+		upgradablePackages = m.parseUpdates(string(updatesOutput), installedPackages)
+		m.logger.WithField("count", len(upgradablePackages)).Debug("Found flatpak updates")
+	}
+
+	packages := CombinePackageData(installedPackages, upgradablePackages, pkgversion.SchemeNone)
+	for i := range packages {
+		packages[i].Source = constants.PackageSourceFlatpak
+	}
+
+	return packages
+}
+
+// parseRefs parses tab-separated flatpak output with the application,
+// branch, version, commit and ref columns
+func (m *FlatpakManager) parseRefs(output string) []flatpakRef {
+	var refs []flatpakRef
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r\n")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		columns := strings.Split(line, "\t")
+		if len(columns) < 5 || columns[0] == "Application ID" {
+			m.logger.WithField("line", line).Debug("Skipping malformed flatpak line")
+			continue
+		}
+
+		ref := flatpakRef{
+			application: strings.TrimSpace(columns[0]),
+			branch:      strings.TrimSpace(columns[1]),
+			version:     strings.TrimSpace(columns[2]),
+			commit:      strings.TrimSpace(columns[3]),
+			runtime:     strings.HasPrefix(strings.TrimSpace(columns[4]), "runtime/"),
+		}
+		refs = append(refs, ref)
+	}
+
+	return refs
+}
+
+// parseUpdates parses flatpak remote-ls --updates output
+func (m *FlatpakManager) parseUpdates(output string, installedPackages map[string]string) []models.Package {
+	var packages []models.Package
+
+	for _, ref := range m.parseRefs(output) {
+		name := ref.packageName()
+		currentVersion, ok := installedPackages[name]
+		if !ok {
+			m.logger.WithField("ref", name).Debug("Skipping update for ref not installed system-wide")
+			continue
+		}
+
+		packages = append(packages, models.Package{
+			Name:             name,
+			CurrentVersion:   currentVersion,
+			AvailableVersion: ref.displayVersion(),
+			NeedsUpdate:      true,
+			IsSecurityUpdate: false,
+		})
+	}
+
+	return packages
+}
+
+// packageName returns the name a ref is reported under. Several branches of a
+// runtime are commonly installed side by side, so runtimes carry their branch.
+func (r flatpakRef) packageName() string {
+	if r.runtime {
+		return r.application + "//" + r.branch
+	}
+	return r.application
+}
+
+// displayVersion returns the version of a ref, falling back to the short
+// commit for refs that do not declare a version
+func (r flatpakRef) displayVersion() string {
+	if r.version != "" {
+		return r.version
+	}
+	if len(r.commit) > 12 {
+		return r.commit[:12]
+	}
+	return r.commit
+}
@@ -0,0 +1,51 @@
+package packages
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlatpakManager_parseRefs(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewFlatpakManager(logger)
+
+	input := "org.mozilla.firefox\tstable\t125.0.1\t8f3c0a1b2d4e5f60718293a4b5c6d7e8\tapp/org.mozilla.firefox/x86_64/stable\n" +
+		"org.freedesktop.Platform\t22.08\t22.08.22\tc0ffee0123456789abcdef\truntime/org.freedesktop.Platform/x86_64/22.08\n" +
+		"org.freedesktop.Platform\t23.08\t23.08.17\tdeadbeef0123456789abcd\truntime/org.freedesktop.Platform/x86_64/23.08\n" +
+		"org.freedesktop.Platform.GL.default\t23.08\t\t0123456789abcdef0123\truntime/org.freedesktop.Platform.GL.default/x86_64/23.08\n"
+
+	refs := manager.parseRefs(input)
+	require.Len(t, refs, 4)
+
+	assert.Equal(t, "org.mozilla.firefox", refs[0].packageName())
+	assert.Equal(t, "125.0.1", refs[0].displayVersion())
+	assert.Equal(t, "org.freedesktop.Platform//22.08", refs[1].packageName())
+	assert.Equal(t, "org.freedesktop.Platform//23.08", refs[2].packageName())
+	// Refs without a declared version fall back to the short commit
+	assert.Equal(t, "0123456789ab", refs[3].displayVersion())
+}
+
+func TestFlatpakManager_parseUpdates(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewFlatpakManager(logger)
+
+	installed := map[string]string{
+		"org.mozilla.firefox":             "124.0.2",
+		"org.freedesktop.Platform//23.08": "23.08.16",
+	}
+	input := "org.mozilla.firefox\tstable\t125.0.1\t8f3c0a1b2d4e\tapp/org.mozilla.firefox/x86_64/stable\n" +
+		"org.freedesktop.Platform\t23.08\t23.08.17\tdeadbeef0123\truntime/org.freedesktop.Platform/x86_64/23.08\n" +
+		"org.gnome.Boxes\tstable\t46.0\tabc123\tapp/org.gnome.Boxes/x86_64/stable\n"
+
+	result := manager.parseUpdates(input, installed)
+	require.Len(t, result, 2)
+	assert.Equal(t, "org.mozilla.firefox", result[0].Name)
+	assert.Equal(t, "124.0.2", result[0].CurrentVersion)
+	assert.Equal(t, "125.0.1", result[0].AvailableVersion)
+	assert.Equal(t, "org.freedesktop.Platform//23.08", result[1].Name)
+}
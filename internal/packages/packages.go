@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os/exec"
 
+	"patchmon-agent/internal/pkgversion"
 	"patchmon-agent/pkg/models"
 
 	"github.com/sirupsen/logrus"
@@ -11,37 +12,85 @@ import (
 
 // Manager handles package information collection
 type Manager struct {
-	logger     *logrus.Logger
-	aptManager *APTManager
-	dnfManager *DNFManager
+	logger        *logrus.Logger
+	aptManager    *APTManager
+	dnfManager    *DNFManager
+	zypperManager *ZypperManager
+	pacmanManager *PacmanManager
+	apkManager    *APKManager
+
+	// Overlay sources collected in addition to the native package manager
+	snapManager    *SnapManager
+	flatpakManager *FlatpakManager
 }
 
 // New creates a new package manager
 func New(logger *logrus.Logger) *Manager {
 	aptManager := NewAPTManager(logger)
 	dnfManager := NewDNFManager(logger)
+	zypperManager := NewZypperManager(logger)
+	pacmanManager := NewPacmanManager(logger)
+	apkManager := NewAPKManager(logger)
+	snapManager := NewSnapManager(logger)
+	flatpakManager := NewFlatpakManager(logger)
 
 	return &Manager{
-		logger:     logger,
-		aptManager: aptManager,
-		dnfManager: dnfManager,
+		logger:        logger,
+		aptManager:    aptManager,
+		dnfManager:    dnfManager,
+		zypperManager: zypperManager,
+		pacmanManager: pacmanManager,
+		apkManager:    apkManager,
+
+		snapManager:    snapManager,
+		flatpakManager: flatpakManager,
 	}
 }
 
-// GetPackages gets package information based on detected package manager
+// GetPackages gets package information based on detected package manager,
+// followed by packages from any overlay sources (snap, flatpak) present
 func (m *Manager) GetPackages() ([]models.Package, error) {
 	packageManager := m.detectPackageManager()
 
 	m.logger.WithField("package_manager", packageManager).Debug("Detected package manager")
 
+	var packages []models.Package
 	switch packageManager {
 	case "apt":
-		return m.aptManager.GetPackages(), nil
+		packages = m.aptManager.GetPackages()
 	case "dnf", "yum":
-		return m.dnfManager.GetPackages(), nil
+		packages = m.dnfManager.GetPackages()
+	case "zypper":
+		packages = m.zypperManager.GetPackages()
+	case "pacman":
+		packages = m.pacmanManager.GetPackages()
+	case "apk":
+		packages = m.apkManager.GetPackages()
 	default:
 		return nil, fmt.Errorf("unsupported package manager: %s", packageManager)
 	}
+
+	for i := range packages {
+		if packages[i].Source == "" {
+			packages[i].Source = packageManager
+		}
+	}
+
+	// Overlay sources are best effort and never fail the report
+	if m.snapManager.IsAvailable() {
+		m.logger.Debug("Collecting snap packages")
+		snaps := m.snapManager.GetPackages()
+		m.logger.WithField("count", len(snaps)).Debug("Found snap packages")
+		packages = append(packages, snaps...)
+	}
+	if m.flatpakManager.IsAvailable() {
+		m.logger.Debug("Collecting flatpak packages")
+		flatpaks := m.flatpakManager.GetPackages()
+		m.logger.WithField("count", len(flatpaks)).Debug("Found flatpak packages")
+		packages = append(packages, flatpaks...)
+	}
+
+	return packages, nil
 }
 
 // detectPackageManager detects which package manager is available on the system
@@ -62,29 +111,86 @@ func (m *Manager) detectPackageManager() string {
 		return "yum"
 	}
 
+	// Check for Zypper (SUSE/openSUSE)
+	if _, err := exec.LookPath("zypper"); err == nil {
+		return "zypper"
+	}
+
+	// Check for Pacman (Arch Linux and derivatives)
+	if _, err := exec.LookPath("pacman"); err == nil {
+		return "pacman"
+	}
+
+	// Check for APK (Alpine Linux)
+	if _, err := exec.LookPath("apk"); err == nil {
+		return "apk"
+	}
+
 	return "unknown"
 }
 
 // CombinePackageData combines and deduplicates installed and upgradable package lists
-func CombinePackageData(installedPackages map[string]string, upgradablePackages []models.Package) []models.Package {
+func CombinePackageData(installedPackages map[string]string, upgradablePackages []models.Package, scheme pkgversion.Scheme) []models.Package {
+	installedDetails := make(map[string]models.Package, len(installedPackages))
+	for packageName, version := range installedPackages {
+		installedDetails[packageName] = models.Package{
+			Name:           packageName,
+			CurrentVersion: version,
+		}
+	}
+
+	return CombinePackageDetails(installedDetails, upgradablePackages, scheme)
+}
+
+// CombinePackageDetails combines and deduplicates installed package records and
+// upgradable packages. Upgradable packages inherit the details (architecture,
+// source package, size, install and hold state) of their installed record. When the
+// scheme can order versions, each update is classified and entries that are
+// not actually newer than the installed version (e.g. from a pinned repository)
+// are reported with NeedsUpdate unset.
+func CombinePackageDetails(installedPackages map[string]models.Package, upgradablePackages []models.Package, scheme pkgversion.Scheme) []models.Package {
 	var packages []models.Package
 	upgradableMap := make(map[string]bool)
 
 	// First, add all upgradable packages
 	for _, pkg := range upgradablePackages {
+		if installed, ok := installedPackages[pkg.Name]; ok {
+			if pkg.Architecture == "" {
+				pkg.Architecture = installed.Architecture
+			}
+			if pkg.SourcePackage == "" {
+				pkg.SourcePackage = installed.SourcePackage
+			}
+			if pkg.InstalledSize == 0 {
+				pkg.InstalledSize = installed.InstalledSize
+			}
+			if pkg.InstallState == "" {
+				pkg.InstallState = installed.InstallState
+			}
+			if pkg.HoldState == "" {
+				pkg.HoldState = installed.HoldState
+			}
+		}
+		if scheme != pkgversion.SchemeNone && pkg.CurrentVersion != "" && pkg.AvailableVersion != "" {
+			kind := pkgversion.Classify(scheme, pkg.CurrentVersion, pkg.AvailableVersion)
+			pkg.UpdateKind = string(kind)
+			if kind == pkgversion.UpdateKindNone || kind == pkgversion.UpdateKindDowngrade {
+				pkg.NeedsUpdate = false
+				pkg.IsSecurityUpdate = false
+			}
+		}
 		packages = append(packages, pkg)
 		upgradableMap[pkg.Name] = true
 	}
 
 	// Then add installed packages that are not upgradable
-	for packageName, version := range installedPackages {
+	for packageName, pkg := range installedPackages {
 		if !upgradableMap[packageName] {
-			packages = append(packages, models.Package{
-				Name:             packageName,
-				CurrentVersion:   version,
-				NeedsUpdate:      false,
-				IsSecurityUpdate: false,
-			})
+			pkg.Name = packageName
+			pkg.AvailableVersion = ""
+			pkg.NeedsUpdate = false
+			pkg.IsSecurityUpdate = false
+			packages = append(packages, pkg)
 		}
 	}
 
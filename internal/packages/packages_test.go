@@ -3,6 +3,7 @@ package packages
 import (
 	"testing"
 
+	"patchmon-agent/internal/pkgversion"
 	"patchmon-agent/pkg/models"
 
 	"github.com/stretchr/testify/assert"
@@ -13,6 +14,7 @@ func TestCombinePackageData(t *testing.T) {
 		name               string
 		installedPackages  map[string]string
 		upgradablePackages []models.Package
+		scheme             pkgversion.Scheme
 		expectedCount      int
 		expectedUpgradable int
 	}{
@@ -31,9 +33,45 @@ func TestCombinePackageData(t *testing.T) {
 					NeedsUpdate:      true,
 				},
 			},
+			scheme:             pkgversion.SchemeDpkg,
 			expectedCount:      3,
 			expectedUpgradable: 1,
 		},
+		{
+			name: "downgrade from pinned repository is not an update",
+			installedPackages: map[string]string{
+				"nginx": "1.24.0-1~jammy",
+			},
+			upgradablePackages: []models.Package{
+				{
+					Name:             "nginx",
+					CurrentVersion:   "1.24.0-1~jammy",
+					AvailableVersion: "1.18.0-6ubuntu14.4",
+					NeedsUpdate:      true,
+					IsSecurityUpdate: true,
+				},
+			},
+			scheme:             pkgversion.SchemeDpkg,
+			expectedCount:      1,
+			expectedUpgradable: 0,
+		},
+		{
+			name: "versions are trusted without a scheme",
+			installedPackages: map[string]string{
+				"musl": "1.2.4-r2",
+			},
+			upgradablePackages: []models.Package{
+				{
+					Name:             "musl",
+					CurrentVersion:   "1.2.4-r2",
+					AvailableVersion: "1.2.4-r1",
+					NeedsUpdate:      true,
+				},
+			},
+			scheme:             pkgversion.SchemeNone,
+			expectedCount:      1,
+			expectedUpgradable: 1,
+		},
 		{
 			name:               "empty inputs",
 			installedPackages:  map[string]string{},
@@ -45,7 +83,7 @@ func TestCombinePackageData(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := CombinePackageData(tt.installedPackages, tt.upgradablePackages)
+			result := CombinePackageData(tt.installedPackages, tt.upgradablePackages, tt.scheme)
 			assert.Equal(t, tt.expectedCount, len(result))
 
 			upgradable := 0
@@ -58,3 +96,24 @@ func TestCombinePackageData(t *testing.T) {
 		})
 	}
 }
+
+func TestCombinePackageDetails_UpdateKind(t *testing.T) {
+	installed := map[string]models.Package{
+		"kernel.x86_64":  {Name: "kernel.x86_64", CurrentVersion: "5.14.0-284.25.1.el9_2"},
+		"openssl.x86_64": {Name: "openssl.x86_64", CurrentVersion: "1:3.0.7-16.el9_2"},
+	}
+	upgradable := []models.Package{
+		{Name: "kernel.x86_64", CurrentVersion: "5.14.0-284.25.1.el9_2", AvailableVersion: "5.14.0-284.30.1.el9_2", NeedsUpdate: true},
+		{Name: "openssl.x86_64", CurrentVersion: "1:3.0.7-16.el9_2", AvailableVersion: "1:3.0.7-16.el9_2", NeedsUpdate: true},
+	}
+
+	result := CombinePackageDetails(installed, upgradable, pkgversion.SchemeRPM)
+	assert.Len(t, result, 2)
+
+	assert.Equal(t, "revision", result[0].UpdateKind)
+	assert.True(t, result[0].NeedsUpdate)
+
+	// Same version on both sides is not an update
+	assert.Equal(t, "", result[1].UpdateKind)
+	assert.False(t, result[1].NeedsUpdate)
+}
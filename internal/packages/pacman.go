@@ -0,0 +1,235 @@
+package packages
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+
+	"patchmon-agent/internal/pkgversion"
+	"patchmon-agent/pkg/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// pacmanDBPath is the default pacman database directory
+	pacmanDBPath = "/var/lib/pacman"
+	// pacmanCheckDBPath is the private database copy used to compute pending
+	// updates without syncing the live sync databases
+	pacmanCheckDBPath = "/var/lib/patchmon/pacman-checkdb"
+)
+
+// PacmanManager handles pacman package information collection on Arch-based systems
+type PacmanManager struct {
+	logger      *logrus.Logger
+	dbPath      string
+	checkDBPath string
+}
+
+// NewPacmanManager creates a new pacman package manager
+func NewPacmanManager(logger *logrus.Logger) *PacmanManager {
+	return &PacmanManager{
+		logger:      logger,
+		dbPath:      pacmanDBPath,
+		checkDBPath: pacmanCheckDBPath,
+	}
+}
+
+// GetPackages gets package information for pacman-based systems
+func (m *PacmanManager) GetPackages() []models.Package {
+	// Get installed packages straight from the local database
+	m.logger.Debug("Getting installed packages...")
+	installedPackages, err := m.readLocalDatabase(filepath.Join(m.dbPath, "local"))
+	if err != nil {
+		m.logger.WithError(err).Warn("Failed to read pacman local database")
+		installedPackages = make(map[string]string)
+	} else {
+		m.logger.WithField("count", len(installedPackages)).Debug("Found installed packages")
+	}
+
+	// Get upgradable packages against a private sync database snapshot
+	m.logger.Debug("Getting upgradable packages...")
+	var upgradablePackages []models.Package
+	checkOutput, err := m.checkUpdates()
+	if err != nil {
+		m.logger.WithError(err).Warn("Failed to check for pacman updates")
+		upgradablePackages = []models.Package{}
+	} else {
+		m.logger.Debug("Parsing pacman -Qu output...")
+		upgradablePackages = m.parseUpgradablePackages(checkOutput)
+		m.logger.WithField("count", len(upgradablePackages)).Debug("Found upgradable packages")
+	}
+
+	// Merge and deduplicate packages
+	packages := CombinePackageData(installedPackages, upgradablePackages, pkgversion.SchemeRPM)
+	m.logger.WithField("total", len(packages)).Debug("Total packages collected")
+
+	return packages
+}
+
+// checkUpdates refreshes a private copy of the sync databases and lists the
+// packages that would be upgraded, the same way checkupdates(8) does. Syncing
+// the live databases without upgrading would leave the system in a partial
+// upgrade state, so the local database is symlinked into a separate dbpath.
+func (m *PacmanManager) checkUpdates() (string, error) {
+	if err := m.prepareCheckDB(); err != nil {
+		return "", err
+	}
+	checkDBPath := m.checkDBPath
+
+	m.logger.WithField("dbpath", checkDBPath).Debug("Syncing private pacman databases")
+	syncCmd := exec.Command("pacman", "-Sy", "--dbpath", checkDBPath, "--logfile", "/dev/null")
+	if output, err := syncCmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("failed to sync databases: %w, output: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	// pacman -Qu exits with 1 when there is nothing to upgrade
+	queryCmd := exec.Command("pacman", "-Qu", "--dbpath", checkDBPath)
+	output, err := queryCmd.Output()
+	if err != nil && len(output) > 0 {
+		return "", err
+	}
+
+	return string(output), nil
+}
+
+// prepareCheckDB creates the private database directory and links the live
+// local database into it. pacman -Sy runs there as root, so the directory
+// must be ours and private, and a "local" entry pointing anywhere else is
+// replaced.
+func (m *PacmanManager) prepareCheckDB() error {
+	if err := os.MkdirAll(m.checkDBPath, 0700); err != nil {
+		return fmt.Errorf("failed to create check database directory: %w", err)
+	}
+	info, err := os.Lstat(m.checkDBPath)
+	if err != nil {
+		return fmt.Errorf("failed to inspect check database directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("check database path %s is not a directory", m.checkDBPath)
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); !ok || int(st.Uid) != os.Geteuid() {
+		return fmt.Errorf("check database directory %s is not owned by the agent user", m.checkDBPath)
+	}
+	if info.Mode().Perm() != 0700 {
+		if err := os.Chmod(m.checkDBPath, 0700); err != nil {
+			return fmt.Errorf("failed to restrict check database directory: %w", err)
+		}
+	}
+
+	localDB := filepath.Join(m.dbPath, "local")
+	localLink := filepath.Join(m.checkDBPath, "local")
+	if target, err := os.Readlink(localLink); err == nil && target == localDB {
+		return nil
+	}
+	if err := os.RemoveAll(localLink); err != nil {
+		return fmt.Errorf("failed to remove stale local database link: %w", err)
+	}
+	if err := os.Symlink(localDB, localLink); err != nil {
+		return fmt.Errorf("failed to link local database: %w", err)
+	}
+	return nil
+}
+
+// readLocalDatabase reads every desc file in the pacman local database
+// and returns a map of package name to version
+func (m *PacmanManager) readLocalDatabase(localPath string) (map[string]string, error) {
+	entries, err := os.ReadDir(localPath)
+	if err != nil {
+		return nil, err
+	}
+
+	installedPackages := make(map[string]string)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		descFile := filepath.Join(localPath, entry.Name(), "desc")
+		data, err := os.ReadFile(descFile)
+		if err != nil {
+			m.logger.WithError(err).WithField("file", descFile).Debug("Skipping unreadable package description")
+			continue
+		}
+
+		name, version := m.parseDesc(string(data))
+		if name == "" || version == "" {
+			m.logger.WithField("file", descFile).Debug("Skipping malformed package description")
+			continue
+		}
+		installedPackages[name] = version
+	}
+
+	return installedPackages, nil
+}
+
+// parseDesc parses a pacman desc file and returns the package name and version
+func (m *PacmanManager) parseDesc(content string) (name, version string) {
+	var section string
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" {
+			section = ""
+			continue
+		}
+
+		// Section headers look like %NAME%
+		if len(line) > 2 && strings.HasPrefix(line, "%") && strings.HasSuffix(line, "%") {
+			section = strings.Trim(line, "%")
+			continue
+		}
+
+		switch section {
+		case "NAME":
+			name = line
+		case "VERSION":
+			version = line
+		}
+	}
+
+	return name, version
+}
+
+// parseUpgradablePackages parses pacman -Qu output
+func (m *PacmanManager) parseUpgradablePackages(output string) []models.Package {
+	var packages []models.Package
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		// Parse the line: name current_version -> new_version [ignored]
+		fields := slices.Collect(strings.FieldsSeq(line))
+		if len(fields) < 4 || fields[2] != "->" {
+			m.logger.WithField("line", line).Debug("Skipping malformed pacman -Qu line")
+			continue
+		}
+
+		// Packages listed in IgnorePkg are never upgraded by pacman -Syu
+		if slices.Contains(fields[4:], "[ignored]") {
+			m.logger.WithField("package", fields[0]).Debug("Skipping ignored package")
+			continue
+		}
+
+		packages = append(packages, models.Package{
+			Name:             fields[0],
+			CurrentVersion:   fields[1],
+			AvailableVersion: fields[3],
+			NeedsUpdate:      true,
+			IsSecurityUpdate: false,
+		})
+	}
+
+	return packages
+}
@@ -0,0 +1,109 @@
+package packages
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPacmanManager_readLocalDatabase(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewPacmanManager(logger)
+
+	localPath := t.TempDir()
+	packages := map[string]string{
+		"bash-5.2.026-2":      "%NAME%\nbash\n\n%VERSION%\n5.2.026-2\n\n%BASE%\nbash\n\n%DESC%\nThe GNU Bourne Again shell\n",
+		"linux-6.8.1.arch1-1": "%NAME%\nlinux\n\n%VERSION%\n6.8.1.arch1-1\n\n%ARCH%\nx86_64\n",
+	}
+	for dir, desc := range packages {
+		require.NoError(t, os.MkdirAll(filepath.Join(localPath, dir), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(localPath, dir, "desc"), []byte(desc), 0644))
+	}
+	// The ALPM_DB_VERSION marker file must be ignored
+	require.NoError(t, os.WriteFile(filepath.Join(localPath, "ALPM_DB_VERSION"), []byte("9\n"), 0644))
+
+	result, err := manager.readLocalDatabase(localPath)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"bash":  "5.2.026-2",
+		"linux": "6.8.1.arch1-1",
+	}, result)
+}
+
+func TestPacmanManager_prepareCheckDB(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewPacmanManager(logger)
+	manager.dbPath = t.TempDir()
+	manager.checkDBPath = filepath.Join(t.TempDir(), "pacman-checkdb")
+	localDB := filepath.Join(manager.dbPath, "local")
+	localLink := filepath.Join(manager.checkDBPath, "local")
+
+	tests := []struct {
+		name  string
+		setup func(t *testing.T)
+	}{
+		{name: "fresh directory", setup: func(t *testing.T) {}},
+		{name: "already prepared", setup: func(t *testing.T) {}},
+		{name: "loose permissions", setup: func(t *testing.T) {
+			require.NoError(t, os.Chmod(manager.checkDBPath, 0777))
+		}},
+		{name: "link to another database", setup: func(t *testing.T) {
+			require.NoError(t, os.Remove(localLink))
+			require.NoError(t, os.Symlink(t.TempDir(), localLink))
+		}},
+		{name: "planted local directory", setup: func(t *testing.T) {
+			require.NoError(t, os.Remove(localLink))
+			require.NoError(t, os.MkdirAll(filepath.Join(localLink, "evil-1.0-1"), 0755))
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.setup(t)
+			require.NoError(t, manager.prepareCheckDB())
+
+			info, err := os.Lstat(manager.checkDBPath)
+			require.NoError(t, err)
+			assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+			target, err := os.Readlink(localLink)
+			require.NoError(t, err)
+			assert.Equal(t, localDB, target)
+		})
+	}
+}
+
+func TestPacmanManager_prepareCheckDB_symlinkedDirectory(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewPacmanManager(logger)
+	manager.dbPath = t.TempDir()
+	manager.checkDBPath = filepath.Join(t.TempDir(), "pacman-checkdb")
+	require.NoError(t, os.Symlink(t.TempDir(), manager.checkDBPath))
+
+	assert.ErrorContains(t, manager.prepareCheckDB(), "not a directory")
+}
+
+func TestPacmanManager_parseUpgradablePackages(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewPacmanManager(logger)
+
+	input := `linux 6.8.1.arch1-1 -> 6.8.2.arch2-1
+openssl 3.2.1-1 -> 3.2.1-2
+nvidia 550.54.14-4 -> 550.67-1 [ignored]
+`
+
+	result := manager.parseUpgradablePackages(input)
+	require.Len(t, result, 2)
+	assert.Equal(t, "linux", result[0].Name)
+	assert.Equal(t, "6.8.1.arch1-1", result[0].CurrentVersion)
+	assert.Equal(t, "6.8.2.arch2-1", result[0].AvailableVersion)
+	assert.True(t, result[0].NeedsUpdate)
+	assert.Equal(t, "openssl", result[1].Name)
+}
@@ -0,0 +1,161 @@
+package packages
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"patchmon-agent/internal/constants"
+	"patchmon-agent/internal/pkgversion"
+	"patchmon-agent/pkg/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// snapdSocket is the path of the snapd REST API socket
+const snapdSocket = "/run/snapd.socket"
+
+// SnapManager handles snap package information collection via the snapd REST API
+type SnapManager struct {
+	logger     *logrus.Logger
+	socketPath string
+	httpClient *http.Client
+}
+
+// snapdResponse is the envelope snapd wraps every synchronous response in
+type snapdResponse struct {
+	Type       string          `json:"type"`
+	StatusCode int             `json:"status-code"`
+	Result     json.RawMessage `json:"result"`
+}
+
+// snapInfo is the subset of snap fields the agent reports
+type snapInfo struct {
+	Name     string `json:"name"`
+	Version  string `json:"version"`
+	Revision string `json:"revision"`
+	Channel  string `json:"channel"`
+	Type     string `json:"type"`
+}
+
+// NewSnapManager creates a new snap package manager
+func NewSnapManager(logger *logrus.Logger) *SnapManager {
+	socketPath := snapdSocket
+	return &SnapManager{
+		logger:     logger,
+		socketPath: socketPath,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var dialer net.Dialer
+					return dialer.DialContext(ctx, "unix", socketPath)
+				},
+			},
+		},
+	}
+}
+
+// IsAvailable reports whether snapd is running on this system
+func (m *SnapManager) IsAvailable() bool {
+	info, err := os.Stat(m.socketPath)
+	return err == nil && info.Mode()&os.ModeSocket != 0
+}
+
+// GetPackages gets installed snaps and pending refreshes
+func (m *SnapManager) GetPackages() []models.Package {
+	m.logger.Debug("Getting installed snaps...")
+	installed, err := m.getSnaps("/v2/snaps")
+	if err != nil {
+		m.logger.WithError(err).Warn("Failed to get installed snaps")
+		return []models.Package{}
+	}
+
+	installedPackages := make(map[string]string, len(installed))
+	for _, snap := range installed {
+		installedPackages[snap.Name] = snap.Version
+	}
+	m.logger.WithField("count", len(installedPackages)).Debug("Found installed snaps")
+
+	m.logger.Debug("Getting snap refresh candidates...")
+	var upgradablePackages []models.Package
+	candidates, err := m.getSnaps("/v2/find?select=refresh")
+	if err != nil {
+		m.logger.WithError(err).Warn("Failed to get snap refresh candidates")
+		upgradablePackages = []models.Package{}
+	} else {
+		upgradablePackages = m.buildUpgradablePackages(installedPackages, candidates)
+		m.logger.WithField("count", len(upgradablePackages)).Debug("Found snap refresh candidates")
+	}
+
+	packages := CombinePackageData(installedPackages, upgradablePackages, pkgversion.SchemeNone)
+	for i := range packages {
+		packages[i].Source = constants.PackageSourceSnap
+	}
+
+	return packages
+}
+
+// buildUpgradablePackages pairs refresh candidates with the installed version
+func (m *SnapManager) buildUpgradablePackages(installedPackages map[string]string, candidates []snapInfo) []models.Package {
+	var packages []models.Package
+
+	for _, candidate := range candidates {
+		currentVersion, ok := installedPackages[candidate.Name]
+		if !ok {
+			continue
+		}
+
+		packages = append(packages, models.Package{
+			Name:             candidate.Name,
+			CurrentVersion:   currentVersion,
+			AvailableVersion: candidate.Version,
+			NeedsUpdate:      true,
+			IsSecurityUpdate: false,
+		})
+	}
+
+	return packages
+}
+
+// getSnaps queries a snapd endpoint that returns a list of snaps
+func (m *SnapManager) getSnaps(path string) ([]snapInfo, error) {
+	resp, err := m.httpClient.Get("http://localhost" + path)
+	if err != nil {
+		return nil, fmt.Errorf("snapd request failed: %w", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			m.logger.WithError(err).Debug("Failed to close snapd response body")
+		}
+	}()
+
+	var envelope snapdResponse
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return nil, fmt.Errorf("failed to decode snapd response: %w", err)
+	}
+
+	return m.parseSnapList(envelope)
+}
+
+// parseSnapList extracts the list of snaps from a snapd response envelope
+func (m *SnapManager) parseSnapList(envelope snapdResponse) ([]snapInfo, error) {
+	// snapd answers "no refresh candidates" with a 404 error response
+	if envelope.StatusCode == http.StatusNotFound {
+		return []snapInfo{}, nil
+	}
+	if envelope.Type == "error" || envelope.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("snapd returned status %d: %s", envelope.StatusCode, string(envelope.Result))
+	}
+
+	var snaps []snapInfo
+	if err := json.Unmarshal(envelope.Result, &snaps); err != nil {
+		return nil, fmt.Errorf("failed to decode snap list: %w", err)
+	}
+
+	return snaps, nil
+}
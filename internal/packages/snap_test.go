@@ -0,0 +1,76 @@
+package packages
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapManager_parseSnapList(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewSnapManager(logger)
+
+	tests := []struct {
+		name          string
+		input         string
+		expectErr     bool
+		expectedCount int
+	}{
+		{
+			name:          "installed snaps",
+			input:         `{"type":"sync","status-code":200,"status":"OK","result":[{"name":"firefox","version":"124.0.2-1","revision":"4090","channel":"latest/stable","type":"app"},{"name":"core22","version":"20240111","revision":"1122","type":"base"}]}`,
+			expectedCount: 2,
+		},
+		{
+			name:          "no refresh candidates",
+			input:         `{"type":"error","status-code":404,"status":"Not Found","result":{"message":"no snap updates available","kind":"snap-not-found"}}`,
+			expectedCount: 0,
+		},
+		{
+			name:      "snapd error",
+			input:     `{"type":"error","status-code":500,"status":"Internal Server Error","result":{"message":"boom"}}`,
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var envelope snapdResponse
+			require.NoError(t, json.Unmarshal([]byte(tt.input), &envelope))
+
+			result, err := manager.parseSnapList(envelope)
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, result, tt.expectedCount)
+		})
+	}
+}
+
+func TestSnapManager_buildUpgradablePackages(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewSnapManager(logger)
+
+	installed := map[string]string{
+		"firefox": "124.0.2-1",
+		"lxd":     "5.21.1-d46c406",
+	}
+	candidates := []snapInfo{
+		{Name: "firefox", Version: "125.0.1-1"},
+		{Name: "not-installed", Version: "1.0"},
+	}
+
+	result := manager.buildUpgradablePackages(installed, candidates)
+	require.Len(t, result, 1)
+	assert.Equal(t, "firefox", result[0].Name)
+	assert.Equal(t, "124.0.2-1", result[0].CurrentVersion)
+	assert.Equal(t, "125.0.1-1", result[0].AvailableVersion)
+	assert.True(t, result[0].NeedsUpdate)
+}
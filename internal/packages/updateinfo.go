@@ -0,0 +1,355 @@
+package packages
+
+import (
+	"bufio"
+	"encoding/json"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"patchmon-agent/internal/constants"
+	"patchmon-agent/internal/pkgversion"
+	"patchmon-agent/pkg/models"
+)
+
+// dnfAdvisory is one package entry of an updateinfo advisory, or of a CVE
+// reference when listing with CVEs
+type dnfAdvisory struct {
+	ID       string
+	Type     string
+	Severity string
+	Key      string // name.arch, as printed by check-update
+	EVR      string
+}
+
+// dnf5AdvisoryEntry is an entry of dnf5's advisory list --json output
+type dnf5AdvisoryEntry struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Severity string `json:"severity"`
+	NEVRA    string `json:"nevra"`
+}
+
+// dnf5ReferenceEntry is an entry of dnf5's advisory list --with-cve --json
+// output, which lists the references of each advisory package
+type dnf5ReferenceEntry struct {
+	Name       string `json:"advisory_name"`
+	Type       string `json:"advisory_type"`
+	Severity   string `json:"advisory_severity"`
+	NEVRA      string `json:"nevra"`
+	References []struct {
+		ID   string `json:"reference_id"`
+		Type string `json:"reference_type"`
+	} `json:"references"`
+}
+
+// severityRank orders advisory severities, most severe last
+var severityRank = map[string]int{
+	"Low":       1,
+	"Moderate":  2,
+	"Important": 3,
+	"Critical":  4,
+}
+
+// getAdvisories lists the advisories and CVEs that apply to available updates.
+// Repositories without updateinfo metadata simply yield no entries.
+func (m *DNFManager) getAdvisories(packageManager string) (advisories, cves []dnfAdvisory) {
+	if binary, ok := m.dnf5Binary(packageManager); ok {
+		advisoryOutput, err := exec.Command(binary, "-q", "advisory", "list", "--available", "--json").Output()
+		if err != nil {
+			m.logger.WithError(err).Warn("Failed to list advisories")
+			return nil, nil
+		}
+		advisories = m.parseAdvisoryJSON(string(advisoryOutput))
+
+		cveOutput, err := exec.Command(binary, "-q", "advisory", "list", "--available", "--with-cve", "--json").Output()
+		if err != nil {
+			m.logger.WithError(err).Debug("Failed to list advisory CVEs")
+			return advisories, nil
+		}
+		return advisories, m.parseAdvisoryCVEJSON(string(cveOutput))
+	}
+
+	listArgs := []string{"-q", "updateinfo", "list", "--available"}
+	cveArgs := []string{"-q", "updateinfo", "list", "--available", "--with-cve"}
+	if packageManager == "yum" {
+		listArgs = []string{"-q", "updateinfo", "list", "available"}
+		cveArgs = []string{"-q", "updateinfo", "list", "cves", "available"}
+	}
+
+	advisoryOutput, err := exec.Command(packageManager, listArgs...).Output()
+	if err != nil {
+		m.logger.WithError(err).Warn("Failed to list advisories")
+		return nil, nil
+	}
+	advisories = m.parseUpdateInfoList(string(advisoryOutput))
+
+	cveOutput, err := exec.Command(packageManager, cveArgs...).Output()
+	if err != nil {
+		m.logger.WithError(err).Debug("Failed to list advisory CVEs")
+		return advisories, nil
+	}
+	return advisories, m.parseUpdateInfoList(string(cveOutput))
+}
+
+// dnf5Binary returns the dnf5 binary to list advisories with, as dnf5
+// replaced updateinfo with the advisory command and supports JSON output.
+// dnf5 may be installed next to dnf4, so it is preferred when present;
+// otherwise packageManager is used if it is dnf5 itself.
+func (m *DNFManager) dnf5Binary(packageManager string) (string, bool) {
+	if packageManager == "yum" {
+		return "", false
+	}
+	if binary, err := exec.LookPath("dnf5"); err == nil {
+		return binary, true
+	}
+	output, err := exec.Command(packageManager, "--version").Output()
+	if err != nil {
+		return "", false
+	}
+	return packageManager, isDNF5Version(string(output))
+}
+
+// isDNF5Version reports whether dnf --version output comes from dnf5, which
+// prints "dnf5 version 5.2.5" where dnf4 prints the bare version "4.18.0"
+func isDNF5Version(output string) bool {
+	first, _, _ := strings.Cut(strings.TrimSpace(output), "\n")
+	first = strings.TrimSpace(first)
+	return strings.HasPrefix(first, "dnf5") || strings.HasPrefix(first, "5.")
+}
+
+// parseUpdateInfoList parses dnf4/yum updateinfo list output:
+//
+//	RHSA-2023:5312 Important/Sec. openssl-1:3.0.7-18.el9_2.x86_64
+//	RLBA-2023:5330 bugfix         tzdata-2023c-1.el9.noarch
+//	CVE-2023-3817  Important/Sec. openssl-1:3.0.7-18.el9_2.x86_64
+func (m *DNFManager) parseUpdateInfoList(output string) []dnfAdvisory {
+	var advisories []dnfAdvisory
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := slices.Collect(strings.FieldsSeq(scanner.Text()))
+		if len(fields) != 3 {
+			continue
+		}
+
+		key, evr, ok := splitNEVRA(fields[2])
+		if !ok {
+			continue
+		}
+
+		advisoryType, severity := parseUpdateInfoType(fields[1])
+		advisories = append(advisories, dnfAdvisory{
+			ID:       fields[0],
+			Type:     advisoryType,
+			Severity: severity,
+			Key:      key,
+			EVR:      evr,
+		})
+	}
+
+	return advisories
+}
+
+// parseUpdateInfoType splits the type column of updateinfo list, e.g.
+// "Important/Sec.", "Sec.", "bugfix" or "enhancement"
+func parseUpdateInfoType(value string) (advisoryType, severity string) {
+	severity, kind, found := strings.Cut(value, "/")
+	if !found {
+		kind, severity = value, ""
+	}
+
+	switch strings.ToLower(kind) {
+	case "sec.", "security":
+		advisoryType = constants.AdvisoryTypeSecurity
+	case "bugfix":
+		advisoryType = constants.AdvisoryTypeBugfix
+	case "enhancement":
+		advisoryType = constants.AdvisoryTypeEnhancement
+	case "newpackage":
+		advisoryType = constants.AdvisoryTypeNewPackage
+	default:
+		advisoryType = strings.ToLower(kind)
+	}
+
+	return advisoryType, normalizeSeverity(severity)
+}
+
+// normalizeSeverity maps severities to Critical/Important/Moderate/Low,
+// dropping placeholders such as "None" and "unknown"
+func normalizeSeverity(severity string) string {
+	for known := range severityRank {
+		if strings.EqualFold(severity, known) {
+			return known
+		}
+	}
+	return ""
+}
+
+// parseAdvisoryJSON parses dnf5 advisory list --json output
+func (m *DNFManager) parseAdvisoryJSON(output string) []dnfAdvisory {
+	var entries []dnf5AdvisoryEntry
+	if err := json.Unmarshal([]byte(output), &entries); err != nil {
+		m.logger.WithError(err).Warn("Failed to parse advisory list")
+		return nil
+	}
+
+	var advisories []dnfAdvisory
+	for _, entry := range entries {
+		key, evr, ok := splitNEVRA(entry.NEVRA)
+		if !ok {
+			continue
+		}
+
+		advisoryType, _ := parseUpdateInfoType(entry.Type)
+		advisories = append(advisories, dnfAdvisory{
+			ID:       entry.Name,
+			Type:     advisoryType,
+			Severity: normalizeSeverity(entry.Severity),
+			Key:      key,
+			EVR:      evr,
+		})
+	}
+
+	return advisories
+}
+
+// parseAdvisoryCVEJSON parses dnf5 advisory list --with-cve --json output
+// into one entry per CVE reference and package:
+//
+//	[{"advisory_name":"FEDORA-2024-3f5a2e8c1b","advisory_type":"security",
+//	  "advisory_severity":"Moderate","nevra":"glibc-2.39-17.fc40.x86_64",
+//	  "advisory_buildtime":"2024-07-01 00:00:00",
+//	  "references":[{"reference_id":"CVE-2024-33599","reference_type":"cve"}]}]
+func (m *DNFManager) parseAdvisoryCVEJSON(output string) []dnfAdvisory {
+	var entries []dnf5ReferenceEntry
+	if err := json.Unmarshal([]byte(output), &entries); err != nil {
+		m.logger.WithError(err).Warn("Failed to parse advisory CVE list")
+		return nil
+	}
+
+	var cves []dnfAdvisory
+	for _, entry := range entries {
+		key, evr, ok := splitNEVRA(entry.NEVRA)
+		if !ok {
+			continue
+		}
+
+		advisoryType, _ := parseUpdateInfoType(entry.Type)
+		for _, ref := range entry.References {
+			if !strings.EqualFold(ref.Type, "cve") {
+				continue
+			}
+			cves = append(cves, dnfAdvisory{
+				ID:       ref.ID,
+				Type:     advisoryType,
+				Severity: normalizeSeverity(entry.Severity),
+				Key:      key,
+				EVR:      evr,
+			})
+		}
+	}
+
+	return cves
+}
+
+// splitNEVRA splits name-[epoch:]version-release.arch into the name.arch key
+// and the [epoch:]version-release. yum prints the epoch before the name
+// instead (epoch:name-version-release.arch), which is handled as well.
+func splitNEVRA(nevra string) (key, evr string, ok bool) {
+	archIdx := strings.LastIndex(nevra, ".")
+	if archIdx <= 0 {
+		return "", "", false
+	}
+	arch := nevra[archIdx+1:]
+	rest := nevra[:archIdx]
+
+	relIdx := strings.LastIndex(rest, "-")
+	if relIdx <= 0 {
+		return "", "", false
+	}
+	verIdx := strings.LastIndex(rest[:relIdx], "-")
+	if verIdx <= 0 {
+		return "", "", false
+	}
+	name := rest[:verIdx]
+	evr = rest[verIdx+1:]
+
+	if epoch, bareName, found := strings.Cut(name, ":"); found {
+		name = bareName
+		evr = epoch + ":" + evr
+	}
+	if name == "" || arch == "" {
+		return "", "", false
+	}
+
+	return name + "." + arch, evr, true
+}
+
+// applyAdvisories attaches advisory details to upgradable packages. Every
+// advisory for the same name.arch that is fixed at or below the available
+// version applies; the most relevant one (security first, then by severity)
+// is reported and CVEs from all of them are merged.
+func (m *DNFManager) applyAdvisories(packages []models.Package, advisories, cves []dnfAdvisory) {
+	byKey := make(map[string][]dnfAdvisory)
+	for _, advisory := range advisories {
+		byKey[advisory.Key] = append(byKey[advisory.Key], advisory)
+	}
+	cvesByKey := make(map[string][]dnfAdvisory)
+	for _, cve := range cves {
+		cvesByKey[cve.Key] = append(cvesByKey[cve.Key], cve)
+	}
+
+	for i := range packages {
+		pkg := &packages[i]
+		if !pkg.NeedsUpdate {
+			continue
+		}
+
+		var best *dnfAdvisory
+		for _, advisory := range byKey[pkg.Name] {
+			if !advisoryApplies(advisory, pkg.AvailableVersion) {
+				continue
+			}
+			if best == nil || advisoryMoreRelevant(advisory, *best) {
+				best = &advisory
+			}
+		}
+		if best != nil {
+			pkg.AdvisoryID = best.ID
+			pkg.AdvisoryType = best.Type
+			pkg.Severity = best.Severity
+			if best.Type == constants.AdvisoryTypeSecurity {
+				pkg.IsSecurityUpdate = true
+			}
+		}
+
+		for _, cve := range cvesByKey[pkg.Name] {
+			if !strings.HasPrefix(cve.ID, "CVE-") || !advisoryApplies(cve, pkg.AvailableVersion) {
+				continue
+			}
+			if !slices.Contains(pkg.CVEs, cve.ID) {
+				pkg.CVEs = append(pkg.CVEs, cve.ID)
+			}
+		}
+		slices.Sort(pkg.CVEs)
+	}
+}
+
+// advisoryApplies reports whether an advisory is fixed by the available version
+func advisoryApplies(advisory dnfAdvisory, availableVersion string) bool {
+	if availableVersion == "" {
+		return true
+	}
+	return pkgversion.CompareRPM(advisory.EVR, availableVersion) <= 0
+}
+
+// advisoryMoreRelevant reports whether a should be reported instead of b
+func advisoryMoreRelevant(a, b dnfAdvisory) bool {
+	aSecurity := a.Type == constants.AdvisoryTypeSecurity
+	bSecurity := b.Type == constants.AdvisoryTypeSecurity
+	if aSecurity != bSecurity {
+		return aSecurity
+	}
+	return severityRank[a.Severity] > severityRank[b.Severity]
+}
@@ -0,0 +1,222 @@
+package packages
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"patchmon-agent/pkg/models"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDNFManager_parseUpdateInfoList(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewDNFManager(logger)
+
+	input := `Last metadata expiration check: 0:42:11 ago on Tue 03 Oct 2023 09:12:45 AM UTC.
+RLSA-2023:5312 Important/Sec. openssl-1:3.0.7-18.el9_2.x86_64
+RLSA-2023:5312 Important/Sec. openssl-libs-1:3.0.7-18.el9_2.x86_64
+RLBA-2023:5330 bugfix         tzdata-2023c-1.el9.noarch
+FEDORA-2023-1a2b3c4d5e unknown/Sec. curl-8.0.1-5.fc38.aarch64
+RHSA-2023:1234 Sec. 1:nss-3.90.0-3.el7_9.x86_64`
+
+	expected := []dnfAdvisory{
+		{ID: "RLSA-2023:5312", Type: "security", Severity: "Important", Key: "openssl.x86_64", EVR: "1:3.0.7-18.el9_2"},
+		{ID: "RLSA-2023:5312", Type: "security", Severity: "Important", Key: "openssl-libs.x86_64", EVR: "1:3.0.7-18.el9_2"},
+		{ID: "RLBA-2023:5330", Type: "bugfix", Key: "tzdata.noarch", EVR: "2023c-1.el9"},
+		{ID: "FEDORA-2023-1a2b3c4d5e", Type: "security", Key: "curl.aarch64", EVR: "8.0.1-5.fc38"},
+		{ID: "RHSA-2023:1234", Type: "security", Key: "nss.x86_64", EVR: "1:3.90.0-3.el7_9"},
+	}
+
+	assert.Equal(t, expected, manager.parseUpdateInfoList(input))
+	assert.Empty(t, manager.parseUpdateInfoList(""))
+}
+
+func TestDNFManager_parseAdvisoryJSON(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewDNFManager(logger)
+
+	input := `[
+  {"name":"FEDORA-2024-3f5a2e8c1b","type":"security","severity":"Moderate","nevra":"glibc-2.39-17.fc40.x86_64","buildtime":"2024-07-01 00:00:00"},
+  {"name":"FEDORA-2024-77aa01bc2d","type":"enhancement","severity":"None","nevra":"vim-enhanced-2:9.1.393-1.fc40.x86_64","buildtime":"2024-07-02 00:00:00"}
+]`
+
+	expected := []dnfAdvisory{
+		{ID: "FEDORA-2024-3f5a2e8c1b", Type: "security", Severity: "Moderate", Key: "glibc.x86_64", EVR: "2.39-17.fc40"},
+		{ID: "FEDORA-2024-77aa01bc2d", Type: "enhancement", Key: "vim-enhanced.x86_64", EVR: "2:9.1.393-1.fc40"},
+	}
+
+	assert.Equal(t, expected, manager.parseAdvisoryJSON(input))
+	assert.Nil(t, manager.parseAdvisoryJSON("not json"))
+}
+
+func TestDNFManager_parseAdvisoryCVEJSON(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewDNFManager(logger)
+
+	// dnf5 advisory list --available --with-cve --json
+	input := `[
+  {
+    "advisory_name":"FEDORA-2024-3f5a2e8c1b",
+    "advisory_type":"security",
+    "advisory_severity":"Moderate",
+    "nevra":"glibc-2.39-17.fc40.x86_64",
+    "advisory_buildtime":"2024-07-01 00:00:00",
+    "references":[
+      {"reference_id":"CVE-2024-33599","reference_type":"cve"},
+      {"reference_id":"2279525","reference_type":"bugzilla"},
+      {"reference_id":"CVE-2024-33600","reference_type":"cve"}
+    ]
+  },
+  {
+    "advisory_name":"FEDORA-2024-77aa01bc2d",
+    "advisory_type":"enhancement",
+    "advisory_severity":"None",
+    "nevra":"vim-enhanced-2:9.1.393-1.fc40.x86_64",
+    "advisory_buildtime":"2024-07-02 00:00:00",
+    "references":[]
+  }
+]`
+
+	expected := []dnfAdvisory{
+		{ID: "CVE-2024-33599", Type: "security", Severity: "Moderate", Key: "glibc.x86_64", EVR: "2.39-17.fc40"},
+		{ID: "CVE-2024-33600", Type: "security", Severity: "Moderate", Key: "glibc.x86_64", EVR: "2.39-17.fc40"},
+	}
+
+	assert.Equal(t, expected, manager.parseAdvisoryCVEJSON(input))
+	assert.Nil(t, manager.parseAdvisoryCVEJSON("not json"))
+}
+
+func TestIsDNF5Version(t *testing.T) {
+	tests := []struct {
+		output   string
+		expected bool
+	}{
+		{output: "dnf5 version 5.2.5.0\ndnf5 plugin API version 2.0\n", expected: true},
+		{output: "5.1.17\n", expected: true},
+		{output: "4.18.0\n  Installed: dnf-0:4.18.0-2.fc39.noarch at Mon 01 Jan 2024\n", expected: false},
+		{output: "", expected: false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, isDNF5Version(tt.output), tt.output)
+	}
+}
+
+func TestDNFManager_getAdvisories_mixedInstall(t *testing.T) {
+	// dnf is dnf4, which has no advisory command, and dnf5 is installed next
+	// to it: the advisories must come from dnf5
+	dir := t.TempDir()
+	writeScript := func(name, body string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+body), 0755))
+	}
+	writeScript("dnf", `case "$1" in --version) echo 4.18.0 ;; *) [ "$2" = updateinfo ] || exit 1 ;; esac`)
+	writeScript("dnf5", `case "$*" in
+*--with-cve*) echo '[{"advisory_name":"FEDORA-2024-3f5a2e8c1b","advisory_type":"security","advisory_severity":"Moderate","nevra":"glibc-2.39-17.fc40.x86_64","advisory_buildtime":"2024-07-01 00:00:00","references":[{"reference_id":"CVE-2024-33599","reference_type":"cve"}]}]' ;;
+*) echo '[{"name":"FEDORA-2024-3f5a2e8c1b","type":"security","severity":"Moderate","nevra":"glibc-2.39-17.fc40.x86_64","buildtime":"2024-07-01 00:00:00"}]' ;;
+esac`)
+	t.Setenv("PATH", dir)
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewDNFManager(logger)
+
+	binary, ok := manager.dnf5Binary("dnf")
+	assert.True(t, ok)
+	assert.Equal(t, filepath.Join(dir, "dnf5"), binary)
+
+	advisories, cves := manager.getAdvisories("dnf")
+	assert.Equal(t, []dnfAdvisory{
+		{ID: "FEDORA-2024-3f5a2e8c1b", Type: "security", Severity: "Moderate", Key: "glibc.x86_64", EVR: "2.39-17.fc40"},
+	}, advisories)
+	assert.Equal(t, []dnfAdvisory{
+		{ID: "CVE-2024-33599", Type: "security", Severity: "Moderate", Key: "glibc.x86_64", EVR: "2.39-17.fc40"},
+	}, cves)
+
+	// The CVEs reach the package
+	packages := []models.Package{
+		{Name: "glibc.x86_64", CurrentVersion: "2.39-15.fc40", AvailableVersion: "2.39-17.fc40", NeedsUpdate: true},
+	}
+	manager.applyAdvisories(packages, advisories, cves)
+	assert.Equal(t, []string{"CVE-2024-33599"}, packages[0].CVEs)
+
+	// Without dnf5 the dnf4 updateinfo command is used
+	require.NoError(t, os.Remove(filepath.Join(dir, "dnf5")))
+	_, ok = manager.dnf5Binary("dnf")
+	assert.False(t, ok)
+	advisories, _ = manager.getAdvisories("dnf")
+	assert.Empty(t, advisories)
+}
+
+func TestSplitNEVRA(t *testing.T) {
+	tests := []struct {
+		nevra string
+		key   string
+		evr   string
+		ok    bool
+	}{
+		{"openssl-1:3.0.7-18.el9_2.x86_64", "openssl.x86_64", "1:3.0.7-18.el9_2", true},
+		{"1:openssl-1.0.2k-26.el7_9.x86_64", "openssl.x86_64", "1:1.0.2k-26.el7_9", true},
+		{"python3-dateutil-2.8.1-7.el9.noarch", "python3-dateutil.noarch", "2.8.1-7.el9", true},
+		{"noversion.x86_64", "", "", false},
+		{"", "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.nevra, func(t *testing.T) {
+			key, evr, ok := splitNEVRA(tt.nevra)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.key, key)
+			assert.Equal(t, tt.evr, evr)
+		})
+	}
+}
+
+func TestDNFManager_applyAdvisories(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewDNFManager(logger)
+
+	packages := []models.Package{
+		{Name: "openssl.x86_64", CurrentVersion: "1:3.0.7-16.el9_2", AvailableVersion: "1:3.0.7-18.el9_2", NeedsUpdate: true},
+		{Name: "tzdata.noarch", CurrentVersion: "2023c-1.el9", AvailableVersion: "2024a-1.el9", NeedsUpdate: true},
+		{Name: "kernel.x86_64", CurrentVersion: "5.14.0-284.25.1.el9_2", AvailableVersion: "5.14.0-284.30.1.el9_2", NeedsUpdate: true},
+		{Name: "bash.x86_64", CurrentVersion: "5.1.8-6.el9_1"},
+	}
+	advisories := []dnfAdvisory{
+		{ID: "RLBA-2023:5000", Type: "bugfix", Key: "openssl.x86_64", EVR: "1:3.0.7-17.el9_2"},
+		{ID: "RLSA-2023:5312", Type: "security", Severity: "Important", Key: "openssl.x86_64", EVR: "1:3.0.7-18.el9_2"},
+		{ID: "RLSA-2023:6000", Type: "security", Severity: "Critical", Key: "openssl.x86_64", EVR: "1:3.0.7-20.el9_2"},
+		{ID: "RLBA-2024:0101", Type: "bugfix", Key: "tzdata.noarch", EVR: "2024a-1.el9"},
+		{ID: "RLSA-2023:9999", Type: "security", Severity: "Low", Key: "bash.x86_64", EVR: "5.1.8-9.el9"},
+	}
+	cves := []dnfAdvisory{
+		{ID: "CVE-2023-3817", Type: "security", Key: "openssl.x86_64", EVR: "1:3.0.7-18.el9_2"},
+		{ID: "CVE-2023-3446", Type: "security", Key: "openssl.x86_64", EVR: "1:3.0.7-18.el9_2"},
+		{ID: "CVE-2023-9999", Type: "security", Key: "openssl.x86_64", EVR: "1:3.0.7-20.el9_2"},
+	}
+
+	manager.applyAdvisories(packages, advisories, cves)
+
+	// The critical advisory needs a newer build than is available
+	require.Equal(t, "RLSA-2023:5312", packages[0].AdvisoryID)
+	assert.Equal(t, "security", packages[0].AdvisoryType)
+	assert.Equal(t, "Important", packages[0].Severity)
+	assert.True(t, packages[0].IsSecurityUpdate)
+	assert.Equal(t, []string{"CVE-2023-3446", "CVE-2023-3817"}, packages[0].CVEs)
+
+	assert.Equal(t, "RLBA-2024:0101", packages[1].AdvisoryID)
+	assert.False(t, packages[1].IsSecurityUpdate)
+
+	assert.Empty(t, packages[2].AdvisoryID)
+
+	// Packages without a pending update are left alone
+	assert.Empty(t, packages[3].AdvisoryID)
+	assert.False(t, packages[3].IsSecurityUpdate)
+}
@@ -0,0 +1,245 @@
+package packages
+
+import (
+	"bufio"
+	"encoding/xml"
+	"os/exec"
+	"strings"
+
+	"patchmon-agent/internal/pkgversion"
+	"patchmon-agent/pkg/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ZypperManager handles zypper package information collection on SUSE/openSUSE systems
+type ZypperManager struct {
+	logger *logrus.Logger
+}
+
+// NewZypperManager creates a new zypper package manager
+func NewZypperManager(logger *logrus.Logger) *ZypperManager {
+	return &ZypperManager{
+		logger: logger,
+	}
+}
+
+// zypperStream is the root element of zypper --xmlout output
+type zypperStream struct {
+	Updates        []zypperUpdate        `xml:"update-status>update-list>update"`
+	InstallSummary *zypperInstallSummary `xml:"install-summary"`
+}
+
+// zypperUpdate is a single <update> element from list-updates or list-patches
+type zypperUpdate struct {
+	Kind       string `xml:"kind,attr"`
+	Name       string `xml:"name,attr"`
+	Edition    string `xml:"edition,attr"`
+	EditionOld string `xml:"edition-old,attr"`
+	Arch       string `xml:"arch,attr"`
+	Status     string `xml:"status,attr"`
+	Category   string `xml:"category,attr"`
+	Severity   string `xml:"severity,attr"`
+	Summary    string `xml:"summary"`
+}
+
+// zypperInstallSummary is the <install-summary> element of a dry-run
+type zypperInstallSummary struct {
+	ToUpgrade []zypperSolvable `xml:"to-upgrade>solvable"`
+}
+
+// zypperSolvable is a single <solvable> element of an install summary
+type zypperSolvable struct {
+	Type       string `xml:"type,attr"`
+	Name       string `xml:"name,attr"`
+	Edition    string `xml:"edition,attr"`
+	EditionOld string `xml:"edition-old,attr"`
+}
+
+// GetPackages gets package information for zypper-based systems
+func (m *ZypperManager) GetPackages() []models.Package {
+	// Refresh repository metadata so pending updates are current
+	m.logger.Debug("Refreshing zypper repositories")
+	refreshCmd := exec.Command("zypper", "--non-interactive", "--quiet", "refresh")
+	if err := refreshCmd.Run(); err != nil {
+		m.logger.WithError(err).Warn("Failed to refresh zypper repositories")
+	}
+
+	// Get installed packages from the rpm database
+	m.logger.Debug("Getting installed packages...")
+	installedCmd := exec.Command("rpm", "-qa", "--queryformat", "%{NAME} %|EPOCH?{%{EPOCH}:}:{}|%{VERSION}-%{RELEASE}\n")
+	installedOutput, err := installedCmd.Output()
+	var installedPackages map[string]string
+	if err != nil {
+		m.logger.WithError(err).Warn("Failed to get installed packages")
+		installedPackages = make(map[string]string)
+	} else {
+		m.logger.Debug("Parsing installed packages...")
+		installedPackages = m.parseInstalledPackages(string(installedOutput))
+		m.logger.WithField("count", len(installedPackages)).Debug("Found installed packages")
+	}
+
+	// Get upgradable packages
+	m.logger.Debug("Getting upgradable packages...")
+	updatesCmd := exec.Command("zypper", "--non-interactive", "--xmlout", "list-updates")
+	updatesOutput, err := updatesCmd.Output()
+	var upgradablePackages []models.Package
+	if err != nil && len(updatesOutput) == 0 {
+		m.logger.WithError(err).Warn("Failed to get zypper list-updates output")
+		upgradablePackages = []models.Package{}
+	} else {
+		m.logger.Debug("Parsing zypper list-updates output...")
+		upgradablePackages = m.parseListUpdates(string(updatesOutput))
+		m.logger.WithField("count", len(upgradablePackages)).Debug("Found upgradable packages")
+	}
+
+	// Get needed patches; zypper exits with 100/101 when patches are pending
+	m.logger.Debug("Getting needed patches...")
+	patchesCmd := exec.Command("zypper", "--non-interactive", "--xmlout", "list-patches")
+	patchesOutput, _ := patchesCmd.Output()
+	securityPatches := m.parseSecurityPatches(string(patchesOutput))
+	m.logger.WithField("count", len(securityPatches)).Debug("Found needed security patches")
+
+	// Resolve which packages the security patches would upgrade
+	if len(securityPatches) > 0 {
+		dryRunCmd := exec.Command("zypper", "--non-interactive", "--xmlout", "patch", "--dry-run", "--category", "security")
+		dryRunOutput, _ := dryRunCmd.Output()
+		securityPackages := m.parsePatchDryRun(string(dryRunOutput))
+		m.logger.WithField("count", len(securityPackages)).Debug("Found packages covered by security patches")
+
+		for i := range upgradablePackages {
+			if securityPackages[upgradablePackages[i].Name] {
+				upgradablePackages[i].IsSecurityUpdate = true
+			}
+		}
+	}
+
+	// Merge and deduplicate packages
+	packages := CombinePackageData(installedPackages, upgradablePackages, pkgversion.SchemeRPM)
+	m.logger.WithField("total", len(packages)).Debug("Total packages collected")
+
+	return packages
+}
+
+// parseInstalledPackages parses rpm -qa output and returns a map of package name to version
+func (m *ZypperManager) parseInstalledPackages(output string) map[string]string {
+	installedPackages := make(map[string]string)
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		parts := strings.SplitN(line, " ", 2)
+		if len(parts) != 2 {
+			m.logger.WithField("line", line).Debug("Skipping malformed installed package line")
+			continue
+		}
+
+		// gpg-pubkey pseudo packages are imported keys, not software
+		if parts[0] == "gpg-pubkey" {
+			continue
+		}
+
+		installedPackages[parts[0]] = parts[1]
+	}
+
+	return installedPackages
+}
+
+// parseListUpdates parses zypper --xmlout list-updates output
+func (m *ZypperManager) parseListUpdates(output string) []models.Package {
+	var packages []models.Package
+
+	stream, err := m.decodeStream(output)
+	if err != nil {
+		m.logger.WithError(err).Warn("Failed to decode zypper list-updates output")
+		return packages
+	}
+
+	for _, update := range stream.Updates {
+		if update.Kind != "" && update.Kind != "package" {
+			continue
+		}
+		if update.Name == "" || update.Edition == "" {
+			continue
+		}
+
+		packages = append(packages, models.Package{
+			Name:             update.Name,
+			CurrentVersion:   update.EditionOld,
+			AvailableVersion: update.Edition,
+			NeedsUpdate:      true,
+			IsSecurityUpdate: false,
+		})
+	}
+
+	return packages
+}
+
+// parseSecurityPatches parses zypper --xmlout list-patches output and returns
+// the names of needed patches in the security category
+func (m *ZypperManager) parseSecurityPatches(output string) []string {
+	var patches []string
+
+	stream, err := m.decodeStream(output)
+	if err != nil {
+		m.logger.WithError(err).Debug("Failed to decode zypper list-patches output")
+		return patches
+	}
+
+	for _, update := range stream.Updates {
+		if update.Kind != "patch" || update.Category != "security" {
+			continue
+		}
+		// Older zypper versions omit status and only list needed patches
+		if update.Status != "" && update.Status != "needed" {
+			continue
+		}
+
+		m.logger.WithFields(logrus.Fields{
+			"patch":    update.Name,
+			"severity": update.Severity,
+			"summary":  update.Summary,
+		}).Debug("Security patch needed")
+		patches = append(patches, update.Name)
+	}
+
+	return patches
+}
+
+// parsePatchDryRun parses zypper --xmlout patch --dry-run output and returns
+// the set of package names that would be upgraded
+func (m *ZypperManager) parsePatchDryRun(output string) map[string]bool {
+	packageNames := make(map[string]bool)
+
+	stream, err := m.decodeStream(output)
+	if err != nil || stream.InstallSummary == nil {
+		return packageNames
+	}
+
+	for _, solvable := range stream.InstallSummary.ToUpgrade {
+		if solvable.Type == "" || solvable.Type == "package" {
+			packageNames[solvable.Name] = true
+		}
+	}
+
+	return packageNames
+}
+
+// decodeStream decodes the <stream> document zypper writes in XML mode
+func (m *ZypperManager) decodeStream(output string) (*zypperStream, error) {
+	var stream zypperStream
+	if strings.TrimSpace(output) == "" {
+		return &stream, nil
+	}
+
+	decoder := xml.NewDecoder(strings.NewReader(output))
+	if err := decoder.Decode(&stream); err != nil {
+		return nil, err
+	}
+
+	return &stream, nil
+}
@@ -0,0 +1,107 @@
+package packages
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestZypperManager_parseInstalledPackages(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewZypperManager(logger)
+
+	input := `curl 8.0.1-150400.5.41.1
+gpg-pubkey 39db7c82-5f68629b
+vim 9.1.0111-150500.20.9.1
+`
+	expected := map[string]string{
+		"curl": "8.0.1-150400.5.41.1",
+		"vim":  "9.1.0111-150500.20.9.1",
+	}
+
+	assert.Equal(t, expected, manager.parseInstalledPackages(input))
+}
+
+func TestZypperManager_parseListUpdates(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewZypperManager(logger)
+
+	input := `<?xml version='1.0'?>
+<stream>
+<message type="info">Loading repository data...</message>
+<update-status version="0.6">
+<update-list>
+<update kind="package" name="curl" edition="8.0.1-150400.5.44.1" arch="x86_64" edition-old="8.0.1-150400.5.41.1">
+<summary>A Tool for Transferring Data from URLs</summary>
+<source url="https://download.opensuse.org/update/leap/15.5/sle" alias="repo-sle-update"/>
+</update>
+<update kind="package" name="libcurl4" edition="8.0.1-150400.5.44.1" arch="x86_64" edition-old="8.0.1-150400.5.41.1">
+<summary>Version 4 of cURL shared library</summary>
+<source url="https://download.opensuse.org/update/leap/15.5/sle" alias="repo-sle-update"/>
+</update>
+</update-list>
+</update-status>
+</stream>`
+
+	result := manager.parseListUpdates(input)
+	require.Len(t, result, 2)
+	assert.Equal(t, "curl", result[0].Name)
+	assert.Equal(t, "8.0.1-150400.5.41.1", result[0].CurrentVersion)
+	assert.Equal(t, "8.0.1-150400.5.44.1", result[0].AvailableVersion)
+	assert.True(t, result[0].NeedsUpdate)
+	assert.False(t, result[0].IsSecurityUpdate)
+}
+
+func TestZypperManager_parseSecurityPatches(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewZypperManager(logger)
+
+	input := `<?xml version='1.0'?>
+<stream>
+<update-status version="0.6">
+<update-list>
+<update kind="patch" name="openSUSE-SLE-15.5-2024-1234" edition="1" arch="noarch" status="needed" category="security" severity="important">
+<summary>Security update for curl</summary>
+</update>
+<update kind="patch" name="openSUSE-SLE-15.5-2024-1300" edition="1" arch="noarch" status="needed" category="recommended" severity="moderate">
+<summary>Recommended update for vim</summary>
+</update>
+<update kind="patch" name="openSUSE-SLE-15.5-2024-0999" edition="1" arch="noarch" status="applied" category="security" severity="low">
+<summary>Security update for bash</summary>
+</update>
+</update-list>
+</update-status>
+</stream>`
+
+	assert.Equal(t, []string{"openSUSE-SLE-15.5-2024-1234"}, manager.parseSecurityPatches(input))
+}
+
+func TestZypperManager_parsePatchDryRun(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewZypperManager(logger)
+
+	input := `<?xml version='1.0'?>
+<stream>
+<install-summary download-size="1234" space-usage-diff="0" packages-to-change="3">
+<to-upgrade>
+<solvable type="package" name="curl" edition="8.0.1-150400.5.44.1" arch="x86_64" edition-old="8.0.1-150400.5.41.1"/>
+<solvable type="package" name="libcurl4" edition="8.0.1-150400.5.44.1" arch="x86_64" edition-old="8.0.1-150400.5.41.1"/>
+</to-upgrade>
+<to-install>
+<solvable type="patch" name="openSUSE-SLE-15.5-2024-1234" edition="1" arch="noarch"/>
+</to-install>
+</install-summary>
+</stream>`
+
+	expected := map[string]bool{
+		"curl":     true,
+		"libcurl4": true,
+	}
+	assert.Equal(t, expected, manager.parsePatchDryRun(input))
+}
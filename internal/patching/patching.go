@@ -0,0 +1,413 @@
+// Package patching applies package updates with the native package manager
+// on behalf of the PatchMon server.
+package patching
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"patchmon-agent/internal/packages"
+	"patchmon-agent/internal/rpmdb"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Mode selects which updates are applied
+type Mode string
+
+const (
+	ModeAll      Mode = "all"      // Every available update
+	ModeSecurity Mode = "security" // Security updates only
+	ModePackages Mode = "packages" // An explicit list of packages
+)
+
+// Request describes an update run
+type Request struct {
+	Mode     Mode
+	Packages []string // Package names for ModePackages
+	Exclude  []string // Package name patterns that must not be updated
+}
+
+// PackageChange is a package whose installed version changed during a run.
+// From is empty for newly installed packages, To for removed ones.
+type PackageChange struct {
+	Name string `json:"name"`
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+// Result is the outcome of an update run
+type Result struct {
+	PackageManager string          `json:"package_manager"`
+	ExitCode       int             `json:"exit_code"`
+	Changes        []PackageChange `json:"packages_changed"`
+	RebootRequired bool            `json:"reboot_required"`
+}
+
+// ProgressFunc receives each line of package manager output as it is produced
+type ProgressFunc func(line string)
+
+// packageNamePattern accepts deb (name[:arch]) and rpm package names and
+// rejects anything that could be taken as a command-line option. Names end
+// in a letter or digit, or in "++" as in g++: apt-get reads a trailing "-"
+// on an unknown name as "remove" and a trailing "+" as "install".
+var packageNamePattern = regexp.MustCompile(
+	`^[A-Za-z0-9](?:[A-Za-z0-9._~+-]*(?:[A-Za-z0-9]|\+\+))?(?::[A-Za-z0-9](?:[A-Za-z0-9._~-]*[A-Za-z0-9])?)?$`)
+
+// cancelWaitDelay is how long a cancelled package manager may take to exit
+// after SIGTERM before it is killed
+const cancelWaitDelay = 30 * time.Second
+
+// rebootRequiredFile is created by Debian/Ubuntu packages that need a reboot
+const rebootRequiredFile = "/var/run/reboot-required"
+
+// Packages whose update needs a reboot on hosts without needs-restarting
+var rebootPackages = []string{"kernel", "kernel-core", "glibc", "systemd", "linux-firmware"}
+
+// Runner applies updates. Only one run may be in progress at a time.
+type Runner struct {
+	logger *logrus.Logger
+	mu     sync.Mutex
+
+	stateMu sync.Mutex
+	started time.Time // Start of the run in progress, zero when idle
+}
+
+// Running returns when the run in progress started, or false when idle
+func (r *Runner) Running() (time.Time, bool) {
+	r.stateMu.Lock()
+	defer r.stateMu.Unlock()
+	return r.started, !r.started.IsZero()
+}
+
+func (r *Runner) setStarted(t time.Time) {
+	r.stateMu.Lock()
+	defer r.stateMu.Unlock()
+	r.started = t
+}
+
+// ErrBusy is returned when an update run is already in progress
+var ErrBusy = errors.New("an update run is already in progress")
+
+// New creates a new update runner
+func New(logger *logrus.Logger) *Runner {
+	return &Runner{
+		logger: logger,
+	}
+}
+
+// Apply runs the requested updates, streaming package manager output to
+// progress. The result is returned even when the package manager fails, so
+// partial changes are still reported.
+func (r *Runner) Apply(ctx context.Context, req Request, progress ProgressFunc) (*Result, error) {
+	if !r.mu.TryLock() {
+		return nil, ErrBusy
+	}
+	defer r.mu.Unlock()
+	r.setStarted(time.Now())
+	defer r.setStarted(time.Time{})
+
+	if err := ValidateRequest(req); err != nil {
+		return nil, err
+	}
+
+	packageManager := detectPackageManager()
+	if packageManager == "" {
+		return nil, fmt.Errorf("no supported package manager (apt, dnf, yum) found")
+	}
+	result := &Result{PackageManager: packageManager}
+
+	before, err := installedVersions(packageManager)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read installed packages: %w", err)
+	}
+
+	var commands [][]string
+	switch packageManager {
+	case "apt":
+		commands, err = r.aptCommands(req)
+	default:
+		commands = dnfCommands(packageManager, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var runErr error
+	for _, args := range commands {
+		r.logger.WithField("command", strings.Join(args, " ")).Info("Running package manager")
+		result.ExitCode, runErr = runStreaming(ctx, args, progress)
+		if runErr != nil {
+			break
+		}
+	}
+
+	after, err := installedVersions(packageManager)
+	if err != nil {
+		r.logger.WithError(err).Warn("Failed to read installed packages after update")
+	} else {
+		result.Changes = diffVersions(before, after)
+	}
+	result.RebootRequired = r.rebootRequired(packageManager, result.Changes)
+
+	return result, runErr
+}
+
+// ValidateRequest checks the mode and package names of a request
+func ValidateRequest(req Request) error {
+	switch req.Mode {
+	case ModeAll, ModeSecurity:
+		return nil
+	case ModePackages:
+		if len(req.Packages) == 0 {
+			return fmt.Errorf("no packages given")
+		}
+		for _, name := range req.Packages {
+			if !packageNamePattern.MatchString(name) {
+				return fmt.Errorf("invalid package name %q", name)
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown update mode %q", req.Mode)
+	}
+}
+
+// detectPackageManager returns apt, dnf or yum, or "" if none is available
+func detectPackageManager() string {
+	for _, candidate := range []struct{ binary, name string }{
+		{"apt-get", "apt"},
+		{"dnf", "dnf"},
+		{"yum", "yum"},
+	} {
+		if _, err := exec.LookPath(candidate.binary); err == nil {
+			return candidate.name
+		}
+	}
+	return ""
+}
+
+// aptCommands builds the apt-get invocations for a request. apt has neither
+// a security filter nor exclusions, so security-only runs and runs with
+// exclusions upgrade an explicit list of the updates the report would show.
+func (r *Runner) aptCommands(req Request) ([][]string, error) {
+	aptGet := []string{
+		"apt-get", "-y", "-q",
+		"-o", "Dpkg::Options::=--force-confdef",
+		"-o", "Dpkg::Options::=--force-confold",
+	}
+	update := []string{"apt-get", "update", "-q"}
+
+	switch {
+	case req.Mode == ModeAll && len(req.Exclude) == 0:
+		return [][]string{update, append(aptGet, "upgrade")}, nil
+	case req.Mode == ModePackages:
+		for _, name := range req.Packages {
+			if pattern, _ := MatchPackage(name, req.Exclude); pattern != "" {
+				return nil, fmt.Errorf("package %s is excluded by pattern %s", name, pattern)
+			}
+		}
+		return [][]string{update, append(append(aptGet, "install", "--only-upgrade"), req.Packages...)}, nil
+	}
+
+	var names []string
+	for _, pkg := range packages.NewAPTManager(r.logger).GetPackages() {
+		// Kept-back and held packages are skipped by apt-get upgrade as well
+		if !pkg.NeedsUpdate || pkg.HoldState != "" {
+			continue
+		}
+		if req.Mode == ModeSecurity && !pkg.IsSecurityUpdate {
+			continue
+		}
+		if pattern, _ := MatchPackage(pkg.Name, req.Exclude); pattern != "" {
+			r.logger.WithFields(logrus.Fields{"package": pkg.Name, "pattern": pattern}).Info("Skipping excluded package")
+			continue
+		}
+		names = append(names, pkg.Name)
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	return [][]string{append(append(aptGet, "install", "--only-upgrade"), names...)}, nil
+}
+
+// dnfCommands builds the dnf/yum invocation for a request
+func dnfCommands(packageManager string, req Request) [][]string {
+	args := []string{packageManager, "-y", "upgrade"}
+	for _, pattern := range req.Exclude {
+		args = append(args, "--exclude="+pattern)
+	}
+	switch req.Mode {
+	case ModeSecurity:
+		args = append(args, "--security")
+	case ModePackages:
+		args = append(args, req.Packages...)
+	}
+	return [][]string{args}
+}
+
+// MatchPackage returns the first shell-style pattern matching the package
+// name, or "" if none does. Architecture-qualified deb names (name:arch) also
+// match on the bare name. An error is returned for a malformed pattern.
+func MatchPackage(name string, patterns []string) (string, error) {
+	bare, _, _ := strings.Cut(name, ":")
+	for _, pattern := range patterns {
+		matched, err := path.Match(pattern, name)
+		if err != nil {
+			return "", err
+		}
+		if matched {
+			return pattern, nil
+		}
+		if bare != name {
+			if matched, _ := path.Match(pattern, bare); matched {
+				return pattern, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// runStreaming runs a command, passing each line of its combined output to
+// progress, and returns its exit code
+func runStreaming(ctx context.Context, args []string, progress ProgressFunc) (int, error) {
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = append(os.Environ(), "DEBIAN_FRONTEND=noninteractive", "LC_ALL=C")
+	// Give the package manager a chance to stop cleanly when cancelled
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(syscall.SIGTERM)
+	}
+	cmd.WaitDelay = cancelWaitDelay
+
+	reader, writer := io.Pipe()
+	cmd.Stdout = writer
+	cmd.Stderr = writer
+
+	if err := cmd.Start(); err != nil {
+		return -1, fmt.Errorf("failed to start %s: %w", args[0], err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scanner := bufio.NewScanner(reader)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			if progress != nil {
+				progress(scanner.Text())
+			}
+		}
+		// Keep draining so the command never blocks on a full pipe
+		_, _ = io.Copy(io.Discard, reader)
+	}()
+
+	waitErr := cmd.Wait()
+	_ = writer.Close()
+	<-done
+
+	if waitErr != nil {
+		var exitErr *exec.ExitError
+		if errors.As(waitErr, &exitErr) {
+			return exitErr.ExitCode(), fmt.Errorf("%s exited with code %d", args[0], exitErr.ExitCode())
+		}
+		return -1, fmt.Errorf("failed to run %s: %w", args[0], waitErr)
+	}
+
+	return 0, nil
+}
+
+// installedVersions reads installed package versions from the native database
+func installedVersions(packageManager string) (map[string]string, error) {
+	versions := make(map[string]string)
+
+	if packageManager == "apt" {
+		db, err := packages.ReadDpkgStatus("/")
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range db.Packages {
+			if record.State == packages.DpkgStateInstalled {
+				versions[record.Key(db.NativeArch)] = record.Version
+			}
+		}
+		return versions, nil
+	}
+
+	records, err := rpmdb.Read("/")
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		key := record.Name + "." + record.Arch
+		// Install-only packages (kernel) keep several versions; track the set
+		if existing, ok := versions[key]; ok {
+			versions[key] = existing + ", " + record.EVR()
+			continue
+		}
+		versions[key] = record.EVR()
+	}
+	return versions, nil
+}
+
+// diffVersions lists the packages whose version differs between snapshots
+func diffVersions(before, after map[string]string) []PackageChange {
+	changes := []PackageChange{}
+
+	for name, to := range after {
+		if from := before[name]; from != to {
+			changes = append(changes, PackageChange{Name: name, From: from, To: to})
+		}
+	}
+	for name, from := range before {
+		if _, ok := after[name]; !ok {
+			changes = append(changes, PackageChange{Name: name, From: from})
+		}
+	}
+
+	slices.SortFunc(changes, func(a, b PackageChange) int { return strings.Compare(a.Name, b.Name) })
+	return changes
+}
+
+// rebootRequired reports whether the host needs a reboot after the run
+func (r *Runner) rebootRequired(packageManager string, changes []PackageChange) bool {
+	if packageManager == "apt" {
+		_, err := os.Stat(rebootRequiredFile)
+		return err == nil
+	}
+
+	// needs-restarting -r exits 1 when a reboot is required
+	if _, err := exec.LookPath("needs-restarting"); err == nil {
+		err := exec.Command("needs-restarting", "-r").Run()
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode() == 1
+		}
+		if err == nil {
+			return false
+		}
+		r.logger.WithError(err).Debug("Failed to run needs-restarting")
+	}
+
+	for _, change := range changes {
+		name := change.Name
+		if idx := strings.LastIndex(name, "."); idx > 0 {
+			name = name[:idx]
+		}
+		if slices.Contains(rebootPackages, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+package patching
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     Request
+		wantErr bool
+	}{
+		{name: "all", req: Request{Mode: ModeAll}},
+		{name: "security", req: Request{Mode: ModeSecurity}},
+		{name: "packages", req: Request{Mode: ModePackages, Packages: []string{"openssl", "libc6:i386", "python3.11", "g++"}}},
+		{name: "no packages", req: Request{Mode: ModePackages}, wantErr: true},
+		{name: "option injection", req: Request{Mode: ModePackages, Packages: []string{"--allow-downgrades"}}, wantErr: true},
+		{name: "whitespace", req: Request{Mode: ModePackages, Packages: []string{"openssl bash"}}, wantErr: true},
+		{name: "c++ packages", req: Request{Mode: ModePackages, Packages: []string{"gcc-c++", "libstdc++6:amd64", "x"}}},
+		{name: "trailing minus removes", req: Request{Mode: ModePackages, Packages: []string{"pkg-"}}, wantErr: true},
+		{name: "trailing plus installs", req: Request{Mode: ModePackages, Packages: []string{"pkg+"}}, wantErr: true},
+		{name: "trailing minus before arch", req: Request{Mode: ModePackages, Packages: []string{"openssh-server-:amd64"}}, wantErr: true},
+		{name: "trailing minus after arch", req: Request{Mode: ModePackages, Packages: []string{"openssh-server:amd64-"}}, wantErr: true},
+		{name: "empty arch", req: Request{Mode: ModePackages, Packages: []string{"openssl:"}}, wantErr: true},
+		{name: "unknown mode", req: Request{Mode: "everything"}, wantErr: true},
+		{name: "empty mode", req: Request{}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRequest(tt.req)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestDNFCommands(t *testing.T) {
+	assert.Equal(t, [][]string{{"dnf", "-y", "upgrade"}},
+		dnfCommands("dnf", Request{Mode: ModeAll}))
+	assert.Equal(t, [][]string{{"yum", "-y", "upgrade", "--security"}},
+		dnfCommands("yum", Request{Mode: ModeSecurity}))
+	assert.Equal(t, [][]string{{"dnf", "-y", "upgrade", "openssl", "curl"}},
+		dnfCommands("dnf", Request{Mode: ModePackages, Packages: []string{"openssl", "curl"}}))
+	assert.Equal(t, [][]string{{"dnf", "-y", "upgrade", "--exclude=kernel*", "--security"}},
+		dnfCommands("dnf", Request{Mode: ModeSecurity, Exclude: []string{"kernel*"}}))
+}
+
+func TestMatchPackage(t *testing.T) {
+	patterns := []string{"kernel*", "linux-image-*", "postgresql-1?"}
+
+	tests := []struct {
+		name    string
+		pattern string
+	}{
+		{"kernel.x86_64", "kernel*"},
+		{"kernel-core", "kernel*"},
+		{"linux-image-6.1.0-13-amd64", "linux-image-*"},
+		{"linux-image-6.1.0-13-amd64:amd64", "linux-image-*"},
+		{"postgresql-15", "postgresql-1?"},
+		{"postgresql-common", ""},
+		{"openssl", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pattern, err := MatchPackage(tt.name, patterns)
+			require.NoError(t, err)
+			assert.Equal(t, tt.pattern, pattern)
+		})
+	}
+
+	_, err := MatchPackage("openssl", []string{"[openssl"})
+	assert.Error(t, err)
+}
+
+func TestRunner_aptCommands(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	runner := New(logger)
+
+	commands, err := runner.aptCommands(Request{Mode: ModePackages, Packages: []string{"openssl"}})
+	require.NoError(t, err)
+	require.Len(t, commands, 2)
+	assert.Equal(t, []string{"apt-get", "update", "-q"}, commands[0])
+	assert.Equal(t, []string{"install", "--only-upgrade", "openssl"}, commands[1][len(commands[1])-3:])
+
+	commands, err = runner.aptCommands(Request{Mode: ModeAll})
+	require.NoError(t, err)
+	require.Len(t, commands, 2)
+	assert.Equal(t, "upgrade", commands[1][len(commands[1])-1])
+
+	_, err = runner.aptCommands(Request{Mode: ModePackages, Packages: []string{"linux-image-amd64"}, Exclude: []string{"linux-image-*"}})
+	assert.Error(t, err)
+}
+
+func TestDiffVersions(t *testing.T) {
+	before := map[string]string{
+		"openssl.x86_64": "1:3.0.7-16.el9_2",
+		"bash.x86_64":    "5.1.8-6.el9_1",
+		"old.noarch":     "1.0-1",
+	}
+	after := map[string]string{
+		"openssl.x86_64": "1:3.0.7-18.el9_2",
+		"bash.x86_64":    "5.1.8-6.el9_1",
+		"kernel.x86_64":  "5.14.0-284.25.1.el9_2, 5.14.0-284.30.1.el9_2",
+	}
+
+	assert.Equal(t, []PackageChange{
+		{Name: "kernel.x86_64", To: "5.14.0-284.25.1.el9_2, 5.14.0-284.30.1.el9_2"},
+		{Name: "old.noarch", From: "1.0-1"},
+		{Name: "openssl.x86_64", From: "1:3.0.7-16.el9_2", To: "1:3.0.7-18.el9_2"},
+	}, diffVersions(before, after))
+
+	assert.Empty(t, diffVersions(before, before))
+}
+
+func TestRunStreaming(t *testing.T) {
+	var lines []string
+	code, err := runStreaming(t.Context(), []string{"sh", "-c", "echo one; echo two >&2; exit 3"}, func(line string) {
+		lines = append(lines, line)
+	})
+
+	assert.Error(t, err)
+	assert.Equal(t, 3, code)
+	assert.ElementsMatch(t, []string{"one", "two"}, lines)
+}
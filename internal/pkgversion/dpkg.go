@@ -0,0 +1,119 @@
+package pkgversion
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CompareDpkg compares two Debian versions the way dpkg --compare-versions
+// does: epochs numerically, then upstream version and revision with
+// verrevcmp, where '~' sorts before anything, even the end of the string.
+func CompareDpkg(a, b string) int {
+	va := parseEVR(a)
+	vb := parseEVR(b)
+
+	if cmp := compareEpoch(va.epoch, vb.epoch); cmp != 0 {
+		return cmp
+	}
+	if cmp := verrevcmp(va.version, vb.version); cmp != 0 {
+		return cmp
+	}
+	return verrevcmp(va.revision, vb.revision)
+}
+
+// compareEpoch compares two epochs numerically. Unparsable epochs compare as
+// strings so that the result is still stable.
+func compareEpoch(a, b string) int {
+	ea, errA := strconv.ParseUint(a, 10, 64)
+	eb, errB := strconv.ParseUint(b, 10, 64)
+	if errA != nil || errB != nil {
+		return strings.Compare(a, b)
+	}
+
+	switch {
+	case ea < eb:
+		return -1
+	case ea > eb:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// dpkgOrder is the weight of a character in the non-digit part of verrevcmp
+func dpkgOrder(s string, i int) int {
+	if i >= len(s) {
+		return 0
+	}
+
+	c := s[i]
+	switch {
+	case c >= '0' && c <= '9':
+		return 0
+	case (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+		return int(c)
+	case c == '~':
+		return -1
+	default:
+		return int(c) + 256
+	}
+}
+
+// verrevcmp is dpkg's comparison of upstream versions and revisions:
+// alternating non-digit parts, compared by dpkgOrder, and digit parts,
+// compared numerically
+func verrevcmp(a, b string) int {
+	i, j := 0, 0
+	isDigit := func(s string, k int) bool { return k < len(s) && s[k] >= '0' && s[k] <= '9' }
+
+	for i < len(a) || j < len(b) {
+		for (i < len(a) && !isDigit(a, i)) || (j < len(b) && !isDigit(b, j)) {
+			ac := dpkgOrder(a, i)
+			bc := dpkgOrder(b, j)
+			if ac != bc {
+				return sign(ac - bc)
+			}
+			i++
+			j++
+		}
+
+		for i < len(a) && a[i] == '0' {
+			i++
+		}
+		for j < len(b) && b[j] == '0' {
+			j++
+		}
+
+		firstDiff := 0
+		for isDigit(a, i) && isDigit(b, j) {
+			if firstDiff == 0 {
+				firstDiff = int(a[i]) - int(b[j])
+			}
+			i++
+			j++
+		}
+		if isDigit(a, i) {
+			return 1
+		}
+		if isDigit(b, j) {
+			return -1
+		}
+		if firstDiff != 0 {
+			return sign(firstDiff)
+		}
+	}
+
+	return 0
+}
+
+// sign reduces a difference to -1, 0 or 1
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,41 @@
+package pkgversion
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareDpkg(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.0", "1.0-0", 0},
+		{"0:1.0-1", "1.0-1", 0},
+		{"1.0-1", "1.0-2", -1},
+		{"1.2.3", "1.10", -1},
+		{"1.0~rc1", "1.0", -1},
+		{"1.0~rc1", "1.0~rc2", -1},
+		{"1.0", "1.0+dfsg", -1},
+		{"1.0a", "1.0", 1},
+		{"1:0.1", "2.0", 1},
+		{"2.30-1", "2.30-1ubuntu1", -1},
+		{"2.31-13+deb11u5", "2.31-13+deb11u6", -1},
+		{"1.0-1", "1.0-1+b1", -1},
+		{"1.001", "1.1", 0},
+		// Debian policy example: ~~ < ~~a < ~ < (empty) < a
+		{"1.0~~", "1.0~~a", -1},
+		{"1.0~~a", "1.0~", -1},
+		{"1.0~", "1.0", -1},
+		{"1.0", "1.0a", -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+" vs "+tt.b, func(t *testing.T) {
+			assert.Equal(t, tt.expected, CompareDpkg(tt.a, tt.b))
+			assert.Equal(t, -tt.expected, CompareDpkg(tt.b, tt.a))
+		})
+	}
+}
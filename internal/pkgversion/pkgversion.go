@@ -0,0 +1,167 @@
+// Package pkgversion compares distribution package versions using the
+// ordering rules of the package managers that produced them, and classifies
+// the difference between an installed and an available version.
+package pkgversion
+
+import "strings"
+
+// Scheme selects the version ordering rules of a package manager
+type Scheme string
+
+const (
+	// SchemeNone is for versions without a known ordering (snap, flatpak, apk)
+	SchemeNone Scheme = ""
+	// SchemeDpkg is Debian's [epoch:]upstream[-revision] ordering
+	SchemeDpkg Scheme = "dpkg"
+	// SchemeRPM is rpm's [epoch:]version[-release] ordering (rpmvercmp),
+	// also followed by pacman's vercmp
+	SchemeRPM Scheme = "rpm"
+)
+
+// Compare returns -1, 0 or 1 if a is older than, equal to or newer than b.
+// SchemeNone falls back to a plain string comparison.
+func (s Scheme) Compare(a, b string) int {
+	switch s {
+	case SchemeDpkg:
+		return CompareDpkg(a, b)
+	case SchemeRPM:
+		return CompareRPM(a, b)
+	default:
+		return strings.Compare(a, b)
+	}
+}
+
+// compareFragment compares a single version or revision without an epoch
+func (s Scheme) compareFragment(a, b string) int {
+	switch s {
+	case SchemeDpkg:
+		return verrevcmp(a, b)
+	case SchemeRPM:
+		return rpmvercmp(a, b)
+	default:
+		return strings.Compare(a, b)
+	}
+}
+
+// UpdateKind describes which part of a version an update changes
+type UpdateKind string
+
+const (
+	UpdateKindNone      UpdateKind = ""
+	UpdateKindEpoch     UpdateKind = "epoch"
+	UpdateKindMajor     UpdateKind = "major"
+	UpdateKindMinor     UpdateKind = "minor"
+	UpdateKindPatch     UpdateKind = "patch"
+	UpdateKindRevision  UpdateKind = "revision" // Only the packaging revision/release changes
+	UpdateKindDowngrade UpdateKind = "downgrade"
+)
+
+// Classify describes the change from current to available. It returns
+// UpdateKindNone when the versions are equal or the scheme cannot compare
+// them, and UpdateKindDowngrade when available is older than current.
+func Classify(scheme Scheme, current, available string) UpdateKind {
+	if scheme == SchemeNone || current == "" || available == "" {
+		return UpdateKindNone
+	}
+
+	switch cmp := scheme.Compare(available, current); {
+	case cmp == 0:
+		return UpdateKindNone
+	case cmp < 0:
+		return UpdateKindDowngrade
+	}
+
+	from := parseEVR(current)
+	to := parseEVR(available)
+	if from.epoch != to.epoch {
+		return UpdateKindEpoch
+	}
+	if scheme.compareFragment(to.version, from.version) == 0 {
+		return UpdateKindRevision
+	}
+
+	fromSegments := segments(from.version)
+	toSegments := segments(to.version)
+	for i := 0; i < len(fromSegments) || i < len(toSegments); i++ {
+		if i < len(fromSegments) && i < len(toSegments) && scheme.compareFragment(fromSegments[i], toSegments[i]) == 0 {
+			continue
+		}
+		switch i {
+		case 0:
+			return UpdateKindMajor
+		case 1:
+			return UpdateKindMinor
+		default:
+			return UpdateKindPatch
+		}
+	}
+
+	// Versions differing only in separators, e.g. 1.0 and 1_0
+	return UpdateKindPatch
+}
+
+// evr is a version split into epoch, version and revision/release
+type evr struct {
+	epoch    string
+	version  string
+	revision string
+}
+
+// parseEVR splits [epoch:]version[-revision]. A missing epoch is "0" and
+// leading zeros are stripped so that "0:1.0" and "1.0" have equal epochs.
+func parseEVR(value string) evr {
+	var result evr
+
+	result.epoch = "0"
+	if idx := strings.Index(value, ":"); idx >= 0 {
+		if epoch := strings.TrimLeft(value[:idx], "0"); epoch != "" {
+			result.epoch = epoch
+		}
+		value = value[idx+1:]
+	}
+
+	if idx := strings.LastIndex(value, "-"); idx >= 0 {
+		result.revision = value[idx+1:]
+		value = value[:idx]
+	}
+	result.version = value
+
+	return result
+}
+
+// segments splits a version into its alphanumeric runs, e.g. "1.2.3a" into
+// "1", "2", "3", "a"
+func segments(version string) []string {
+	var result []string
+
+	start := -1
+	for i, r := range version {
+		alnum := isASCIIDigit(r) || isASCIIAlpha(r)
+		switch {
+		case alnum && start < 0:
+			start = i
+		case start >= 0 && (!alnum || isASCIIDigit(r) != isASCIIDigit(rune(version[start]))):
+			result = append(result, version[start:i])
+			start = -1
+			if alnum {
+				start = i
+			}
+		}
+	}
+	if start >= 0 {
+		result = append(result, version[start:])
+	}
+
+	return result
+}
+
+// isASCIIDigit reports whether r is 0-9. Package managers compare bytes in the
+// C locale, so unicode.IsDigit is too broad.
+func isASCIIDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+// isASCIIAlpha reports whether r is an ASCII letter
+func isASCIIAlpha(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
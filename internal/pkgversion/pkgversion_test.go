@@ -0,0 +1,46 @@
+package pkgversion
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name      string
+		scheme    Scheme
+		current   string
+		available string
+		expected  UpdateKind
+	}{
+		{"dpkg revision", SchemeDpkg, "2.31-13+deb11u5", "2.31-13+deb11u6", UpdateKindRevision},
+		{"dpkg patch", SchemeDpkg, "1.2.3-1", "1.2.4-1", UpdateKindPatch},
+		{"dpkg minor", SchemeDpkg, "1.2.3-1", "1.3.0-1", UpdateKindMinor},
+		{"dpkg major", SchemeDpkg, "1.2-1", "2.0-1", UpdateKindMajor},
+		{"dpkg epoch", SchemeDpkg, "1.2-1", "1:1.0-1", UpdateKindEpoch},
+		{"dpkg downgrade", SchemeDpkg, "1.2-1", "1.1-1", UpdateKindDowngrade},
+		{"dpkg equal", SchemeDpkg, "1.2-1", "1.2-1", UpdateKindNone},
+		{"dpkg letter suffix", SchemeDpkg, "1.1.1k-1", "1.1.1l-1", UpdateKindPatch},
+		{"rpm release", SchemeRPM, "5.14.0-284.25.1.el9_2", "5.14.0-284.30.1.el9_2", UpdateKindRevision},
+		{"rpm epoch", SchemeRPM, "3.0.7-16.el9", "1:3.0.7-17.el9", UpdateKindEpoch},
+		{"rpm minor", SchemeRPM, "2:8.2.2637-20.el9_1", "2:8.3.0-1.el9", UpdateKindMinor},
+		{"rpm calendar version", SchemeRPM, "2023c-1.el9", "2024a-1.el9", UpdateKindMajor},
+		{"rpm downgrade", SchemeRPM, "252-14.el9_2.2", "252-14.el9_2.1", UpdateKindDowngrade},
+		{"unknown current version", SchemeRPM, "", "1.0-1", UpdateKindNone},
+		{"no scheme", SchemeNone, "1.0", "2.0", UpdateKindNone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Classify(tt.scheme, tt.current, tt.available))
+		})
+	}
+}
+
+func TestSegments(t *testing.T) {
+	assert.Equal(t, []string{"1", "2", "3", "a"}, segments("1.2.3a"))
+	assert.Equal(t, []string{"2023", "c"}, segments("2023c"))
+	assert.Equal(t, []string{"1", "0", "rc", "1"}, segments("1.0~rc1"))
+	assert.Empty(t, segments(""))
+}
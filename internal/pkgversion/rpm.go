@@ -0,0 +1,131 @@
+package pkgversion
+
+import "strings"
+
+// CompareRPM compares two [epoch:]version[-release] strings the way rpm does:
+// epochs numerically (missing is 0), then version and release with
+// rpmvercmp. The release is only compared when both sides have one, so
+// "1.0" matches any "1.0-N".
+func CompareRPM(a, b string) int {
+	va := parseEVR(a)
+	vb := parseEVR(b)
+
+	if cmp := compareEpoch(va.epoch, vb.epoch); cmp != 0 {
+		return cmp
+	}
+	if cmp := rpmvercmp(va.version, vb.version); cmp != 0 {
+		return cmp
+	}
+	if va.revision == "" || vb.revision == "" {
+		return 0
+	}
+	return rpmvercmp(va.revision, vb.revision)
+}
+
+// rpmvercmp is rpm's segment-wise version comparison. Separators are
+// ignored, numeric segments beat alphabetic ones, '~' sorts before
+// anything (pre-releases) and '^' after the base version but before any
+// further segment (snapshots).
+func rpmvercmp(a, b string) int {
+	if a == b {
+		return 0
+	}
+
+	isAlnum := func(c byte) bool {
+		return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+	}
+	isDigit := func(c byte) bool { return c >= '0' && c <= '9' }
+	isAlpha := func(c byte) bool { return isAlnum(c) && !isDigit(c) }
+
+	for len(a) > 0 || len(b) > 0 {
+		for len(a) > 0 && !isAlnum(a[0]) && a[0] != '~' && a[0] != '^' {
+			a = a[1:]
+		}
+		for len(b) > 0 && !isAlnum(b[0]) && b[0] != '~' && b[0] != '^' {
+			b = b[1:]
+		}
+
+		// Tilde sorts before everything, including the end of the string
+		if strings.HasPrefix(a, "~") || strings.HasPrefix(b, "~") {
+			if !strings.HasPrefix(a, "~") {
+				return 1
+			}
+			if !strings.HasPrefix(b, "~") {
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+
+		// Caret sorts after the end of the string but before anything else
+		if strings.HasPrefix(a, "^") || strings.HasPrefix(b, "^") {
+			if len(a) == 0 {
+				return -1
+			}
+			if len(b) == 0 {
+				return 1
+			}
+			if !strings.HasPrefix(a, "^") {
+				return 1
+			}
+			if !strings.HasPrefix(b, "^") {
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+
+		if len(a) == 0 || len(b) == 0 {
+			break
+		}
+
+		// Take the next segment of the same type from both strings
+		segmentOf := isAlpha
+		numeric := isDigit(a[0])
+		if numeric {
+			segmentOf = isDigit
+		}
+		endA := segmentEnd(a, segmentOf)
+		endB := segmentEnd(b, segmentOf)
+
+		// Segments of different types: numeric is newer
+		if endB == 0 {
+			if numeric {
+				return 1
+			}
+			return -1
+		}
+
+		segA, segB := a[:endA], b[:endB]
+		if numeric {
+			segA = strings.TrimLeft(segA, "0")
+			segB = strings.TrimLeft(segB, "0")
+			if len(segA) != len(segB) {
+				return sign(len(segA) - len(segB))
+			}
+		}
+		if cmp := strings.Compare(segA, segB); cmp != 0 {
+			return cmp
+		}
+
+		a, b = a[endA:], b[endB:]
+	}
+
+	switch {
+	case len(a) == 0 && len(b) == 0:
+		return 0
+	case len(a) == 0:
+		return -1
+	default:
+		return 1
+	}
+}
+
+// segmentEnd returns the length of the leading run of s matching inSegment
+func segmentEnd(s string, inSegment func(byte) bool) int {
+	end := 0
+	for end < len(s) && inSegment(s[end]) {
+		end++
+	}
+	return end
+}
@@ -0,0 +1,61 @@
+package pkgversion
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRPMVerCmp(t *testing.T) {
+	// Cases from rpm's own rpmvercmp test suite
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.0", "2.0", -1},
+		{"2.0.1", "2.0", 1},
+		{"2.0.1a", "2.0.1", 1},
+		{"5.5p1", "5.5p2", -1},
+		{"5.5p10", "5.5p1", 1},
+		{"10xyz", "10.1xyz", -1},
+		{"xyz10", "xyz10.1", -1},
+		{"xyz.4", "8", -1},
+		{"1b.fc17", "1.fc17", -1},
+		{"1.0~rc1", "1.0", -1},
+		{"1.0~rc1", "1.0~rc2", -1},
+		{"1.0~rc1~git123", "1.0~rc1", -1},
+		{"1.0^", "1.0", 1},
+		{"1.0^git1", "1.01", -1},
+		{"1.0^20160101", "1.0.1", -1},
+		{"1.0~rc1^git1", "1.0~rc1", 1},
+		{"1.010", "1.9", 1},
+		{"1.05", "1.5", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+" vs "+tt.b, func(t *testing.T) {
+			assert.Equal(t, tt.expected, rpmvercmp(tt.a, tt.b))
+			assert.Equal(t, -tt.expected, rpmvercmp(tt.b, tt.a))
+		})
+	}
+}
+
+func TestCompareRPM(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"5.14.0-284.25.1.el9_2", "5.14.0-284.30.1.el9_2", -1},
+		{"1:3.0.7-16.el9", "3.0.7-17.el9", 1},
+		{"0:1.0-1", "1.0-1", 0},
+		{"1.0", "1.0-5", 0},
+		{"252-14.el9_2.1", "252-14.el9_2.2", -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+" vs "+tt.b, func(t *testing.T) {
+			assert.Equal(t, tt.expected, CompareRPM(tt.a, tt.b))
+		})
+	}
+}
@@ -0,0 +1,266 @@
+// Package policy evaluates the host-side policy that restricts which remote
+// commands the agent obeys.
+//
+// The policy lives in /etc/patchmon/policy.yml:
+//
+//	default: allow
+//	commands:
+//	  update_agent: deny
+//	  apply_updates: allow
+//	timezone: Europe/Berlin
+//	maintenance_windows:
+//	  - days: [sat, sun]
+//	    start: "02:00"
+//	    end: "06:00"
+//	windowed_commands: [apply_updates]
+//	package_deny: ["kernel*", "linux-image-*"]
+//
+// Without a policy file every command is allowed.
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"patchmon-agent/internal/patching"
+
+	"github.com/spf13/viper"
+)
+
+// Policy actions
+const (
+	ActionAllow = "allow"
+	ActionDeny  = "deny"
+)
+
+// defaultWindowedCommands are the commands restricted to maintenance windows
+// when windowed_commands is not set: those that change the host
+var defaultWindowedCommands = []string{"apply_updates", "update_agent"}
+
+// Policy is the parsed policy file
+type Policy struct {
+	Default            string            `mapstructure:"default"`
+	Commands           map[string]string `mapstructure:"commands"`
+	Timezone           string            `mapstructure:"timezone"`
+	MaintenanceWindows []Window          `mapstructure:"maintenance_windows"`
+	WindowedCommands   []string          `mapstructure:"windowed_commands"`
+	PackageDeny        []string          `mapstructure:"package_deny"`
+
+	location *time.Location
+}
+
+// Window is a recurring maintenance window. End may be before Start for
+// windows that span midnight; such a window belongs to the day it starts on.
+type Window struct {
+	Days  []string `mapstructure:"days"`  // mon..sun, every day if empty
+	Start string   `mapstructure:"start"` // HH:MM
+	End   string   `mapstructure:"end"`   // HH:MM
+
+	days       [7]bool
+	start, end int // Minutes after midnight
+}
+
+// Command is a remote command to evaluate
+type Command struct {
+	Kind     string
+	Packages []string // Explicit packages for apply_updates
+}
+
+// Decision is the outcome of evaluating a command
+type Decision struct {
+	Allowed bool
+	Reason  string
+	// Exclude lists package patterns that must not be touched when the
+	// command is allowed to patch the host
+	Exclude []string
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// Default returns the policy used without a policy file, which allows
+// every command
+func Default() *Policy {
+	return &Policy{Default: ActionAllow, location: time.Local}
+}
+
+// Load reads and validates the policy file. A missing file yields the
+// default policy.
+func Load(path string) (*Policy, error) {
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		return Default(), nil
+	}
+
+	policyViper := viper.New()
+	policyViper.SetConfigFile(path)
+	policyViper.SetConfigType("yaml")
+
+	if err := policyViper.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("error reading policy file: %w", err)
+	}
+
+	p := &Policy{}
+	if err := policyViper.Unmarshal(p); err != nil {
+		return nil, fmt.Errorf("error unmarshaling policy: %w", err)
+	}
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("invalid policy %s: %w", path, err)
+	}
+
+	return p, nil
+}
+
+// validate checks the policy and prepares it for evaluation
+func (p *Policy) validate() error {
+	if p.Default == "" {
+		p.Default = ActionAllow
+	}
+	if p.Default != ActionAllow && p.Default != ActionDeny {
+		return fmt.Errorf("default must be %q or %q, got %q", ActionAllow, ActionDeny, p.Default)
+	}
+	for command, action := range p.Commands {
+		if action != ActionAllow && action != ActionDeny {
+			return fmt.Errorf("command %s: action must be %q or %q, got %q", command, ActionAllow, ActionDeny, action)
+		}
+	}
+
+	p.location = time.Local
+	if p.Timezone != "" {
+		location, err := time.LoadLocation(p.Timezone)
+		if err != nil {
+			return fmt.Errorf("timezone: %w", err)
+		}
+		p.location = location
+	}
+
+	for i := range p.MaintenanceWindows {
+		if err := p.MaintenanceWindows[i].Parse(); err != nil {
+			return fmt.Errorf("maintenance window %d: %w", i+1, err)
+		}
+	}
+
+	for _, pattern := range p.PackageDeny {
+		if _, err := patching.MatchPackage("", []string{pattern}); err != nil {
+			return fmt.Errorf("package_deny pattern %q: %w", pattern, err)
+		}
+	}
+
+	return nil
+}
+
+// Parse validates the window's days and times. It must be called before
+// Contains.
+func (w *Window) Parse() error {
+	if len(w.Days) == 0 {
+		for i := range w.days {
+			w.days[i] = true
+		}
+	}
+	for _, day := range w.Days {
+		if day == "*" {
+			for i := range w.days {
+				w.days[i] = true
+			}
+			continue
+		}
+		weekday, ok := weekdays[strings.ToLower(day)]
+		if !ok {
+			return fmt.Errorf("unknown day %q", day)
+		}
+		w.days[weekday] = true
+	}
+
+	var err error
+	if w.start, err = parseClock(w.Start); err != nil {
+		return fmt.Errorf("start: %w", err)
+	}
+	if w.end, err = parseClock(w.End); err != nil {
+		return fmt.Errorf("end: %w", err)
+	}
+	if w.start == w.end {
+		return fmt.Errorf("start and end must differ")
+	}
+
+	return nil
+}
+
+// parseClock parses HH:MM into minutes after midnight. 24:00 is accepted as
+// the end of the day.
+func parseClock(value string) (int, error) {
+	var hours, minutes int
+	if _, err := fmt.Sscanf(value, "%d:%d", &hours, &minutes); err != nil || len(value) != 5 {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	if hours < 0 || minutes < 0 || minutes > 59 || hours > 24 || (hours == 24 && minutes != 0) {
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+	return hours*60 + minutes, nil
+}
+
+// Contains reports whether t falls inside the window
+func (w *Window) Contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	if w.start < w.end {
+		return w.days[t.Weekday()] && minute >= w.start && minute < w.end
+	}
+	// Spans midnight: the evening of a listed day or the morning after it
+	yesterday := (t.Weekday() + 6) % 7
+	return (w.days[t.Weekday()] && minute >= w.start) || (w.days[yesterday] && minute < w.end)
+}
+
+// InMaintenanceWindow reports whether t falls inside any maintenance window.
+// Without windows there is no restriction.
+func (p *Policy) InMaintenanceWindow(t time.Time) bool {
+	if len(p.MaintenanceWindows) == 0 {
+		return true
+	}
+	t = t.In(p.location)
+	for i := range p.MaintenanceWindows {
+		if p.MaintenanceWindows[i].Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate decides whether a command may run at time now
+func (p *Policy) Evaluate(cmd Command, now time.Time) Decision {
+	action, ok := p.Commands[cmd.Kind]
+	if !ok {
+		action = p.Default
+	}
+	if action == ActionDeny {
+		return Decision{Reason: fmt.Sprintf("command %s is denied by policy", cmd.Kind)}
+	}
+
+	windowed := p.WindowedCommands
+	if windowed == nil {
+		windowed = defaultWindowedCommands
+	}
+	if slices.Contains(windowed, cmd.Kind) && !p.InMaintenanceWindow(now) {
+		return Decision{Reason: fmt.Sprintf("command %s is only allowed during maintenance windows", cmd.Kind)}
+	}
+
+	if cmd.Kind == "apply_updates" {
+		for _, name := range cmd.Packages {
+			if pattern, _ := patching.MatchPackage(name, p.PackageDeny); pattern != "" {
+				return Decision{Reason: fmt.Sprintf("package %s matches deny pattern %s", name, pattern)}
+			}
+		}
+		return Decision{Allowed: true, Reason: "allowed by policy", Exclude: p.PackageDeny}
+	}
+
+	return Decision{Allowed: true, Reason: "allowed by policy"}
+}
@@ -0,0 +1,170 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writePolicy(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "policy.yml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("missing file allows everything", func(t *testing.T) {
+		p, err := Load(filepath.Join(t.TempDir(), "policy.yml"))
+		require.NoError(t, err)
+		assert.True(t, p.Evaluate(Command{Kind: "update_agent"}, time.Now()).Allowed)
+		assert.True(t, p.Evaluate(Command{Kind: "apply_updates", Packages: []string{"kernel"}}, time.Now()).Allowed)
+	})
+
+	t.Run("full policy", func(t *testing.T) {
+		p, err := Load(writePolicy(t, `default: deny
+commands:
+  report_now: allow
+  apply_updates: allow
+timezone: UTC
+maintenance_windows:
+  - days: [sat, Sunday]
+    start: "22:00"
+    end: "02:00"
+package_deny:
+  - kernel*
+`))
+		require.NoError(t, err)
+		assert.Equal(t, ActionDeny, p.Default)
+		assert.Equal(t, map[string]string{"report_now": ActionAllow, "apply_updates": ActionAllow}, p.Commands)
+		assert.Equal(t, []string{"kernel*"}, p.PackageDeny)
+		require.Len(t, p.MaintenanceWindows, 1)
+		assert.Equal(t, 22*60, p.MaintenanceWindows[0].start)
+		assert.Equal(t, 2*60, p.MaintenanceWindows[0].end)
+	})
+
+	invalid := map[string]string{
+		"bad default":  "default: maybe\n",
+		"bad action":   "commands:\n  report_now: sometimes\n",
+		"bad timezone": "timezone: Mars/Olympus\n",
+		"bad day":      "maintenance_windows:\n  - days: [funday]\n    start: \"01:00\"\n    end: \"02:00\"\n",
+		"bad time":     "maintenance_windows:\n  - start: \"1am\"\n    end: \"02:00\"\n",
+		"empty window": "maintenance_windows:\n  - start: \"02:00\"\n    end: \"02:00\"\n",
+		"bad pattern":  "package_deny:\n  - \"[kernel\"\n",
+		"not yaml":     "commands: [\n",
+	}
+	for name, content := range invalid {
+		t.Run(name, func(t *testing.T) {
+			_, err := Load(writePolicy(t, content))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestParseClock(t *testing.T) {
+	tests := []struct {
+		value   string
+		minutes int
+		wantErr bool
+	}{
+		{"00:00", 0, false},
+		{"02:30", 150, false},
+		{"23:59", 1439, false},
+		{"24:00", 1440, false},
+		{"24:01", 0, true},
+		{"12:60", 0, true},
+		{"2:30", 0, true},
+		{"", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			minutes, err := parseClock(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.minutes, minutes)
+		})
+	}
+}
+
+func TestWindow_Contains(t *testing.T) {
+	// 2024-06-01 is a Saturday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, 6, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	daytime := Window{Days: []string{"sat"}, Start: "02:00", End: "06:00"}
+	require.NoError(t, daytime.Parse())
+	assert.True(t, daytime.Contains(at(1, 2, 0)))
+	assert.True(t, daytime.Contains(at(1, 5, 59)))
+	assert.False(t, daytime.Contains(at(1, 6, 0)))
+	assert.False(t, daytime.Contains(at(2, 3, 0)))
+
+	overnight := Window{Days: []string{"sat"}, Start: "22:00", End: "02:00"}
+	require.NoError(t, overnight.Parse())
+	assert.True(t, overnight.Contains(at(1, 23, 0)))
+	assert.True(t, overnight.Contains(at(2, 1, 30)))
+	assert.False(t, overnight.Contains(at(1, 1, 30)))
+	assert.False(t, overnight.Contains(at(2, 23, 0)))
+
+	everyDay := Window{Start: "00:00", End: "24:00"}
+	require.NoError(t, everyDay.Parse())
+	assert.True(t, everyDay.Contains(at(4, 12, 0)))
+}
+
+func TestPolicy_Evaluate(t *testing.T) {
+	p := &Policy{
+		Default:  ActionAllow,
+		Commands: map[string]string{"update_agent": ActionDeny},
+		MaintenanceWindows: []Window{
+			{Days: []string{"sat"}, Start: "02:00", End: "06:00"},
+		},
+		PackageDeny: []string{"kernel*", "linux-image-*"},
+	}
+	require.NoError(t, p.validate())
+	p.location = time.UTC
+
+	inside := time.Date(2024, 6, 1, 3, 0, 0, 0, time.UTC)
+	outside := time.Date(2024, 6, 3, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		cmd     Command
+		now     time.Time
+		allowed bool
+		exclude []string
+	}{
+		{name: "denied command", cmd: Command{Kind: "update_agent"}, now: inside},
+		{name: "default allow", cmd: Command{Kind: "report_now"}, now: outside, allowed: true},
+		{name: "outside window", cmd: Command{Kind: "apply_updates"}, now: outside},
+		{
+			name:    "inside window",
+			cmd:     Command{Kind: "apply_updates"},
+			now:     inside,
+			allowed: true,
+			exclude: []string{"kernel*", "linux-image-*"},
+		},
+		{name: "denied package", cmd: Command{Kind: "apply_updates", Packages: []string{"openssl", "linux-image-amd64"}}, now: inside},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision := p.Evaluate(tt.cmd, tt.now)
+			assert.Equal(t, tt.allowed, decision.Allowed, decision.Reason)
+			assert.NotEmpty(t, decision.Reason)
+			assert.Equal(t, tt.exclude, decision.Exclude)
+		})
+	}
+
+	// Windows only apply to the configured commands
+	p.WindowedCommands = []string{"report_now"}
+	assert.False(t, p.Evaluate(Command{Kind: "report_now"}, outside).Allowed)
+	assert.True(t, p.Evaluate(Command{Kind: "apply_updates"}, outside).Allowed)
+}
@@ -0,0 +1,118 @@
+// Package probation tracks a self-update until the new agent proves itself
+// healthy, so a broken release can be rolled back to the previous binary.
+//
+// After replacing its executable the agent records a pending probation. The
+// new agent, recognised by the SHA-256 of its executable, confirms it once it
+// reaches the server; a watchdog running the previous binary restores it if
+// the deadline passes first.
+package probation
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"patchmon-agent/internal/backups"
+)
+
+// Probation statuses
+const (
+	StatusPending    = "pending"     // Waiting for the new version to confirm
+	StatusConfirmed  = "confirmed"   // The new version came up healthy
+	StatusRolledBack = "rolled_back" // The previous binary was restored
+)
+
+// State is the persisted state of the last self-update
+type State struct {
+	Status          string    `json:"status"`
+	PreviousVersion string    `json:"previous_version"`
+	NewVersion      string    `json:"new_version"`
+	NewSHA256       string    `json:"new_sha256"`
+	Executable      string    `json:"executable"`
+	BackupPath      string    `json:"backup_path"`
+	InstalledAt     time.Time `json:"installed_at"`
+	Deadline        time.Time `json:"deadline"`
+	Reason          string    `json:"reason,omitempty"`
+}
+
+// Load reads the state file. A missing file yields nil.
+func Load(path string) (*State, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading update state: %w", err)
+	}
+
+	state := &State{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("error parsing update state %s: %w", path, err)
+	}
+	return state, nil
+}
+
+// Save writes the state file atomically
+func Save(path string, state *State) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("error creating state directory: %w", err)
+	}
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0600); err != nil {
+		return fmt.Errorf("error writing update state: %w", err)
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		_ = os.Remove(tempPath)
+		return fmt.Errorf("error writing update state: %w", err)
+	}
+	return nil
+}
+
+// PendingFor reports whether the state awaits confirmation from the binary
+// with the given SHA-256
+func (s *State) PendingFor(sha string) bool {
+	return s != nil && s.Status == StatusPending && s.NewSHA256 == sha
+}
+
+// Confirm marks a pending probation of the binary with the given SHA-256 as
+// passed. It reports whether there was one to confirm.
+func Confirm(path, sha string) (bool, error) {
+	state, err := Load(path)
+	if err != nil || !state.PendingFor(sha) {
+		return false, err
+	}
+	state.Status = StatusConfirmed
+	return true, Save(path, state)
+}
+
+// FileSHA256 returns the hex SHA-256 of a file
+func FileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Restore copies the backup over the executable
+func Restore(state *State) error {
+	return backups.Install(state.BackupPath, state.Executable)
+}
@@ -0,0 +1,110 @@
+package probation
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "update-state.json")
+
+	state, err := Load(path)
+	require.NoError(t, err)
+	assert.Nil(t, state)
+
+	saved := &State{
+		Status:          StatusPending,
+		PreviousVersion: "1.3.0",
+		NewVersion:      "1.3.1",
+		NewSHA256:       "5e2b",
+		Executable:      "/usr/local/bin/patchmon-agent",
+		BackupPath:      "/usr/local/bin/patchmon-agent.backup.20240601_100000",
+		InstalledAt:     time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC),
+		Deadline:        time.Date(2024, 6, 1, 10, 10, 0, 0, time.UTC),
+	}
+	require.NoError(t, Save(path, saved))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	state, err = Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, saved, state)
+
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0600))
+	_, err = Load(path)
+	assert.Error(t, err)
+}
+
+func TestConfirm(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "update-state.json")
+
+	// Nothing to confirm without a state file
+	confirmed, err := Confirm(path, "5e2b")
+	require.NoError(t, err)
+	assert.False(t, confirmed)
+
+	require.NoError(t, Save(path, &State{Status: StatusPending, NewVersion: "1.3.1", NewSHA256: "5e2b"}))
+
+	// Only the binary on probation can confirm it
+	confirmed, err = Confirm(path, "a1c9")
+	require.NoError(t, err)
+	assert.False(t, confirmed)
+
+	confirmed, err = Confirm(path, "5e2b")
+	require.NoError(t, err)
+	assert.True(t, confirmed)
+
+	state, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, StatusConfirmed, state.Status)
+	assert.False(t, state.PendingFor("5e2b"))
+
+	confirmed, err = Confirm(path, "5e2b")
+	require.NoError(t, err)
+	assert.False(t, confirmed)
+}
+
+func TestFileSHA256(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent")
+	require.NoError(t, os.WriteFile(path, []byte("abc"), 0755))
+
+	sum, err := FileSHA256(path)
+	require.NoError(t, err)
+	assert.Equal(t, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad", sum)
+
+	_, err = FileSHA256(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
+
+func TestRestore(t *testing.T) {
+	dir := t.TempDir()
+	state := &State{
+		Executable: filepath.Join(dir, "patchmon-agent"),
+		BackupPath: filepath.Join(dir, "patchmon-agent.backup.20240601_100000"),
+	}
+	require.NoError(t, os.WriteFile(state.Executable, []byte("broken release"), 0755))
+	require.NoError(t, os.WriteFile(state.BackupPath, []byte("previous release"), 0755))
+
+	require.NoError(t, Restore(state))
+
+	data, err := os.ReadFile(state.Executable)
+	require.NoError(t, err)
+	assert.Equal(t, "previous release", string(data))
+	info, err := os.Stat(state.Executable)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+
+	// The backup is kept for a later rollback
+	_, err = os.Stat(state.BackupPath)
+	assert.NoError(t, err)
+
+	state.BackupPath = filepath.Join(dir, "missing")
+	assert.Error(t, Restore(state))
+}
@@ -0,0 +1,197 @@
+// Package reporting coordinates report runs in serve mode.
+package reporting
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Reasons a report run is started
+const (
+	ReasonStartup       = "startup"        // First report after the service starts
+	ReasonSchedule      = "schedule"       // Periodic report
+	ReasonServerRequest = "server_request" // report_now from the server
+	ReasonPatched       = "patched"        // Packages changed by apply_updates
+	ReasonAgentUpdated  = "agent_updated"  // The agent binary was replaced
+	ReasonLocalRequest  = "local_request"  // Requested on the host, e.g. from the CLI
+)
+
+// RunFunc collects and sends a report. reasons lists every trigger the run
+// covers.
+type RunFunc func(ctx context.Context, reasons []string) error
+
+// RunInfo describes a finished run
+type RunInfo struct {
+	Reasons  []string  `json:"reasons"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// Status is a snapshot of the coordinator state
+type Status struct {
+	Running        bool       `json:"running"`
+	CurrentReasons []string   `json:"current_reasons,omitempty"`
+	CurrentStarted *time.Time `json:"current_started,omitempty"`
+	PendingReasons []string   `json:"pending_reasons,omitempty"`
+	Runs           int        `json:"runs"`
+	Last           *RunInfo   `json:"last,omitempty"`
+}
+
+// Coordinator runs at most one report at a time. Triggers that arrive while
+// a run is in flight are coalesced into a single follow-up run.
+type Coordinator struct {
+	ctx    context.Context
+	logger *logrus.Logger
+	run    RunFunc
+
+	mu             sync.Mutex
+	running        bool
+	currentReasons []string
+	currentStarted time.Time
+	pendingReasons []string
+	pendingWaiters []chan error
+	runs           int
+	last           *RunInfo
+	wg             sync.WaitGroup
+}
+
+// New creates a coordinator. Runs use ctx, so cancelling it aborts the run
+// in flight and fails any pending triggers.
+func New(ctx context.Context, logger *logrus.Logger, run RunFunc) *Coordinator {
+	return &Coordinator{
+		ctx:    ctx,
+		logger: logger,
+		run:    run,
+	}
+}
+
+// Trigger requests a report run for reason without waiting for it. The
+// returned channel receives the result of the run that covers the trigger.
+func (c *Coordinator) Trigger(reason string) <-chan error {
+	result := make(chan error, 1)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.ctx.Err(); err != nil {
+		result <- err
+		return result
+	}
+
+	if !slices.Contains(c.pendingReasons, reason) {
+		c.pendingReasons = append(c.pendingReasons, reason)
+	}
+	c.pendingWaiters = append(c.pendingWaiters, result)
+
+	if c.running {
+		c.logger.WithFields(logrus.Fields{
+			"reason":  reason,
+			"running": c.currentReasons,
+		}).Debug("Report already running, queued follow-up run")
+		return result
+	}
+
+	c.running = true
+	reasons, waiters := c.takePendingLocked()
+	c.wg.Add(1)
+	go c.execute(reasons, waiters)
+
+	return result
+}
+
+// Run triggers a report run and waits for its result or for ctx to end
+func (c *Coordinator) Run(ctx context.Context, reason string) error {
+	select {
+	case err := <-c.Trigger(reason):
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Wait blocks until no run is in flight or pending
+func (c *Coordinator) Wait() {
+	c.wg.Wait()
+}
+
+// Status returns the current coordinator state
+func (c *Coordinator) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	status := Status{
+		Running:        c.running,
+		CurrentReasons: slices.Clone(c.currentReasons),
+		PendingReasons: slices.Clone(c.pendingReasons),
+		Runs:           c.runs,
+	}
+	if c.running {
+		started := c.currentStarted
+		status.CurrentStarted = &started
+	}
+	if c.last != nil {
+		last := *c.last
+		status.Last = &last
+	}
+	return status
+}
+
+// takePendingLocked moves the pending triggers into the current run
+func (c *Coordinator) takePendingLocked() ([]string, []chan error) {
+	reasons, waiters := c.pendingReasons, c.pendingWaiters
+	c.pendingReasons, c.pendingWaiters = nil, nil
+	c.currentReasons = reasons
+	c.currentStarted = time.Now()
+	return reasons, waiters
+}
+
+// execute runs reports until no triggers are pending
+func (c *Coordinator) execute(reasons []string, waiters []chan error) {
+	defer c.wg.Done()
+
+	for {
+		info := RunInfo{Reasons: reasons, Started: time.Now()}
+		c.logger.WithField("reasons", reasons).Info("Starting report run")
+
+		err := c.run(c.ctx, reasons)
+
+		info.Finished = time.Now()
+		fields := logrus.Fields{
+			"reasons":  reasons,
+			"duration": info.Finished.Sub(info.Started).Round(time.Millisecond).String(),
+		}
+		if err != nil {
+			info.Error = err.Error()
+			c.logger.WithError(err).WithFields(fields).Warn("Report run failed")
+		} else {
+			c.logger.WithFields(fields).Info("Report run finished")
+		}
+		for _, waiter := range waiters {
+			waiter <- err
+		}
+
+		c.mu.Lock()
+		c.runs++
+		c.last = &info
+
+		if ctxErr := c.ctx.Err(); ctxErr != nil {
+			for _, waiter := range c.pendingWaiters {
+				waiter <- ctxErr
+			}
+			c.pendingReasons, c.pendingWaiters = nil, nil
+		}
+		if len(c.pendingWaiters) == 0 {
+			c.running = false
+			c.currentReasons = nil
+			c.mu.Unlock()
+			return
+		}
+		reasons, waiters = c.takePendingLocked()
+		c.mu.Unlock()
+	}
+}
@@ -0,0 +1,150 @@
+package reporting
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingRun records each run and blocks until released
+type blockingRun struct {
+	mu       sync.Mutex
+	calls    [][]string
+	inFlight atomic.Int32
+	maxSeen  atomic.Int32
+	started  chan struct{}
+	release  chan error
+}
+
+func newBlockingRun() *blockingRun {
+	return &blockingRun{
+		started: make(chan struct{}, 10),
+		release: make(chan error),
+	}
+}
+
+func (b *blockingRun) run(ctx context.Context, reasons []string) error {
+	n := b.inFlight.Add(1)
+	defer b.inFlight.Add(-1)
+	if n > b.maxSeen.Load() {
+		b.maxSeen.Store(n)
+	}
+
+	b.mu.Lock()
+	b.calls = append(b.calls, reasons)
+	b.mu.Unlock()
+
+	b.started <- struct{}{}
+	select {
+	case err := <-b.release:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func newTestCoordinator(ctx context.Context, run RunFunc) *Coordinator {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	return New(ctx, logger, run)
+}
+
+func waitStarted(t *testing.T, b *blockingRun) {
+	t.Helper()
+	select {
+	case <-b.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("run did not start")
+	}
+}
+
+func TestCoordinator_CoalescesTriggers(t *testing.T) {
+	b := newBlockingRun()
+	c := newTestCoordinator(context.Background(), b.run)
+
+	first := c.Trigger(ReasonStartup)
+	waitStarted(t, b)
+
+	// Everything arriving during the first run joins one follow-up run
+	second := c.Trigger(ReasonSchedule)
+	third := c.Trigger(ReasonServerRequest)
+	fourth := c.Trigger(ReasonSchedule)
+
+	status := c.Status()
+	assert.True(t, status.Running)
+	assert.Equal(t, []string{ReasonStartup}, status.CurrentReasons)
+	assert.Equal(t, []string{ReasonSchedule, ReasonServerRequest}, status.PendingReasons)
+	assert.NotNil(t, status.CurrentStarted)
+
+	b.release <- nil
+	require.NoError(t, <-first)
+
+	waitStarted(t, b)
+	b.release <- errors.New("apt is locked")
+	for _, result := range []<-chan error{second, third, fourth} {
+		assert.EqualError(t, <-result, "apt is locked")
+	}
+
+	c.Wait()
+	assert.Equal(t, [][]string{{ReasonStartup}, {ReasonSchedule, ReasonServerRequest}}, b.calls)
+	assert.Equal(t, int32(1), b.maxSeen.Load())
+
+	status = c.Status()
+	assert.False(t, status.Running)
+	assert.Nil(t, status.CurrentStarted)
+	assert.Equal(t, 2, status.Runs)
+	require.NotNil(t, status.Last)
+	assert.Equal(t, "apt is locked", status.Last.Error)
+	assert.Equal(t, []string{ReasonSchedule, ReasonServerRequest}, status.Last.Reasons)
+}
+
+func TestCoordinator_Run(t *testing.T) {
+	var runs atomic.Int32
+	c := newTestCoordinator(context.Background(), func(ctx context.Context, reasons []string) error {
+		runs.Add(1)
+		return nil
+	})
+
+	require.NoError(t, c.Run(context.Background(), ReasonLocalRequest))
+	require.NoError(t, c.Run(context.Background(), ReasonLocalRequest))
+	assert.Equal(t, int32(2), runs.Load())
+
+	// A caller that stops waiting does not cancel the run
+	b := newBlockingRun()
+	c = newTestCoordinator(context.Background(), b.run)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- c.Run(ctx, ReasonServerRequest) }()
+	waitStarted(t, b)
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+	b.release <- nil
+	c.Wait()
+	assert.Equal(t, 1, c.Status().Runs)
+}
+
+func TestCoordinator_Shutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	b := newBlockingRun()
+	c := newTestCoordinator(ctx, b.run)
+
+	first := c.Trigger(ReasonStartup)
+	waitStarted(t, b)
+	pending := c.Trigger(ReasonSchedule)
+
+	cancel()
+	assert.ErrorIs(t, <-first, context.Canceled)
+	assert.ErrorIs(t, <-pending, context.Canceled)
+	c.Wait()
+
+	// No follow-up run happened and new triggers fail immediately
+	assert.Len(t, b.calls, 1)
+	assert.ErrorIs(t, <-c.Trigger(ReasonSchedule), context.Canceled)
+}
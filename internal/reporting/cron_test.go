@@ -0,0 +1,83 @@
+package reporting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCron_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+	}{
+		{"too few fields", "0 2 * *"},
+		{"too many fields", "0 2 * * * *"},
+		{"minute out of range", "60 * * * *"},
+		{"day of month zero", "0 0 0 * *"},
+		{"bad step", "*/0 * * * *"},
+		{"reversed range", "0 5-2 * * *"},
+		{"unknown name", "0 0 * foo *"},
+		{"unknown macro", "@fortnightly"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseCron(tt.spec)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestCronExpr_Next(t *testing.T) {
+	// Saturday 1 June 2024
+	from := time.Date(2024, 6, 1, 10, 17, 30, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		spec     string
+		from     time.Time
+		expected time.Time
+	}{
+		{"every minute", "* * * * *", from, time.Date(2024, 6, 1, 10, 18, 0, 0, time.UTC)},
+		{"hourly macro", "@hourly", from, time.Date(2024, 6, 1, 11, 0, 0, 0, time.UTC)},
+		{"step", "*/15 * * * *", from, time.Date(2024, 6, 1, 10, 30, 0, 0, time.UTC)},
+		{"list later today", "0 2,14 * * *", from, time.Date(2024, 6, 1, 14, 0, 0, 0, time.UTC)},
+		{"weekdays skips weekend", "0 2,14 * * mon-fri", from, time.Date(2024, 6, 3, 2, 0, 0, 0, time.UTC)},
+		{"sunday as 7", "30 6 * * 7", from, time.Date(2024, 6, 2, 6, 30, 0, 0, time.UTC)},
+		{"month name", "0 0 1 jan *", from, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"leap day", "0 0 29 2 *", from, time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"strictly after a match", "0 14 * * *", time.Date(2024, 6, 1, 14, 0, 0, 0, time.UTC), time.Date(2024, 6, 2, 14, 0, 0, 0, time.UTC)},
+		// Both day fields restricted: either may match, the 5th comes first
+		{"day of month or week", "0 0 5 * fri", from, time.Date(2024, 6, 5, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := ParseCron(tt.spec)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, expr.Next(tt.from))
+		})
+	}
+}
+
+func TestCronExpr_NextTimezone(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+
+	expr, err := ParseCron("0 2 * * *")
+	require.NoError(t, err)
+
+	// 02:00 Berlin time is 00:00 UTC in summer
+	next := expr.Next(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC).In(berlin))
+	assert.Equal(t, time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC), next.UTC())
+
+	// 02:30 does not exist when clocks go forward on 31 March 2024
+	expr, err = ParseCron("30 2 * * *")
+	require.NoError(t, err)
+	next = expr.Next(time.Date(2024, 3, 30, 12, 0, 0, 0, berlin))
+	assert.True(t, next.After(time.Date(2024, 3, 30, 12, 0, 0, 0, berlin)))
+	assert.True(t, next.Before(time.Date(2024, 4, 1, 3, 0, 0, 0, berlin)))
+}
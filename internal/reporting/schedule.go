@@ -0,0 +1,233 @@
+package reporting
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"patchmon-agent/internal/policy"
+	"patchmon-agent/pkg/models"
+)
+
+// maxStartupSplay bounds how long the first report after start-up is
+// delayed, so a fresh host still reports promptly with long intervals
+const maxStartupSplay = 5 * time.Minute
+
+// maxBlackoutSkips bounds how many blacked-out slots Next skips before
+// giving up on finding one outside the blackout windows
+const maxBlackoutSkips = 100000
+
+// ErrNoSlot is returned when a schedule never runs outside its blackout
+// windows
+var ErrNoSlot = errors.New("schedule has no report time outside the blackout windows")
+
+// Schedule decides when a host sends its periodic reports. By default
+// reports follow the interval, placed on a fixed per-host phase derived
+// from the machine ID, so hosts stay spread out after a mass reboot or an
+// interval change pushed to all of them. Cron expressions replace the
+// interval with fixed times. A random jitter is added on top of each run,
+// and no scheduled report runs inside a blackout window.
+type Schedule struct {
+	seed     uint64
+	interval time.Duration
+	jitter   time.Duration
+
+	crons     []*CronExpr
+	location  *time.Location
+	blackouts []policy.Window
+}
+
+// compiledSpec is a validated report schedule
+type compiledSpec struct {
+	crons     []*CronExpr
+	location  *time.Location
+	blackouts []policy.Window
+}
+
+// compileSpec parses the cron expressions, timezone and blackout windows of
+// a report schedule
+func compileSpec(spec models.ReportSchedule) (compiledSpec, error) {
+	compiled := compiledSpec{location: time.Local}
+
+	if spec.Timezone != "" {
+		location, err := time.LoadLocation(spec.Timezone)
+		if err != nil {
+			return compiledSpec{}, fmt.Errorf("timezone: %w", err)
+		}
+		compiled.location = location
+	}
+
+	for _, expr := range spec.Cron {
+		cron, err := ParseCron(expr)
+		if err != nil {
+			return compiledSpec{}, err
+		}
+		compiled.crons = append(compiled.crons, cron)
+	}
+
+	for i, window := range spec.BlackoutWindows {
+		blackout := policy.Window{Days: window.Days, Start: window.Start, End: window.End}
+		if err := blackout.Parse(); err != nil {
+			return compiledSpec{}, fmt.Errorf("blackout window %d: %w", i+1, err)
+		}
+		compiled.blackouts = append(compiled.blackouts, blackout)
+	}
+
+	return compiled, nil
+}
+
+// ValidateSpec checks a report schedule without applying it
+func ValidateSpec(spec models.ReportSchedule) error {
+	_, err := compileSpec(spec)
+	return err
+}
+
+// NewSchedule creates the schedule of the host with the given machine ID
+func NewSchedule(machineID string, interval, jitter time.Duration) *Schedule {
+	sum := sha256.Sum256([]byte(machineID))
+	s := &Schedule{seed: binary.BigEndian.Uint64(sum[:8]), location: time.Local}
+	s.SetInterval(interval)
+	s.SetJitter(jitter)
+	return s
+}
+
+// Interval returns the report interval
+func (s *Schedule) Interval() time.Duration {
+	return s.interval
+}
+
+// SetInterval changes the report interval. The host keeps its relative
+// phase within the new interval.
+func (s *Schedule) SetInterval(interval time.Duration) {
+	if interval < time.Minute {
+		interval = time.Minute
+	}
+	s.interval = interval
+	s.SetJitter(s.jitter)
+}
+
+// SetJitter changes the random delay added to each run. It is capped at half
+// the interval so runs never skip a slot.
+func (s *Schedule) SetJitter(jitter time.Duration) {
+	s.jitter = max(0, min(jitter, s.interval/2))
+}
+
+// SetSpec applies cron expressions, a timezone and blackout windows. An
+// empty spec returns to plain interval scheduling. On error the schedule is
+// left unchanged.
+func (s *Schedule) SetSpec(spec models.ReportSchedule) error {
+	compiled, err := compileSpec(spec)
+	if err != nil {
+		return err
+	}
+
+	previous := *s
+	s.crons, s.location, s.blackouts = compiled.crons, compiled.location, compiled.blackouts
+	if s.nextAllowed(time.Now()).IsZero() {
+		*s = previous
+		return ErrNoSlot
+	}
+	return nil
+}
+
+// Describe summarises the schedule for logs
+func (s *Schedule) Describe() string {
+	what := "every " + s.interval.String()
+	if len(s.crons) > 0 {
+		what = "cron"
+		for _, cron := range s.crons {
+			what += fmt.Sprintf(" %q", cron)
+		}
+	}
+	if len(s.blackouts) > 0 {
+		what += fmt.Sprintf(", %d blackout window(s)", len(s.blackouts))
+	}
+	return what + " (" + s.location.String() + ")"
+}
+
+// Splay returns the host's fixed offset within an interval
+func (s *Schedule) Splay(interval time.Duration) time.Duration {
+	return time.Duration(s.seed % uint64(interval))
+}
+
+// Startup returns when to send the first report after the service starts:
+// a per-host offset within the first few minutes plus jitter. If that falls
+// in a blackout window the first scheduled time after it is used instead.
+func (s *Schedule) Startup(now time.Time) time.Time {
+	window := min(s.interval, maxStartupSplay)
+	startup := now.Add(s.Splay(window)).Add(s.randomJitter())
+	if s.blackedOut(startup) {
+		return s.Next(startup)
+	}
+	return startup
+}
+
+// Next returns the time of the next periodic report after now, or the zero
+// time if there is none outside the blackout windows
+func (s *Schedule) Next(now time.Time) time.Time {
+	return s.nextAllowed(now)
+}
+
+// nextAllowed returns the first jittered slot after now outside the
+// blackout windows
+func (s *Schedule) nextAllowed(now time.Time) time.Time {
+	for range maxBlackoutSkips {
+		slot := s.nextSlot(now)
+		if slot.IsZero() {
+			return time.Time{}
+		}
+		next := slot.Add(s.randomJitter())
+		if !s.blackedOut(next) {
+			return next
+		}
+		now = slot
+	}
+	return time.Time{}
+}
+
+// blackedOut reports whether t falls inside a blackout window
+func (s *Schedule) blackedOut(t time.Time) bool {
+	t = t.In(s.location)
+	for i := range s.blackouts {
+		if s.blackouts[i].Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextSlot returns the first slot after now: the earliest cron match, or
+// without cron expressions the next interval boundary since the Unix epoch
+// shifted by the host's splay
+func (s *Schedule) nextSlot(now time.Time) time.Time {
+	if len(s.crons) > 0 {
+		var next time.Time
+		for _, cron := range s.crons {
+			candidate := cron.Next(now.In(s.location))
+			if !candidate.IsZero() && (next.IsZero() || candidate.Before(next)) {
+				next = candidate
+			}
+		}
+		return next
+	}
+
+	interval := int64(s.interval)
+	offset := int64(s.Splay(s.interval))
+
+	elapsed := now.UnixNano() - offset
+	slot := elapsed - elapsed%interval
+	if elapsed%interval < 0 {
+		slot -= interval
+	}
+	return time.Unix(0, slot+interval+offset)
+}
+
+func (s *Schedule) randomJitter() time.Duration {
+	if s.jitter <= 0 {
+		return 0
+	}
+	return rand.N(s.jitter)
+}
@@ -0,0 +1,125 @@
+package reporting
+
+import (
+	"testing"
+	"time"
+
+	"patchmon-agent/pkg/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedule_Splay(t *testing.T) {
+	a := NewSchedule("4c4c4544-0038-4810-8056-b4c04f4d4e32", time.Hour, 0)
+	b := NewSchedule("4c4c4544-0038-4810-8056-b4c04f4d4e32", time.Hour, 0)
+	c := NewSchedule("7f9a1c2e6d0b4f3a8e5d2c1b0a9f8e7d", time.Hour, 0)
+
+	// Deterministic per machine ID and spread between hosts
+	assert.Equal(t, a.Splay(time.Hour), b.Splay(time.Hour))
+	assert.NotEqual(t, a.Splay(time.Hour), c.Splay(time.Hour))
+	assert.Less(t, a.Splay(time.Hour), time.Hour)
+	assert.GreaterOrEqual(t, a.Splay(time.Hour), time.Duration(0))
+}
+
+func TestSchedule_Next(t *testing.T) {
+	s := NewSchedule("host-a", time.Hour, 0)
+	splay := s.Splay(time.Hour)
+	now := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+
+	next := s.Next(now)
+	assert.True(t, next.After(now))
+	assert.LessOrEqual(t, next.Sub(now), time.Hour)
+	// Slots sit at the same offset within every interval
+	assert.Equal(t, splay, time.Duration(next.UnixNano()%int64(time.Hour)))
+
+	// Asking again from the slot itself moves on by exactly one interval
+	assert.Equal(t, next.Add(time.Hour), s.Next(next))
+
+	// Changing the interval keeps the host on its own phase
+	s.SetInterval(15 * time.Minute)
+	next = s.Next(now)
+	assert.LessOrEqual(t, next.Sub(now), 15*time.Minute)
+	assert.Equal(t, s.Splay(15*time.Minute), time.Duration(next.UnixNano()%int64(15*time.Minute)))
+}
+
+func TestSchedule_Jitter(t *testing.T) {
+	s := NewSchedule("host-a", time.Hour, 2*time.Minute)
+	now := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	slot := s.nextSlot(now)
+
+	for i := 0; i < 100; i++ {
+		next := s.Next(now)
+		assert.False(t, next.Before(slot))
+		assert.Less(t, next.Sub(slot), 2*time.Minute)
+	}
+
+	// Jitter never exceeds half the interval
+	s = NewSchedule("host-a", 10*time.Minute, time.Hour)
+	assert.Equal(t, 5*time.Minute, s.jitter)
+}
+
+func TestSchedule_Startup(t *testing.T) {
+	now := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+
+	s := NewSchedule("host-a", 6*time.Hour, 0)
+	startup := s.Startup(now)
+	assert.False(t, startup.Before(now))
+	assert.Less(t, startup.Sub(now), maxStartupSplay)
+
+	// Short intervals spread start-up within the interval instead
+	s = NewSchedule("host-a", 2*time.Minute, 0)
+	assert.Less(t, s.Startup(now).Sub(now), 2*time.Minute)
+}
+
+func TestSchedule_SetSpec(t *testing.T) {
+	s := NewSchedule("host-a", time.Hour, 0)
+
+	require.NoError(t, s.SetSpec(models.ReportSchedule{
+		Cron:     []string{"0 2,14 * * mon-fri"},
+		Timezone: "UTC",
+	}))
+	// Saturday: the next report is on Monday at 02:00
+	now := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2024, 6, 3, 2, 0, 0, 0, time.UTC), s.Next(now))
+
+	// Invalid specs leave the schedule unchanged
+	assert.Error(t, s.SetSpec(models.ReportSchedule{Cron: []string{"0 25 * * *"}}))
+	assert.Error(t, s.SetSpec(models.ReportSchedule{Timezone: "Mars/Olympus"}))
+	assert.Error(t, s.SetSpec(models.ReportSchedule{BlackoutWindows: []models.BlackoutWindow{{Start: "9:00", End: "17:00"}}}))
+	assert.Equal(t, time.Date(2024, 6, 3, 2, 0, 0, 0, time.UTC), s.Next(now))
+
+	// An empty spec returns to the interval
+	require.NoError(t, s.SetSpec(models.ReportSchedule{}))
+	assert.LessOrEqual(t, s.Next(now).Sub(now), time.Hour)
+}
+
+func TestSchedule_Blackouts(t *testing.T) {
+	s := NewSchedule("host-a", 15*time.Minute, 0)
+	require.NoError(t, s.SetSpec(models.ReportSchedule{
+		Timezone: "UTC",
+		BlackoutWindows: []models.BlackoutWindow{
+			{Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "09:00", End: "17:00"},
+		},
+	}))
+
+	// Monday morning: no report until the window closes
+	now := time.Date(2024, 6, 3, 8, 55, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		next := s.Next(now)
+		assert.False(t, s.blackedOut(next), "report at %s", next)
+		now = next
+	}
+	assert.False(t, now.Before(time.Date(2024, 6, 3, 17, 0, 0, 0, time.UTC)))
+
+	// Start-up inside the window waits for it to close as well
+	startup := s.Startup(time.Date(2024, 6, 3, 12, 0, 0, 0, time.UTC))
+	assert.False(t, startup.Before(time.Date(2024, 6, 3, 17, 0, 0, 0, time.UTC)))
+
+	// A cron schedule that only fires inside a blackout is rejected
+	err := s.SetSpec(models.ReportSchedule{
+		Cron:            []string{"0 12 * * *"},
+		BlackoutWindows: []models.BlackoutWindow{{Start: "09:00", End: "17:00"}},
+	})
+	assert.ErrorIs(t, err, ErrNoSlot)
+}
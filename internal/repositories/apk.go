@@ -0,0 +1,114 @@
+package repositories
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"patchmon-agent/internal/constants"
+	"patchmon-agent/pkg/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// APKManager handles apk repository information collection
+type APKManager struct {
+	logger    *logrus.Logger
+	reposFile string
+}
+
+// NewAPKManager creates a new apk repository manager
+func NewAPKManager(logger *logrus.Logger) *APKManager {
+	return &APKManager{
+		logger:    logger,
+		reposFile: "/etc/apk/repositories",
+	}
+}
+
+// GetRepositories gets apk repository information
+func (a *APKManager) GetRepositories() ([]models.Repository, error) {
+	a.logger.WithField("file", a.reposFile).Debug("Parsing apk repositories file")
+	repositories, err := a.parseRepositoriesFile(a.reposFile)
+	if err != nil {
+		a.logger.WithError(err).WithField("file", a.reposFile).Error("Failed to parse apk repositories file")
+		return []models.Repository{}, err
+	}
+
+	a.logger.WithField("total", len(repositories)).Debug("Total repositories collected")
+	return repositories, nil
+}
+
+// parseRepositoriesFile parses /etc/apk/repositories
+func (a *APKManager) parseRepositoriesFile(filename string) ([]models.Repository, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			a.logger.WithError(err).WithField("file", filename).Debug("Failed to close file")
+		}
+	}()
+
+	var repositories []models.Repository
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		// Skip comments and empty lines
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if repo := a.parseRepositoryLine(line); repo != nil {
+			repositories = append(repositories, *repo)
+		}
+	}
+
+	return repositories, scanner.Err()
+}
+
+// parseRepositoryLine parses a single repository line. A line is either a
+// plain URL or "@tag URL"; tagged repositories are only used for packages
+// pinned to them with name@tag in /etc/apk/world.
+func (a *APKManager) parseRepositoryLine(line string) *models.Repository {
+	var tag string
+	url := line
+
+	if strings.HasPrefix(line, "@") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			a.logger.WithField("line", line).Debug("Skipping malformed tagged repository")
+			return nil
+		}
+		tag = strings.TrimPrefix(fields[0], "@")
+		url = fields[1]
+	}
+
+	if !isValidRepoURL(url) {
+		a.logger.WithField("url", url).Debug("Skipping unsupported repository URL")
+		return nil
+	}
+
+	// Alpine mirrors use <mirror>/<branch>/<repository>, e.g. .../alpine/v3.19/main
+	trimmed := strings.TrimSuffix(url, "/")
+	components := filepath.Base(trimmed)
+	distribution := filepath.Base(filepath.Dir(trimmed))
+
+	repoName := generateRepoName(url, distribution, components)
+	if tag != "" {
+		repoName += "@" + tag
+	}
+
+	return &models.Repository{
+		Name:         repoName,
+		URL:          url,
+		Distribution: distribution,
+		Components:   components,
+		RepoType:     constants.RepoTypeAPK,
+		IsEnabled:    true,
+		IsSecure:     isSecureURL(url),
+	}
+}
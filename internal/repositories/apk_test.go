@@ -0,0 +1,62 @@
+package repositories
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPKManager_parseRepositoryLine(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewAPKManager(logger)
+
+	tests := []struct {
+		name         string
+		input        string
+		expectNil    bool
+		expectedName string
+		expectedURL  string
+		expectedDist string
+		expectedComp string
+	}{
+		{
+			name:         "standard repository",
+			input:        "https://dl-cdn.alpinelinux.org/alpine/v3.19/main",
+			expectedName: "dl-cdn-alpinelinux-v3-19",
+			expectedURL:  "https://dl-cdn.alpinelinux.org/alpine/v3.19/main",
+			expectedDist: "v3.19",
+			expectedComp: "main",
+		},
+		{
+			name:         "tagged repository",
+			input:        "@testing https://dl-cdn.alpinelinux.org/alpine/edge/testing",
+			expectedName: "dl-cdn-alpinelinux-edge-testing@testing",
+			expectedURL:  "https://dl-cdn.alpinelinux.org/alpine/edge/testing",
+			expectedDist: "edge",
+			expectedComp: "testing",
+		},
+		{
+			name:      "local repository",
+			input:     "/media/cdrom/apks",
+			expectNil: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := manager.parseRepositoryLine(tt.input)
+			if tt.expectNil {
+				assert.Nil(t, result)
+				return
+			}
+			require.NotNil(t, result)
+			assert.Equal(t, tt.expectedName, result.Name)
+			assert.Equal(t, tt.expectedURL, result.URL)
+			assert.Equal(t, tt.expectedDist, result.Distribution)
+			assert.Equal(t, tt.expectedComp, result.Components)
+		})
+	}
+}
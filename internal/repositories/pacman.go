@@ -0,0 +1,206 @@
+package repositories
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"patchmon-agent/internal/constants"
+	"patchmon-agent/pkg/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// PacmanManager handles pacman repository information collection
+type PacmanManager struct {
+	logger     *logrus.Logger
+	configFile string
+}
+
+// pacmanRepoEntry represents a repository section of pacman.conf before processing
+type pacmanRepoEntry struct {
+	name    string
+	servers []string
+}
+
+// NewPacmanManager creates a new pacman repository manager
+func NewPacmanManager(logger *logrus.Logger) *PacmanManager {
+	return &PacmanManager{
+		logger:     logger,
+		configFile: "/etc/pacman.conf",
+	}
+}
+
+// GetRepositories gets pacman repository information
+func (p *PacmanManager) GetRepositories() ([]models.Repository, error) {
+	p.logger.WithField("file", p.configFile).Debug("Parsing pacman configuration")
+	entries, architecture, err := p.parseConfig(p.configFile)
+	if err != nil {
+		p.logger.WithError(err).WithField("file", p.configFile).Error("Failed to parse pacman configuration")
+		return []models.Repository{}, err
+	}
+
+	var repositories []models.Repository
+	for _, entry := range entries {
+		repositories = append(repositories, p.processRepoEntry(entry, architecture)...)
+	}
+
+	p.logger.WithField("total", len(repositories)).Debug("Total repositories collected")
+	return repositories, nil
+}
+
+// parseConfig parses pacman.conf, following Include directives, and returns the
+// repository sections in order together with the configured architecture
+func (p *PacmanManager) parseConfig(filename string) ([]*pacmanRepoEntry, string, error) {
+	var entries []*pacmanRepoEntry
+	var currentRepo *pacmanRepoEntry
+	architecture := "auto"
+
+	lines, err := p.readLines(filename)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for _, line := range lines {
+		// Section header [options] or [repo]
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section := strings.Trim(line, "[]")
+			if section == "options" {
+				currentRepo = nil
+				continue
+			}
+			currentRepo = &pacmanRepoEntry{name: section}
+			entries = append(entries, currentRepo)
+			continue
+		}
+
+		key, value, _ := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+
+		switch {
+		case currentRepo == nil && key == "Architecture":
+			if fields := strings.Fields(value); len(fields) > 0 {
+				architecture = fields[0]
+			}
+		case currentRepo != nil && key == "Server":
+			currentRepo.servers = append(currentRepo.servers, value)
+		case currentRepo != nil && key == "Include":
+			currentRepo.servers = append(currentRepo.servers, p.readIncludedServers(value)...)
+		}
+	}
+
+	return entries, architecture, nil
+}
+
+// readIncludedServers reads the Server lines from an included file such as a
+// mirrorlist. Include accepts glob patterns, matched in lexical order.
+func (p *PacmanManager) readIncludedServers(pattern string) []string {
+	var servers []string
+
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		p.logger.WithError(err).WithField("include", pattern).Warn("Invalid Include pattern")
+		return servers
+	}
+
+	for _, file := range files {
+		lines, err := p.readLines(file)
+		if err != nil {
+			p.logger.WithError(err).WithField("file", file).Warn("Failed to read included file")
+			continue
+		}
+		for _, line := range lines {
+			key, value, found := strings.Cut(line, "=")
+			if found && strings.TrimSpace(key) == "Server" {
+				servers = append(servers, strings.TrimSpace(value))
+			}
+		}
+	}
+
+	return servers
+}
+
+// readLines returns the non-empty, non-comment lines of a pacman config file
+func (p *PacmanManager) readLines(filename string) ([]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			p.logger.WithError(err).WithField("file", filename).Debug("Failed to close file")
+		}
+	}()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	return lines, scanner.Err()
+}
+
+// processRepoEntry expands server URLs for a repository and creates Repository models
+func (p *PacmanManager) processRepoEntry(entry *pacmanRepoEntry, architecture string) []models.Repository {
+	var repositories []models.Repository
+	var seen []string
+
+	if architecture == "auto" {
+		architecture = pacmanArchitecture()
+	}
+
+	for _, server := range entry.servers {
+		url := strings.ReplaceAll(server, "$repo", entry.name)
+		url = strings.ReplaceAll(url, "$arch", architecture)
+
+		if !isValidRepoURL(url) {
+			p.logger.WithField("url", url).Debug("Skipping unsupported server URL")
+			continue
+		}
+		if slices.Contains(seen, url) {
+			continue
+		}
+		seen = append(seen, url)
+
+		repositories = append(repositories, models.Repository{
+			Name:         entry.name,
+			URL:          url,
+			Distribution: entry.name,
+			RepoType:     constants.RepoTypePacman,
+			IsEnabled:    true,
+			IsSecure:     isSecureURL(url),
+		})
+	}
+
+	if len(repositories) == 0 {
+		p.logger.WithField("repo", entry.name).Debug("No valid remote servers found for repository")
+	}
+
+	return repositories
+}
+
+// pacmanArchitecture maps the Go architecture to the name pacman uses for
+// Architecture = auto
+func pacmanArchitecture() string {
+	switch runtime.GOARCH {
+	case "amd64":
+		return constants.ArchX86_64
+	case "arm64":
+		return constants.ArchAARCH64
+	case "386":
+		return "i686"
+	case "arm":
+		return "armv7h"
+	default:
+		return runtime.GOARCH
+	}
+}
@@ -0,0 +1,59 @@
+package repositories
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPacmanManager_GetRepositories(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewPacmanManager(logger)
+
+	tmpDir := t.TempDir()
+	mirrorlist := filepath.Join(tmpDir, "mirrorlist")
+	require.NoError(t, os.WriteFile(mirrorlist, []byte(`## Worldwide
+Server = https://geo.mirror.pkgbuild.com/$repo/os/$arch
+#Server = http://mirror.example.org/archlinux/$repo/os/$arch
+Server = https://mirror.rackspace.com/archlinux/$repo/os/$arch
+`), 0644))
+
+	manager.configFile = filepath.Join(tmpDir, "pacman.conf")
+	require.NoError(t, os.WriteFile(manager.configFile, []byte(`[options]
+HoldPkg     = pacman glibc
+Architecture = x86_64
+SigLevel    = Required DatabaseOptional
+
+[core]
+Include = `+mirrorlist+`
+
+[extra]
+Include = `+mirrorlist+`
+
+#[multilib]
+#Include = `+mirrorlist+`
+
+[custom]
+SigLevel = Optional TrustAll
+Server = file:///home/custompkgs
+Server = http://repo.example.com/$arch
+`), 0644))
+
+	repos, err := manager.GetRepositories()
+	require.NoError(t, err)
+	require.Len(t, repos, 5)
+
+	assert.Equal(t, "core", repos[0].Name)
+	assert.Equal(t, "https://geo.mirror.pkgbuild.com/core/os/x86_64", repos[0].URL)
+	assert.True(t, repos[0].IsSecure)
+	assert.Equal(t, "extra", repos[2].Name)
+	assert.Equal(t, "https://geo.mirror.pkgbuild.com/extra/os/x86_64", repos[2].URL)
+	assert.Equal(t, "custom", repos[4].Name)
+	assert.Equal(t, "http://repo.example.com/x86_64", repos[4].URL)
+	assert.False(t, repos[4].IsSecure)
+}
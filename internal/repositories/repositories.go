@@ -10,17 +10,23 @@ import (
 
 // Manager handles repository information collection
 type Manager struct {
-	logger     *logrus.Logger
-	aptManager *APTManager
-	dnfManager *DNFManager
+	logger        *logrus.Logger
+	aptManager    *APTManager
+	dnfManager    *DNFManager
+	zypperManager *ZypperManager
+	pacmanManager *PacmanManager
+	apkManager    *APKManager
 }
 
 // New creates a new repository manager
 func New(logger *logrus.Logger) *Manager {
 	return &Manager{
-		logger:     logger,
-		aptManager: NewAPTManager(logger),
-		dnfManager: NewDNFManager(logger),
+		logger:        logger,
+		aptManager:    NewAPTManager(logger),
+		dnfManager:    NewDNFManager(logger),
+		zypperManager: NewZypperManager(logger),
+		pacmanManager: NewPacmanManager(logger),
+		apkManager:    NewAPKManager(logger),
 	}
 }
 
@@ -36,6 +42,13 @@ func (m *Manager) GetRepositories() ([]models.Repository, error) {
 	case "dnf", "yum":
 		repos := m.dnfManager.GetRepositories()
 		return repos, nil
+	case "zypper":
+		repos := m.zypperManager.GetRepositories()
+		return repos, nil
+	case "pacman":
+		return m.pacmanManager.GetRepositories()
+	case "apk":
+		return m.apkManager.GetRepositories()
 	default:
 		m.logger.WithField("package_manager", packageManager).Warn("Unsupported package manager")
 		return []models.Repository{}, nil
@@ -60,5 +73,20 @@ func (m *Manager) detectPackageManager() string {
 		return "yum"
 	}
 
+	// Check for Zypper (SUSE/openSUSE)
+	if _, err := exec.LookPath("zypper"); err == nil {
+		return "zypper"
+	}
+
+	// Check for Pacman (Arch Linux and derivatives)
+	if _, err := exec.LookPath("pacman"); err == nil {
+		return "pacman"
+	}
+
+	// Check for APK (Alpine Linux)
+	if _, err := exec.LookPath("apk"); err == nil {
+		return "apk"
+	}
+
 	return "unknown"
 }
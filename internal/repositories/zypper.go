@@ -0,0 +1,180 @@
+package repositories
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"patchmon-agent/internal/constants"
+	"patchmon-agent/pkg/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ZypperManager handles zypper repository information collection
+type ZypperManager struct {
+	logger *logrus.Logger
+}
+
+// zypperRepoEntry represents a parsed zypper repository section before processing
+type zypperRepoEntry struct {
+	alias    string
+	name     string
+	baseurls []string
+	enabled  *bool // Pointer to distinguish between unset and false
+}
+
+// NewZypperManager creates a new zypper repository manager
+func NewZypperManager(logger *logrus.Logger) *ZypperManager {
+	return &ZypperManager{
+		logger: logger,
+	}
+}
+
+// GetRepositories gets zypper repository information
+func (z *ZypperManager) GetRepositories() []models.Repository {
+	var repositories []models.Repository
+
+	reposDir := "/etc/zypp/repos.d"
+	z.logger.WithField("path", reposDir).Debug("Searching for zypper repository files...")
+	repoFiles, err := filepath.Glob(filepath.Join(reposDir, "*.repo"))
+	if err != nil {
+		z.logger.WithError(err).Error("Failed to find repository files")
+		return repositories
+	}
+	z.logger.WithField("count", len(repoFiles)).Debug("Found repo files")
+
+	for _, file := range repoFiles {
+		z.logger.WithField("file", file).Debug("Parsing repository file")
+		repos, err := z.parseRepoFile(file)
+		if err != nil {
+			z.logger.WithError(err).WithField("file", file).Error("Failed to parse repository file")
+			continue
+		}
+		z.logger.WithFields(logrus.Fields{
+			"file":  file,
+			"count": len(repos),
+		}).Debug("Extracted repositories from file")
+		repositories = append(repositories, repos...)
+	}
+
+	z.logger.WithField("total", len(repositories)).Debug("Total repositories collected")
+	return repositories
+}
+
+// parseRepoFile parses a zypper .repo file and extracts repository information
+func (z *ZypperManager) parseRepoFile(filename string) ([]models.Repository, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			z.logger.WithError(err).WithField("file", filename).Debug("Failed to close file")
+		}
+	}()
+
+	var repositories []models.Repository
+	var currentRepo *zypperRepoEntry
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		// Skip empty lines and comments
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		// Check for section header [alias]
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			if currentRepo != nil {
+				repositories = append(repositories, z.processRepoEntry(currentRepo)...)
+			}
+
+			currentRepo = &zypperRepoEntry{
+				alias:    strings.Trim(line, "[]"),
+				baseurls: []string{},
+			}
+			continue
+		}
+
+		if currentRepo == nil {
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			z.logger.WithField("line", line).Debug("Skipping malformed line")
+			continue
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "name":
+			currentRepo.name = value
+		case "baseurl", "mirrorlist":
+			currentRepo.baseurls = append(currentRepo.baseurls, strings.Fields(value)...)
+		case "enabled":
+			enabled := value == "1" || strings.ToLower(value) == "true" || strings.ToLower(value) == "yes"
+			currentRepo.enabled = &enabled
+		}
+	}
+
+	// Don't forget the last repository
+	if currentRepo != nil {
+		repositories = append(repositories, z.processRepoEntry(currentRepo)...)
+	}
+
+	return repositories, scanner.Err()
+}
+
+// processRepoEntry processes a zypper repository entry and creates Repository models
+func (z *ZypperManager) processRepoEntry(entry *zypperRepoEntry) []models.Repository {
+	var repositories []models.Repository
+
+	isEnabled := true
+	if entry.enabled != nil {
+		isEnabled = *entry.enabled
+	}
+
+	if !isEnabled {
+		z.logger.WithField("alias", entry.alias).Debug("Skipping disabled repository")
+		return repositories
+	}
+
+	for _, url := range entry.baseurls {
+		if !isValidRepoURL(url) {
+			z.logger.WithField("url", url).Debug("Skipping unsupported repository URL")
+			continue
+		}
+
+		url = stripURLQuery(url)
+		repositories = append(repositories, models.Repository{
+			Name:         entry.alias,
+			URL:          url,
+			Distribution: entry.name,
+			RepoType:     constants.RepoTypeRPM,
+			IsEnabled:    isEnabled,
+			IsSecure:     isSecureURL(url),
+		})
+	}
+
+	if len(repositories) == 0 {
+		z.logger.WithField("alias", entry.alias).Debug("No valid remote URLs found for repository")
+	}
+
+	return repositories
+}
+
+// stripURLQuery removes the query string from a repository URL.
+// SUSE Customer Center repositories carry an authentication token in the query
+// string, which must not be sent to the server.
+func stripURLQuery(url string) string {
+	if idx := strings.Index(url, "?"); idx != -1 {
+		return url[:idx]
+	}
+	return url
+}
@@ -0,0 +1,58 @@
+package repositories
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestZypperManager_parseRepoFile(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewZypperManager(logger)
+
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "test.repo")
+
+	content := `[repo-oss]
+name=Main Repository
+enabled=1
+autorefresh=1
+baseurl=https://download.opensuse.org/distribution/leap/$releasever/repo/oss/
+type=rpm-md
+keeppackages=0
+
+[SLE_BCI]
+name=SLE BCI
+enabled=1
+baseurl=https://updates.suse.com/SUSE/Products/SLE-BCI/15-SP5/x86_64/product/?eyJhbGciOiJIUzI1NiJ9
+type=rpm-md
+
+[repo-debug]
+name=Debug Repository
+enabled=0
+baseurl=http://download.opensuse.org/debug/distribution/leap/$releasever/repo/oss/
+
+[local-dvd]
+name=Installation DVD
+enabled=1
+baseurl=hd:/?device=/dev/disk/by-id/usb-Flash
+`
+	require.NoError(t, os.WriteFile(testFile, []byte(content), 0644))
+
+	repos, err := manager.parseRepoFile(testFile)
+	require.NoError(t, err)
+	require.Len(t, repos, 2)
+
+	assert.Equal(t, "repo-oss", repos[0].Name)
+	assert.Equal(t, "Main Repository", repos[0].Distribution)
+	assert.True(t, repos[0].IsSecure)
+
+	// The SCC authentication token must be stripped from the URL
+	assert.Equal(t, "SLE_BCI", repos[1].Name)
+	assert.Equal(t, "https://updates.suse.com/SUSE/Products/SLE-BCI/15-SP5/x86_64/product/", repos[1].URL)
+}
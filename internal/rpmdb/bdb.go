@@ -0,0 +1,198 @@
+package rpmdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Reader for the Berkeley DB hash database rpm used for /var/lib/rpm/Packages
+// up to RHEL 8. Only what rpm writes is supported: an unencrypted hash
+// database whose values (header blobs) are stored inline or on overflow
+// pages. Pages are walked sequentially rather than through the hash buckets.
+// Integers are in the byte order of the host that created the database,
+// which is detected from the metadata magic.
+
+const (
+	bdbHashMagic      = 0x061561
+	bdbPageHeaderSize = 26
+
+	bdbPageHashUnsorted = 2
+	bdbPageOverflow     = 7
+	bdbPageHashMeta     = 8
+	bdbPageHash         = 13
+
+	bdbItemKeyData = 1
+	bdbItemOffPage = 3
+)
+
+// bdbFile is an open Berkeley DB hash database
+type bdbFile struct {
+	file     io.ReaderAt
+	order    binary.ByteOrder
+	pageSize uint32
+	lastPage uint32
+}
+
+// readBDB visits every value in a Berkeley DB hash Packages file
+func readBDB(path string, visit blobVisitor) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+
+	db, err := openBDB(file)
+	if err != nil {
+		return err
+	}
+
+	return db.walk(visit)
+}
+
+// openBDB validates the hash metadata page
+func openBDB(file io.ReaderAt) (*bdbFile, error) {
+	meta := make([]byte, 72)
+	if _, err := file.ReadAt(meta, 0); err != nil {
+		return nil, fmt.Errorf("failed to read bdb metadata: %w", err)
+	}
+
+	var order binary.ByteOrder
+	switch {
+	case binary.LittleEndian.Uint32(meta[12:16]) == bdbHashMagic:
+		order = binary.LittleEndian
+	case binary.BigEndian.Uint32(meta[12:16]) == bdbHashMagic:
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("not a berkeley db hash database")
+	}
+
+	if meta[25] != bdbPageHashMeta {
+		return nil, fmt.Errorf("%w: unexpected bdb metadata page type %d", errCorrupt, meta[25])
+	}
+	if meta[24] != 0 {
+		return nil, fmt.Errorf("encrypted berkeley db databases are not supported")
+	}
+
+	pageSize := order.Uint32(meta[20:24])
+	if pageSize < 512 || pageSize > 65536 || pageSize&(pageSize-1) != 0 {
+		return nil, fmt.Errorf("%w: invalid bdb page size %d", errCorrupt, pageSize)
+	}
+
+	return &bdbFile{
+		file:     file,
+		order:    order,
+		pageSize: pageSize,
+		lastPage: order.Uint32(meta[32:36]),
+	}, nil
+}
+
+// page reads a page by number
+func (db *bdbFile) page(number uint32) ([]byte, error) {
+	content := make([]byte, db.pageSize)
+	if _, err := db.file.ReadAt(content, int64(number)*int64(db.pageSize)); err != nil {
+		return nil, fmt.Errorf("failed to read bdb page %d: %w", number, err)
+	}
+	return content, nil
+}
+
+// walk visits the value of every key/value pair on every hash page
+func (db *bdbFile) walk(visit blobVisitor) error {
+	for number := uint32(1); number <= db.lastPage; number++ {
+		content, err := db.page(number)
+		if err != nil {
+			return err
+		}
+
+		pageType := content[25]
+		if pageType != bdbPageHash && pageType != bdbPageHashUnsorted {
+			continue
+		}
+
+		entries := int(db.order.Uint16(content[20:22]))
+		if bdbPageHeaderSize+entries*2 > len(content) {
+			return fmt.Errorf("%w: too many entries on bdb page %d", errCorrupt, number)
+		}
+
+		// Entries alternate key, value; values have odd indexes
+		for i := 1; i < entries; i += 2 {
+			value, err := db.readItem(content, i)
+			if err != nil {
+				return fmt.Errorf("bdb page %d entry %d: %w", number, i, err)
+			}
+			if value != nil {
+				visit(value)
+			}
+		}
+	}
+
+	return nil
+}
+
+// readItem returns the data of the i-th item on a hash page. Items are packed
+// from the end of the page downwards, so an item ends where the previous one
+// starts.
+func (db *bdbFile) readItem(content []byte, i int) ([]byte, error) {
+	offset := int(db.order.Uint16(content[bdbPageHeaderSize+i*2:]))
+	end := len(content)
+	if i > 0 {
+		end = int(db.order.Uint16(content[bdbPageHeaderSize+(i-1)*2:]))
+	}
+	if offset >= end || end > len(content) {
+		return nil, fmt.Errorf("%w: bad item offset", errCorrupt)
+	}
+
+	switch content[offset] {
+	case bdbItemKeyData:
+		return content[offset+1 : end], nil
+	case bdbItemOffPage:
+		if offset+12 > len(content) {
+			return nil, fmt.Errorf("%w: short off-page item", errCorrupt)
+		}
+		first := db.order.Uint32(content[offset+4 : offset+8])
+		length := db.order.Uint32(content[offset+8 : offset+12])
+		return db.readOverflow(first, length)
+	default:
+		// Duplicate sets are never written by rpm
+		return nil, nil
+	}
+}
+
+// readOverflow follows a chain of overflow pages
+func (db *bdbFile) readOverflow(first, length uint32) ([]byte, error) {
+	if length > 256*1024*1024 {
+		return nil, fmt.Errorf("%w: overflow item of %d bytes", errCorrupt, length)
+	}
+
+	data := make([]byte, 0, length)
+	visited := make(map[uint32]bool)
+	for number := first; uint32(len(data)) < length; {
+		if number == 0 || number > db.lastPage || visited[number] {
+			return nil, fmt.Errorf("%w: broken overflow chain", errCorrupt)
+		}
+		visited[number] = true
+
+		content, err := db.page(number)
+		if err != nil {
+			return nil, err
+		}
+		if content[25] != bdbPageOverflow {
+			return nil, fmt.Errorf("%w: page %d is not an overflow page", errCorrupt, number)
+		}
+
+		// On overflow pages hf_offset holds the number of bytes used
+		used := uint32(db.order.Uint16(content[22:24]))
+		if bdbPageHeaderSize+used > db.pageSize {
+			return nil, fmt.Errorf("%w: overflow page %d overfull", errCorrupt, number)
+		}
+		data = append(data, content[bdbPageHeaderSize:bdbPageHeaderSize+used]...)
+		number = db.order.Uint32(content[16:20])
+	}
+
+	if uint32(len(data)) != length {
+		return nil, fmt.Errorf("%w: overflow item length mismatch", errCorrupt)
+	}
+
+	return data, nil
+}
@@ -0,0 +1,99 @@
+package rpmdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testBDBPageSize = 512
+
+// buildBDB encodes blobs into a little-endian Berkeley DB hash image with a
+// single hash page. Blobs up to 64 bytes are stored inline, larger ones on
+// chains of overflow pages.
+func buildBDB(blobs [][]byte) []byte {
+	pages := [][]byte{make([]byte, testBDBPageSize), make([]byte, testBDBPageSize)}
+
+	hashPage := pages[1]
+	hashPage[25] = bdbPageHash
+	binary.LittleEndian.PutUint16(hashPage[20:22], uint16(len(blobs)*2))
+
+	end := testBDBPageSize
+	addItem := func(index int, item []byte) {
+		end -= len(item)
+		copy(hashPage[end:], item)
+		binary.LittleEndian.PutUint16(hashPage[bdbPageHeaderSize+index*2:], uint16(end))
+	}
+
+	for i, blob := range blobs {
+		key := binary.LittleEndian.AppendUint32([]byte{bdbItemKeyData}, uint32(i+1))
+		addItem(2*i, key)
+
+		if len(blob) <= 64 {
+			addItem(2*i+1, append([]byte{bdbItemKeyData}, blob...))
+			continue
+		}
+
+		first := uint32(len(pages))
+		for offset := 0; offset < len(blob); offset += testBDBPageSize - bdbPageHeaderSize {
+			chunk := blob[offset:min(len(blob), offset+testBDBPageSize-bdbPageHeaderSize)]
+			page := make([]byte, testBDBPageSize)
+			page[25] = bdbPageOverflow
+			binary.LittleEndian.PutUint16(page[22:24], uint16(len(chunk)))
+			copy(page[bdbPageHeaderSize:], chunk)
+			if offset+len(chunk) < len(blob) {
+				binary.LittleEndian.PutUint32(page[16:20], uint32(len(pages)+1))
+			}
+			pages = append(pages, page)
+		}
+
+		item := []byte{bdbItemOffPage, 0, 0, 0}
+		item = binary.LittleEndian.AppendUint32(item, first)
+		item = binary.LittleEndian.AppendUint32(item, uint32(len(blob)))
+		addItem(2*i+1, item)
+	}
+
+	meta := pages[0]
+	binary.LittleEndian.PutUint32(meta[12:16], bdbHashMagic)
+	binary.LittleEndian.PutUint32(meta[16:20], 9)
+	binary.LittleEndian.PutUint32(meta[20:24], testBDBPageSize)
+	meta[25] = bdbPageHashMeta
+	binary.LittleEndian.PutUint32(meta[32:36], uint32(len(pages)-1))
+
+	return bytes.Join(pages, nil)
+}
+
+func TestBDBWalk(t *testing.T) {
+	blobs := [][]byte{
+		[]byte("inline"),
+		bytes.Repeat([]byte("overflow"), 200),
+		bytes.Repeat([]byte("y"), 100),
+	}
+
+	db, err := openBDB(bytes.NewReader(buildBDB(blobs)))
+	require.NoError(t, err)
+
+	var visited [][]byte
+	require.NoError(t, db.walk(func(blob []byte) {
+		visited = append(visited, blob)
+	}))
+	assert.Equal(t, blobs, visited)
+
+	t.Run("not a hash database", func(t *testing.T) {
+		_, err := openBDB(bytes.NewReader(make([]byte, testBDBPageSize)))
+		assert.Error(t, err)
+	})
+
+	t.Run("overflow chain loop", func(t *testing.T) {
+		file := buildBDB(blobs)
+		// Point the first overflow page back at itself
+		binary.LittleEndian.PutUint32(file[2*testBDBPageSize+16:], 2)
+
+		db, err := openBDB(bytes.NewReader(file))
+		require.NoError(t, err)
+		assert.ErrorIs(t, db.walk(func([]byte) {}), errCorrupt)
+	})
+}
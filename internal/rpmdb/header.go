@@ -0,0 +1,141 @@
+package rpmdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// rpm header tags the agent decodes
+const (
+	tagName      = 1000
+	tagVersion   = 1001
+	tagRelease   = 1002
+	tagEpoch     = 1003
+	tagSize      = 1009
+	tagArch      = 1022
+	tagSourceRPM = 1044
+	tagLongSize  = 5009
+)
+
+// rpm header data types
+const (
+	typeInt32       = 4
+	typeInt64       = 5
+	typeString      = 6
+	typeStringArray = 8
+	typeI18NString  = 9
+)
+
+// headerEntrySize is the size of one index entry: tag, type, offset, count
+const headerEntrySize = 16
+
+// headerEntry is a single index entry of an rpm header
+type headerEntry struct {
+	tag    int32
+	typ    uint32
+	offset int32
+	count  uint32
+}
+
+// parseHeader decodes the tags the agent needs from an rpm header blob as
+// stored in the database: a big-endian index count and data length, the index
+// entries, then the data store. The on-disk lead and header magic are not
+// part of database blobs.
+func parseHeader(blob []byte) (Package, error) {
+	var pkg Package
+
+	if len(blob) < 8 {
+		return pkg, fmt.Errorf("header blob too short: %d bytes", len(blob))
+	}
+	indexCount := binary.BigEndian.Uint32(blob[0:4])
+	dataLength := binary.BigEndian.Uint32(blob[4:8])
+
+	indexEnd := 8 + uint64(indexCount)*headerEntrySize
+	if indexEnd+uint64(dataLength) > uint64(len(blob)) {
+		return pkg, fmt.Errorf("header blob truncated: %d index entries, %d data bytes, %d total", indexCount, dataLength, len(blob))
+	}
+	data := blob[indexEnd : indexEnd+uint64(dataLength)]
+
+	for i := range uint64(indexCount) {
+		raw := blob[8+i*headerEntrySize : 8+(i+1)*headerEntrySize]
+		entry := headerEntry{
+			tag:    int32(binary.BigEndian.Uint32(raw[0:4])),
+			typ:    binary.BigEndian.Uint32(raw[4:8]),
+			offset: int32(binary.BigEndian.Uint32(raw[8:12])),
+			count:  binary.BigEndian.Uint32(raw[12:16]),
+		}
+
+		switch entry.tag {
+		case tagName:
+			pkg.Name = entry.stringValue(data)
+		case tagVersion:
+			pkg.Version = entry.stringValue(data)
+		case tagRelease:
+			pkg.Release = entry.stringValue(data)
+		case tagArch:
+			pkg.Arch = entry.stringValue(data)
+		case tagSourceRPM:
+			pkg.SourceRPM = entry.stringValue(data)
+		case tagEpoch:
+			if value, ok := entry.intValue(data); ok {
+				epoch := int(value)
+				pkg.Epoch = &epoch
+			}
+		case tagSize:
+			// LONGSIZE takes precedence for packages larger than 4 GiB
+			if value, ok := entry.intValue(data); ok && pkg.Size == 0 {
+				pkg.Size = value
+			}
+		case tagLongSize:
+			if value, ok := entry.intValue(data); ok {
+				pkg.Size = value
+			}
+		}
+	}
+
+	if pkg.Name == "" {
+		return pkg, fmt.Errorf("header has no name tag")
+	}
+
+	return pkg, nil
+}
+
+// stringValue returns the (first) string of a string-typed entry
+func (e headerEntry) stringValue(data []byte) string {
+	if e.typ != typeString && e.typ != typeStringArray && e.typ != typeI18NString {
+		return ""
+	}
+	if e.offset < 0 || int(e.offset) >= len(data) {
+		return ""
+	}
+
+	value := data[e.offset:]
+	if end := bytes.IndexByte(value, 0); end >= 0 {
+		value = value[:end]
+	}
+	return string(value)
+}
+
+// intValue returns the first value of an integer-typed entry
+func (e headerEntry) intValue(data []byte) (int64, bool) {
+	if e.offset < 0 || e.count == 0 {
+		return 0, false
+	}
+	offset := int(e.offset)
+
+	switch e.typ {
+	case typeInt32:
+		if offset+4 > len(data) {
+			return 0, false
+		}
+		return int64(binary.BigEndian.Uint32(data[offset : offset+4])), true
+	case typeInt64:
+		if offset+8 > len(data) {
+			return 0, false
+		}
+		return int64(binary.BigEndian.Uint64(data[offset : offset+8])), true
+	default:
+		return 0, false
+	}
+}
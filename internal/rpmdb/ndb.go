@@ -0,0 +1,111 @@
+package rpmdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Reader for rpm's native "ndb" Packages.db format used by SUSE. The file
+// starts with a 32-byte header followed by an array of 16-byte slots, each
+// pointing at a blob made of 16-byte blocks. All integers are little-endian.
+
+const (
+	ndbHeaderMagic  = 'R' | 'p'<<8 | 'm'<<16 | 'P'<<24
+	ndbSlotMagic    = 'S' | 'l'<<8 | 'o'<<16 | 't'<<24
+	ndbBlobMagic    = 'B' | 'l'<<8 | 'b'<<16 | 'S'<<24
+	ndbHeaderSize   = 32
+	ndbSlotSize     = 16
+	ndbBlockSize    = 16
+	ndbPageSize     = 4096
+	ndbBlobHeadSize = 16
+	ndbBlobTailSize = 12
+	ndbVersion      = 0
+)
+
+// readNDB visits every package blob in an ndb Packages.db file
+func readNDB(path string, visit blobVisitor) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+
+	return walkNDB(file, visit)
+}
+
+// walkNDB visits every package blob referenced by the slot table
+func walkNDB(file io.ReaderAt, visit blobVisitor) error {
+	header := make([]byte, ndbHeaderSize)
+	if _, err := file.ReadAt(header, 0); err != nil {
+		return fmt.Errorf("failed to read ndb header: %w", err)
+	}
+	if binary.LittleEndian.Uint32(header[0:4]) != ndbHeaderMagic {
+		return fmt.Errorf("not an ndb package database")
+	}
+	if version := binary.LittleEndian.Uint32(header[4:8]); version != ndbVersion {
+		return fmt.Errorf("unsupported ndb version %d", version)
+	}
+
+	slotPages := binary.LittleEndian.Uint32(header[12:16])
+	if slotPages == 0 || slotPages > 2048 {
+		return fmt.Errorf("%w: invalid ndb slot page count %d", errCorrupt, slotPages)
+	}
+
+	slots := make([]byte, int(slotPages)*ndbPageSize-ndbHeaderSize)
+	if _, err := file.ReadAt(slots, ndbHeaderSize); err != nil {
+		return fmt.Errorf("failed to read ndb slots: %w", err)
+	}
+
+	for offset := 0; offset+ndbSlotSize <= len(slots); offset += ndbSlotSize {
+		slot := slots[offset : offset+ndbSlotSize]
+		if binary.LittleEndian.Uint32(slot[0:4]) != ndbSlotMagic {
+			return fmt.Errorf("%w: bad ndb slot magic", errCorrupt)
+		}
+
+		pkgIndex := binary.LittleEndian.Uint32(slot[4:8])
+		blockOffset := binary.LittleEndian.Uint32(slot[8:12])
+		blockCount := binary.LittleEndian.Uint32(slot[12:16])
+		// Slots with a zero package index are free
+		if pkgIndex == 0 {
+			continue
+		}
+
+		blob, err := readNDBBlob(file, pkgIndex, blockOffset, blockCount)
+		if err != nil {
+			return err
+		}
+		visit(blob)
+	}
+
+	return nil
+}
+
+// readNDBBlob reads the header blob a slot points at
+func readNDBBlob(file io.ReaderAt, pkgIndex, blockOffset, blockCount uint32) ([]byte, error) {
+	size := int64(blockCount) * ndbBlockSize
+	if size < ndbBlobHeadSize+ndbBlobTailSize {
+		return nil, fmt.Errorf("%w: ndb blob for package %d too small", errCorrupt, pkgIndex)
+	}
+
+	head := make([]byte, ndbBlobHeadSize)
+	if _, err := file.ReadAt(head, int64(blockOffset)*ndbBlockSize); err != nil {
+		return nil, fmt.Errorf("failed to read ndb blob for package %d: %w", pkgIndex, err)
+	}
+	if binary.LittleEndian.Uint32(head[0:4]) != ndbBlobMagic || binary.LittleEndian.Uint32(head[4:8]) != pkgIndex {
+		return nil, fmt.Errorf("%w: bad ndb blob header for package %d", errCorrupt, pkgIndex)
+	}
+
+	blobLength := int64(binary.LittleEndian.Uint32(head[12:16]))
+	if blobLength > size-ndbBlobHeadSize-ndbBlobTailSize {
+		return nil, fmt.Errorf("%w: ndb blob for package %d overflows its blocks", errCorrupt, pkgIndex)
+	}
+
+	blob := make([]byte, blobLength)
+	if _, err := file.ReadAt(blob, int64(blockOffset)*ndbBlockSize+ndbBlobHeadSize); err != nil {
+		return nil, fmt.Errorf("failed to read ndb blob for package %d: %w", pkgIndex, err)
+	}
+
+	return blob, nil
+}
@@ -0,0 +1,77 @@
+package rpmdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildNDB encodes blobs into a single-slot-page ndb Packages.db image
+func buildNDB(blobs [][]byte) []byte {
+	file := make([]byte, ndbPageSize)
+	binary.LittleEndian.PutUint32(file[0:4], ndbHeaderMagic)
+	binary.LittleEndian.PutUint32(file[4:8], ndbVersion)
+	binary.LittleEndian.PutUint32(file[12:16], 1)
+	binary.LittleEndian.PutUint32(file[16:20], uint32(len(blobs)+1))
+
+	for offset := ndbHeaderSize; offset < ndbPageSize; offset += ndbSlotSize {
+		binary.LittleEndian.PutUint32(file[offset:], ndbSlotMagic)
+	}
+
+	for i, blob := range blobs {
+		pkgIndex := uint32(i + 1)
+		blockOffset := uint32(len(file) / ndbBlockSize)
+
+		stored := binary.LittleEndian.AppendUint32(nil, ndbBlobMagic)
+		stored = binary.LittleEndian.AppendUint32(stored, pkgIndex)
+		stored = binary.LittleEndian.AppendUint32(stored, 0)
+		stored = binary.LittleEndian.AppendUint32(stored, uint32(len(blob)))
+		stored = append(stored, blob...)
+		stored = append(stored, make([]byte, ndbBlobTailSize)...)
+		for len(stored)%ndbBlockSize != 0 {
+			stored = append(stored, 0)
+		}
+		file = append(file, stored...)
+
+		// Leave a free slot between packages
+		slot := file[ndbHeaderSize+(2*i+1)*ndbSlotSize:]
+		binary.LittleEndian.PutUint32(slot[4:8], pkgIndex)
+		binary.LittleEndian.PutUint32(slot[8:12], blockOffset)
+		binary.LittleEndian.PutUint32(slot[12:16], uint32(len(stored)/ndbBlockSize))
+	}
+
+	return file
+}
+
+func TestWalkNDB(t *testing.T) {
+	blobs := [][]byte{[]byte("first"), bytes.Repeat([]byte("x"), 100)}
+
+	var visited [][]byte
+	err := walkNDB(bytes.NewReader(buildNDB(blobs)), func(blob []byte) {
+		visited = append(visited, blob)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, blobs, visited)
+
+	t.Run("bad magic", func(t *testing.T) {
+		err := walkNDB(bytes.NewReader(make([]byte, ndbPageSize)), func([]byte) {})
+		assert.Error(t, err)
+	})
+
+	t.Run("blob overflows its blocks", func(t *testing.T) {
+		file := buildNDB(blobs)
+		binary.LittleEndian.PutUint32(file[ndbPageSize+12:], 1<<20)
+		err := walkNDB(bytes.NewReader(file), func([]byte) {})
+		assert.ErrorIs(t, err, errCorrupt)
+	})
+
+	t.Run("blob index mismatch", func(t *testing.T) {
+		file := buildNDB(blobs)
+		binary.LittleEndian.PutUint32(file[ndbPageSize+4:], 7)
+		err := walkNDB(bytes.NewReader(file), func([]byte) {})
+		assert.ErrorIs(t, err, errCorrupt)
+	})
+}
@@ -0,0 +1,135 @@
+// Package rpmdb reads installed packages straight from the rpm database,
+// without linking librpm or spawning rpm/dnf subprocesses. The three on-disk
+// formats rpm has used are supported: sqlite (RHEL 9+, Fedora 33+), ndb
+// (SUSE 15+) and Berkeley DB hash (RHEL 8 and older).
+package rpmdb
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// rpm database directories relative to the filesystem root, in the order they
+// are searched. Newer distributions keep the database under /usr and leave a
+// compatibility symlink in /var/lib/rpm.
+var dbDirs = []string{
+	"usr/lib/sysimage/rpm",
+	"var/lib/rpm",
+}
+
+// Package is an installed package decoded from an rpm header
+type Package struct {
+	Name      string
+	Epoch     *int // nil when the package has no epoch
+	Version   string
+	Release   string
+	Arch      string
+	SourceRPM string
+	Size      int64 // Installed size in bytes
+}
+
+// EVR returns the [epoch:]version-release string, omitting a zero or missing
+// epoch the same way dnf does
+func (p Package) EVR() string {
+	evr := p.Version + "-" + p.Release
+	if p.Epoch != nil && *p.Epoch != 0 {
+		evr = strconv.Itoa(*p.Epoch) + ":" + evr
+	}
+	return evr
+}
+
+// SourceName returns the source package name from the SOURCERPM tag,
+// e.g. "glibc" for "glibc-2.34-60.el9.src.rpm"
+func (p Package) SourceName() string {
+	nvr := strings.TrimSuffix(p.SourceRPM, ".rpm")
+	nvr = strings.TrimSuffix(nvr, ".src")
+	nvr = strings.TrimSuffix(nvr, ".nosrc")
+	for range 2 {
+		idx := strings.LastIndex(nvr, "-")
+		if idx <= 0 {
+			return ""
+		}
+		nvr = nvr[:idx]
+	}
+	return nvr
+}
+
+// Read reads all installed packages from the rpm database below root
+// ("/" for the running system). gpg-pubkey pseudo packages are skipped.
+func Read(root string) ([]Package, error) {
+	for _, dir := range dbDirs {
+		dbPath := filepath.Join(root, dir)
+
+		collector := &packageCollector{}
+		var err error
+		switch {
+		case fileExists(filepath.Join(dbPath, "rpmdb.sqlite")):
+			err = readSQLite(filepath.Join(dbPath, "rpmdb.sqlite"), collector.add)
+		case fileExists(filepath.Join(dbPath, "Packages.db")):
+			err = readNDB(filepath.Join(dbPath, "Packages.db"), collector.add)
+		case fileExists(filepath.Join(dbPath, "Packages")):
+			err = readBDB(filepath.Join(dbPath, "Packages"), collector.add)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read rpm database in %s: %w", dbPath, err)
+		}
+
+		return collector.result()
+	}
+
+	return nil, fmt.Errorf("no rpm database found below %s: %w", root, fs.ErrNotExist)
+}
+
+// blobVisitor is called by the database readers for every header blob. Blobs
+// are decoded as they are read so the whole database is never held in memory.
+type blobVisitor func(blob []byte)
+
+// packageCollector decodes header blobs into packages
+type packageCollector struct {
+	packages []Package
+	firstErr error
+}
+
+// add decodes a single header blob
+func (c *packageCollector) add(blob []byte) {
+	pkg, err := parseHeader(blob)
+	if err != nil {
+		if c.firstErr == nil {
+			c.firstErr = err
+		}
+		return
+	}
+	if pkg.Name == "gpg-pubkey" {
+		return
+	}
+	c.packages = append(c.packages, pkg)
+}
+
+// result returns the decoded packages. A handful of undecodable headers
+// should not hide the rest of the database, but a database that yields
+// nothing but errors is an error.
+func (c *packageCollector) result() ([]Package, error) {
+	if len(c.packages) == 0 && c.firstErr != nil {
+		return nil, c.firstErr
+	}
+	return c.packages, nil
+}
+
+// fileExists reports whether path exists and is not a directory
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return !info.IsDir()
+}
+
+// errCorrupt is returned when a database structure is inconsistent
+var errCorrupt = errors.New("corrupt database")
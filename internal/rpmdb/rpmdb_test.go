@@ -0,0 +1,195 @@
+package rpmdb
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testHeader is the input for buildHeader
+type testHeader struct {
+	name, version, release, arch, sourceRPM string
+	epoch                                   *int
+	size                                    uint32
+}
+
+// buildHeader encodes an rpm header blob the way it is stored in the database
+func buildHeader(h testHeader) []byte {
+	var index, data []byte
+
+	addEntry := func(tag, typ, count uint32) {
+		entry := make([]byte, headerEntrySize)
+		binary.BigEndian.PutUint32(entry[0:4], tag)
+		binary.BigEndian.PutUint32(entry[4:8], typ)
+		binary.BigEndian.PutUint32(entry[8:12], uint32(len(data)))
+		binary.BigEndian.PutUint32(entry[12:16], count)
+		index = append(index, entry...)
+	}
+	addString := func(tag uint32, value string) {
+		if value == "" {
+			return
+		}
+		addEntry(tag, typeString, 1)
+		data = append(data, value...)
+		data = append(data, 0)
+	}
+	addInt32 := func(tag uint32, value uint32) {
+		for len(data)%4 != 0 {
+			data = append(data, 0)
+		}
+		addEntry(tag, typeInt32, 1)
+		data = binary.BigEndian.AppendUint32(data, value)
+	}
+
+	addString(tagName, h.name)
+	addString(tagVersion, h.version)
+	addString(tagRelease, h.release)
+	addString(tagArch, h.arch)
+	addString(tagSourceRPM, h.sourceRPM)
+	if h.epoch != nil {
+		addInt32(tagEpoch, uint32(*h.epoch))
+	}
+	if h.size != 0 {
+		addInt32(tagSize, h.size)
+	}
+
+	blob := binary.BigEndian.AppendUint32(nil, uint32(len(index)/headerEntrySize))
+	blob = binary.BigEndian.AppendUint32(blob, uint32(len(data)))
+	blob = append(blob, index...)
+	return append(blob, data...)
+}
+
+// testHeaders returns header blobs for a gpg-pubkey and two real packages
+func testHeaders() [][]byte {
+	epoch := 2
+	return [][]byte{
+		buildHeader(testHeader{name: "gpg-pubkey", version: "fd431d51", release: "4ae0493b"}),
+		buildHeader(testHeader{
+			name: "bash", version: "5.1.8", release: "6.el9_1", arch: "x86_64",
+			sourceRPM: "bash-5.1.8-6.el9_1.src.rpm", size: 7738634,
+		}),
+		buildHeader(testHeader{
+			name: "vim-enhanced", version: "8.2.2637", release: "20.el9_1", arch: "x86_64",
+			sourceRPM: "vim-8.2.2637-20.el9_1.src.rpm", epoch: &epoch, size: 4046577,
+		}),
+	}
+}
+
+// assertTestPackages checks the packages decoded from testHeaders
+func assertTestPackages(t *testing.T, packages []Package) {
+	t.Helper()
+
+	require.Len(t, packages, 2)
+	assert.Equal(t, "bash", packages[0].Name)
+	assert.Equal(t, "5.1.8-6.el9_1", packages[0].EVR())
+	assert.Equal(t, int64(7738634), packages[0].Size)
+	assert.Equal(t, "vim-enhanced", packages[1].Name)
+	assert.Equal(t, "2:8.2.2637-20.el9_1", packages[1].EVR())
+	assert.Equal(t, "vim", packages[1].SourceName())
+}
+
+func TestParseHeader(t *testing.T) {
+	zero := 0
+	blob := buildHeader(testHeader{
+		name: "glibc", version: "2.34", release: "60.el9", arch: "x86_64",
+		sourceRPM: "glibc-2.34-60.el9.src.rpm", epoch: &zero, size: 6271680,
+	})
+
+	pkg, err := parseHeader(blob)
+	require.NoError(t, err)
+	assert.Equal(t, "glibc", pkg.Name)
+	assert.Equal(t, "2.34", pkg.Version)
+	assert.Equal(t, "60.el9", pkg.Release)
+	assert.Equal(t, "x86_64", pkg.Arch)
+	assert.Equal(t, int64(6271680), pkg.Size)
+	require.NotNil(t, pkg.Epoch)
+	assert.Equal(t, 0, *pkg.Epoch)
+	assert.Equal(t, "2.34-60.el9", pkg.EVR())
+	assert.Equal(t, "glibc", pkg.SourceName())
+
+	t.Run("truncated", func(t *testing.T) {
+		_, err := parseHeader(blob[:len(blob)-10])
+		assert.Error(t, err)
+	})
+
+	t.Run("too short", func(t *testing.T) {
+		_, err := parseHeader([]byte{0, 0, 0, 1})
+		assert.Error(t, err)
+	})
+
+	t.Run("missing name", func(t *testing.T) {
+		_, err := parseHeader(buildHeader(testHeader{version: "1.0"}))
+		assert.Error(t, err)
+	})
+}
+
+func TestPackage_SourceName(t *testing.T) {
+	tests := []struct {
+		sourceRPM string
+		expected  string
+	}{
+		{"glibc-2.34-60.el9.src.rpm", "glibc"},
+		{"python-dateutil-2.8.1-7.el9.src.rpm", "python-dateutil"},
+		{"kernel-5.14.0-284.30.1.el9_2.nosrc.rpm", "kernel"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sourceRPM, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Package{SourceRPM: tt.sourceRPM}.SourceName())
+		})
+	}
+}
+
+func TestRead(t *testing.T) {
+	t.Run("sqlite under /usr", func(t *testing.T) {
+		root := t.TempDir()
+		writeTestFile(t, filepath.Join(root, "usr/lib/sysimage/rpm/rpmdb.sqlite"), buildSQLite(t, testHeaders()))
+
+		packages, err := Read(root)
+		require.NoError(t, err)
+		assertTestPackages(t, packages)
+	})
+
+	t.Run("ndb", func(t *testing.T) {
+		root := t.TempDir()
+		writeTestFile(t, filepath.Join(root, "var/lib/rpm/Packages.db"), buildNDB(testHeaders()))
+
+		packages, err := Read(root)
+		require.NoError(t, err)
+		assertTestPackages(t, packages)
+	})
+
+	t.Run("berkeley db", func(t *testing.T) {
+		root := t.TempDir()
+		writeTestFile(t, filepath.Join(root, "var/lib/rpm/Packages"), buildBDB(testHeaders()))
+
+		packages, err := Read(root)
+		require.NoError(t, err)
+		assertTestPackages(t, packages)
+	})
+
+	t.Run("no database", func(t *testing.T) {
+		_, err := Read(t.TempDir())
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("corrupt database", func(t *testing.T) {
+		root := t.TempDir()
+		writeTestFile(t, filepath.Join(root, "var/lib/rpm/Packages.db"), []byte("not a database"))
+
+		_, err := Read(root)
+		assert.Error(t, err)
+	})
+}
+
+// writeTestFile writes content to path, creating parent directories
+func writeTestFile(t *testing.T, path string, content []byte) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, content, 0o644))
+}
@@ -0,0 +1,448 @@
+package rpmdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// A minimal read-only reader for the SQLite 3 file format, sufficient to walk
+// the table b-tree of rpm's "Packages" table (hnum INTEGER PRIMARY KEY, blob
+// BLOB). Committed frames in the write-ahead log are applied on top of the
+// main database file, as rpm keeps its database in WAL mode.
+// See https://www.sqlite.org/fileformat2.html.
+
+const (
+	sqliteMagic         = "SQLite format 3\x00"
+	sqliteHeaderSize    = 100
+	sqliteLeafTable     = 0x0d
+	sqliteInteriorTable = 0x05
+	sqliteMaxDepth      = 32
+
+	walHeaderSize      = 32
+	walFrameHeaderSize = 24
+	walMagicLE         = 0x377f0682
+	walMagicBE         = 0x377f0683
+
+	rpmPackagesTable = "Packages"
+)
+
+// sqliteDB is an open SQLite database file
+type sqliteDB struct {
+	file       io.ReaderAt
+	pageSize   int
+	usableSize int
+	walPages   map[uint32][]byte
+}
+
+// readSQLite visits every blob of the rpm Packages table
+func readSQLite(path string, visit blobVisitor) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+
+	db, err := openSQLite(file)
+	if err != nil {
+		return err
+	}
+	if err := db.loadWAL(path + "-wal"); err != nil {
+		return fmt.Errorf("failed to read write-ahead log: %w", err)
+	}
+
+	rootPage, err := db.findTable(rpmPackagesTable)
+	if err != nil {
+		return err
+	}
+
+	return db.walkTable(rootPage, func(_ int64, record []byte) error {
+		columns, err := decodeRecord(record)
+		if err != nil {
+			return err
+		}
+		// Column 0 is hnum, an alias for the rowid and stored as NULL
+		if len(columns) < 2 {
+			return nil
+		}
+		if blob, ok := columns[1].([]byte); ok {
+			visit(blob)
+		}
+		return nil
+	})
+}
+
+// openSQLite validates the database header
+func openSQLite(file io.ReaderAt) (*sqliteDB, error) {
+	header := make([]byte, sqliteHeaderSize)
+	if _, err := file.ReadAt(header, 0); err != nil {
+		return nil, fmt.Errorf("failed to read sqlite header: %w", err)
+	}
+	if string(header[:16]) != sqliteMagic {
+		return nil, fmt.Errorf("not a sqlite database")
+	}
+
+	pageSize := int(binary.BigEndian.Uint16(header[16:18]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	if pageSize < 512 || pageSize&(pageSize-1) != 0 {
+		return nil, fmt.Errorf("invalid sqlite page size %d", pageSize)
+	}
+	if encoding := binary.BigEndian.Uint32(header[56:60]); encoding != 1 && encoding != 0 {
+		return nil, fmt.Errorf("unsupported sqlite text encoding %d", encoding)
+	}
+
+	return &sqliteDB{
+		file:       file,
+		pageSize:   pageSize,
+		usableSize: pageSize - int(header[20]),
+		walPages:   make(map[uint32][]byte),
+	}, nil
+}
+
+// loadWAL reads the committed frames of the write-ahead log, if any. Frames
+// are only applied once their transaction's commit frame has been seen and
+// every checksum in the chain up to it is valid.
+func (db *sqliteDB) loadWAL(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && len(data) == 0) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(data) < walHeaderSize {
+		return nil
+	}
+
+	var order binary.ByteOrder
+	switch binary.BigEndian.Uint32(data[0:4]) {
+	case walMagicBE:
+		order = binary.BigEndian
+	case walMagicLE:
+		order = binary.LittleEndian
+	default:
+		return nil
+	}
+	if int(binary.BigEndian.Uint32(data[8:12])) != db.pageSize {
+		return nil
+	}
+
+	salt1 := binary.BigEndian.Uint32(data[16:20])
+	salt2 := binary.BigEndian.Uint32(data[20:24])
+	s0, s1 := walChecksum(order, data[0:24], 0, 0)
+	if s0 != binary.BigEndian.Uint32(data[24:28]) || s1 != binary.BigEndian.Uint32(data[28:32]) {
+		return nil
+	}
+
+	pending := make(map[uint32][]byte)
+	frameSize := walFrameHeaderSize + db.pageSize
+	for offset := walHeaderSize; offset+frameSize <= len(data); offset += frameSize {
+		frame := data[offset : offset+frameSize]
+		if binary.BigEndian.Uint32(frame[8:12]) != salt1 || binary.BigEndian.Uint32(frame[12:16]) != salt2 {
+			break
+		}
+
+		s0, s1 = walChecksum(order, frame[0:8], s0, s1)
+		s0, s1 = walChecksum(order, frame[walFrameHeaderSize:], s0, s1)
+		if s0 != binary.BigEndian.Uint32(frame[16:20]) || s1 != binary.BigEndian.Uint32(frame[20:24]) {
+			break
+		}
+
+		pageNumber := binary.BigEndian.Uint32(frame[0:4])
+		pending[pageNumber] = frame[walFrameHeaderSize:]
+
+		// A non-zero database size marks the commit frame of a transaction
+		if binary.BigEndian.Uint32(frame[4:8]) != 0 {
+			for page, content := range pending {
+				db.walPages[page] = content
+			}
+			pending = make(map[uint32][]byte)
+		}
+	}
+
+	return nil
+}
+
+// walChecksum computes the cumulative WAL checksum over data
+func walChecksum(order binary.ByteOrder, data []byte, s0, s1 uint32) (uint32, uint32) {
+	for i := 0; i+8 <= len(data); i += 8 {
+		s0 += order.Uint32(data[i:i+4]) + s1
+		s1 += order.Uint32(data[i+4:i+8]) + s0
+	}
+	return s0, s1
+}
+
+// page returns the content of a 1-based page number
+func (db *sqliteDB) page(number uint32) ([]byte, error) {
+	if number == 0 {
+		return nil, fmt.Errorf("%w: page %d out of range", errCorrupt, number)
+	}
+	if content, ok := db.walPages[number]; ok {
+		return content, nil
+	}
+
+	content := make([]byte, db.pageSize)
+	if _, err := db.file.ReadAt(content, int64(number-1)*int64(db.pageSize)); err != nil {
+		return nil, fmt.Errorf("failed to read page %d: %w", number, err)
+	}
+	return content, nil
+}
+
+// findTable returns the root page of a table from the sqlite_schema table
+func (db *sqliteDB) findTable(name string) (uint32, error) {
+	var rootPage uint32
+
+	err := db.walkTable(1, func(_ int64, record []byte) error {
+		columns, err := decodeRecord(record)
+		if err != nil {
+			return err
+		}
+		// type, name, tbl_name, rootpage, sql
+		if len(columns) < 4 {
+			return nil
+		}
+		objectType, _ := columns[0].(string)
+		objectName, _ := columns[1].(string)
+		if objectType == "table" && strings.EqualFold(objectName, name) {
+			if page, ok := columns[3].(int64); ok && page > 0 {
+				rootPage = uint32(page)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if rootPage == 0 {
+		return 0, fmt.Errorf("table %s not found", name)
+	}
+
+	return rootPage, nil
+}
+
+// walkTable visits every row of the table b-tree rooted at rootPage in rowid order
+func (db *sqliteDB) walkTable(rootPage uint32, visit func(rowid int64, record []byte) error) error {
+	visited := make(map[uint32]bool)
+	return db.walkPage(rootPage, 0, visited, visit)
+}
+
+// walkPage visits a single b-tree page and its children
+func (db *sqliteDB) walkPage(number uint32, depth int, visited map[uint32]bool, visit func(int64, []byte) error) error {
+	if depth > sqliteMaxDepth || visited[number] {
+		return fmt.Errorf("%w: b-tree loop at page %d", errCorrupt, number)
+	}
+	visited[number] = true
+
+	content, err := db.page(number)
+	if err != nil {
+		return err
+	}
+
+	headerOffset := 0
+	if number == 1 {
+		headerOffset = sqliteHeaderSize
+	}
+	if headerOffset+8 > len(content) {
+		return fmt.Errorf("%w: short page %d", errCorrupt, number)
+	}
+	header := content[headerOffset:]
+	pageType := header[0]
+	cellCount := int(binary.BigEndian.Uint16(header[3:5]))
+
+	headerSize := 8
+	if pageType == sqliteInteriorTable {
+		headerSize = 12
+	} else if pageType != sqliteLeafTable {
+		return fmt.Errorf("%w: page %d is not a table b-tree page (type %#x)", errCorrupt, number, pageType)
+	}
+
+	pointers := header[headerSize:]
+	if len(pointers) < cellCount*2 {
+		return fmt.Errorf("%w: cell pointers overflow page %d", errCorrupt, number)
+	}
+
+	for i := range cellCount {
+		cellOffset := int(binary.BigEndian.Uint16(pointers[i*2 : i*2+2]))
+		if cellOffset >= len(content) {
+			return fmt.Errorf("%w: cell offset out of range on page %d", errCorrupt, number)
+		}
+		cell := content[cellOffset:]
+
+		if pageType == sqliteInteriorTable {
+			if len(cell) < 4 {
+				return fmt.Errorf("%w: short interior cell on page %d", errCorrupt, number)
+			}
+			child := binary.BigEndian.Uint32(cell[0:4])
+			if err := db.walkPage(child, depth+1, visited, visit); err != nil {
+				return err
+			}
+			continue
+		}
+
+		payloadSize, n := readVarint(cell)
+		if n == 0 {
+			return fmt.Errorf("%w: bad payload size on page %d", errCorrupt, number)
+		}
+		rowid, m := readVarint(cell[n:])
+		if m == 0 {
+			return fmt.Errorf("%w: bad rowid on page %d", errCorrupt, number)
+		}
+
+		payload, err := db.readPayload(cell[n+m:], int(payloadSize))
+		if err != nil {
+			return err
+		}
+		if err := visit(int64(rowid), payload); err != nil {
+			return err
+		}
+	}
+
+	if pageType == sqliteInteriorTable {
+		rightMost := binary.BigEndian.Uint32(header[8:12])
+		return db.walkPage(rightMost, depth+1, visited, visit)
+	}
+
+	return nil
+}
+
+// readPayload assembles a leaf cell payload, following overflow pages
+func (db *sqliteDB) readPayload(cell []byte, payloadSize int) ([]byte, error) {
+	maxLocal := db.usableSize - 35
+	if payloadSize <= maxLocal {
+		if len(cell) < payloadSize {
+			return nil, fmt.Errorf("%w: truncated cell payload", errCorrupt)
+		}
+		return cell[:payloadSize], nil
+	}
+
+	minLocal := (db.usableSize-12)*32/255 - 23
+	localSize := minLocal + (payloadSize-minLocal)%(db.usableSize-4)
+	if localSize > maxLocal {
+		localSize = minLocal
+	}
+	if len(cell) < localSize+4 {
+		return nil, fmt.Errorf("%w: truncated cell payload", errCorrupt)
+	}
+
+	payload := make([]byte, 0, payloadSize)
+	payload = append(payload, cell[:localSize]...)
+
+	overflow := binary.BigEndian.Uint32(cell[localSize : localSize+4])
+	visited := make(map[uint32]bool)
+	for len(payload) < payloadSize {
+		if overflow == 0 || visited[overflow] {
+			return nil, fmt.Errorf("%w: broken overflow chain", errCorrupt)
+		}
+		visited[overflow] = true
+
+		content, err := db.page(overflow)
+		if err != nil {
+			return nil, err
+		}
+		chunk := min(payloadSize-len(payload), db.usableSize-4)
+		payload = append(payload, content[4:4+chunk]...)
+		overflow = binary.BigEndian.Uint32(content[0:4])
+	}
+
+	return payload, nil
+}
+
+// decodeRecord decodes a record into nil (NULL), int64, string or []byte
+// column values. Floats are not used by rpm and are returned as raw bits.
+func decodeRecord(record []byte) ([]any, error) {
+	headerSize, n := readVarint(record)
+	if n == 0 || int(headerSize) > len(record) || int(headerSize) < n {
+		return nil, fmt.Errorf("%w: bad record header", errCorrupt)
+	}
+
+	var serialTypes []uint64
+	for offset := n; offset < int(headerSize); {
+		serialType, m := readVarint(record[offset:headerSize])
+		if m == 0 {
+			return nil, fmt.Errorf("%w: bad serial type", errCorrupt)
+		}
+		serialTypes = append(serialTypes, serialType)
+		offset += m
+	}
+
+	columns := make([]any, 0, len(serialTypes))
+	body := record[headerSize:]
+	for _, serialType := range serialTypes {
+		var size int
+		switch {
+		case serialType == 0, serialType == 8, serialType == 9:
+			size = 0
+		case serialType <= 4:
+			size = int(serialType)
+		case serialType == 5:
+			size = 6
+		case serialType == 6, serialType == 7:
+			size = 8
+		case serialType >= 12:
+			size = int(serialType-12) / 2
+		default:
+			return nil, fmt.Errorf("%w: reserved serial type %d", errCorrupt, serialType)
+		}
+		if size > len(body) {
+			return nil, fmt.Errorf("%w: record body truncated", errCorrupt)
+		}
+		value := body[:size]
+		body = body[size:]
+
+		switch {
+		case serialType == 0:
+			columns = append(columns, nil)
+		case serialType == 8:
+			columns = append(columns, int64(0))
+		case serialType == 9:
+			columns = append(columns, int64(1))
+		case serialType <= 6:
+			columns = append(columns, decodeBigEndianInt(value))
+		case serialType == 7:
+			columns = append(columns, binary.BigEndian.Uint64(value))
+		case serialType%2 == 0:
+			columns = append(columns, value)
+		default:
+			columns = append(columns, string(value))
+		}
+	}
+
+	return columns, nil
+}
+
+// decodeBigEndianInt decodes a 1-8 byte big-endian two's complement integer
+func decodeBigEndianInt(value []byte) int64 {
+	var result int64
+	if len(value) > 0 && value[0]&0x80 != 0 {
+		result = -1
+	}
+	for _, b := range value {
+		result = result<<8 | int64(b)
+	}
+	return result
+}
+
+// readVarint decodes a SQLite varint, returning the value and its length in
+// bytes, or a length of 0 if the buffer is too short
+func readVarint(buf []byte) (uint64, int) {
+	var value uint64
+	for i := 0; i < 9; i++ {
+		if i >= len(buf) {
+			return 0, 0
+		}
+		if i == 8 {
+			return value<<8 | uint64(buf[i]), 9
+		}
+		value = value<<7 | uint64(buf[i]&0x7f)
+		if buf[i]&0x80 == 0 {
+			return value, i + 1
+		}
+	}
+	return 0, 0
+}
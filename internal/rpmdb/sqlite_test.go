@@ -0,0 +1,217 @@
+package rpmdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSQLitePageSize = 1024
+
+// appendVarint appends a SQLite varint (values below 2^56 only)
+func appendVarint(buf []byte, value uint64) []byte {
+	var groups []byte
+	for {
+		groups = append([]byte{byte(value & 0x7f)}, groups...)
+		value >>= 7
+		if value == 0 {
+			break
+		}
+	}
+	for i := 0; i < len(groups)-1; i++ {
+		groups[i] |= 0x80
+	}
+	return append(buf, groups...)
+}
+
+// buildRecord encodes nil, int64, string and []byte values as a SQLite record
+func buildRecord(values ...any) []byte {
+	var types, body []byte
+	for _, value := range values {
+		switch v := value.(type) {
+		case nil:
+			types = appendVarint(types, 0)
+		case int64:
+			types = appendVarint(types, 6)
+			body = binary.BigEndian.AppendUint64(body, uint64(v))
+		case string:
+			types = appendVarint(types, uint64(len(v))*2+13)
+			body = append(body, v...)
+		case []byte:
+			types = appendVarint(types, uint64(len(v))*2+12)
+			body = append(body, v...)
+		}
+	}
+	// Header sizes in the tests always fit in a single varint byte
+	record := appendVarint(nil, uint64(len(types)+1))
+	record = append(record, types...)
+	return append(record, body...)
+}
+
+// sqliteBuilder assembles a database image page by page
+type sqliteBuilder struct {
+	pages [][]byte
+}
+
+// allocate adds an empty page and returns its 1-based number
+func (b *sqliteBuilder) allocate() uint32 {
+	b.pages = append(b.pages, make([]byte, testSQLitePageSize))
+	return uint32(len(b.pages))
+}
+
+// leafCell encodes a leaf table cell, spilling the payload to overflow pages
+// when it does not fit on the leaf
+func (b *sqliteBuilder) leafCell(rowid int64, payload []byte) []byte {
+	cell := appendVarint(nil, uint64(len(payload)))
+	cell = appendVarint(cell, uint64(rowid))
+
+	usable := testSQLitePageSize
+	maxLocal := usable - 35
+	if len(payload) <= maxLocal {
+		return append(cell, payload...)
+	}
+
+	minLocal := (usable-12)*32/255 - 23
+	localSize := minLocal + (len(payload)-minLocal)%(usable-4)
+	if localSize > maxLocal {
+		localSize = minLocal
+	}
+	cell = append(cell, payload[:localSize]...)
+
+	rest := payload[localSize:]
+	next := b.allocate()
+	cell = binary.BigEndian.AppendUint32(cell, next)
+	for len(rest) > 0 {
+		page := b.pages[next-1]
+		chunk := rest[:min(len(rest), usable-4)]
+		copy(page[4:], chunk)
+		rest = rest[len(chunk):]
+		if len(rest) > 0 {
+			next = b.allocate()
+			binary.BigEndian.PutUint32(page[0:4], next)
+		}
+	}
+	return cell
+}
+
+// writeBTreePage lays out a b-tree page header and its cells
+func (b *sqliteBuilder) writeBTreePage(number uint32, pageType byte, cells [][]byte, rightMost uint32) {
+	page := b.pages[number-1]
+	headerOffset := 0
+	if number == 1 {
+		headerOffset = sqliteHeaderSize
+	}
+	headerSize := 8
+	if pageType == sqliteInteriorTable {
+		headerSize = 12
+		binary.BigEndian.PutUint32(page[headerOffset+8:], rightMost)
+	}
+
+	page[headerOffset] = pageType
+	binary.BigEndian.PutUint16(page[headerOffset+3:], uint16(len(cells)))
+
+	end := len(page)
+	for i, cell := range cells {
+		end -= len(cell)
+		copy(page[end:], cell)
+		binary.BigEndian.PutUint16(page[headerOffset+headerSize+i*2:], uint16(end))
+	}
+	binary.BigEndian.PutUint16(page[headerOffset+5:], uint16(end))
+}
+
+// buildSQLite encodes blobs as rows of an rpm-style Packages table. The table
+// root is an interior page with one leaf page per row.
+func buildSQLite(t *testing.T, blobs [][]byte) []byte {
+	t.Helper()
+	require.NotEmpty(t, blobs)
+
+	b := &sqliteBuilder{}
+	schemaPage := b.allocate()
+	rootPage := b.allocate()
+
+	var leaves []uint32
+	for i, blob := range blobs {
+		leaf := b.allocate()
+		cell := b.leafCell(int64(i+1), buildRecord(nil, blob))
+		b.writeBTreePage(leaf, sqliteLeafTable, [][]byte{cell}, 0)
+		leaves = append(leaves, leaf)
+	}
+
+	var interiorCells [][]byte
+	for i, leaf := range leaves[:len(leaves)-1] {
+		cell := binary.BigEndian.AppendUint32(nil, leaf)
+		interiorCells = append(interiorCells, appendVarint(cell, uint64(i+1)))
+	}
+	b.writeBTreePage(rootPage, sqliteInteriorTable, interiorCells, leaves[len(leaves)-1])
+
+	schema := [][]byte{
+		b.leafCell(1, buildRecord("table", "Packages", "Packages", int64(rootPage),
+			"CREATE TABLE Packages (hnum INTEGER PRIMARY KEY AUTOINCREMENT, blob BLOB NOT NULL)")),
+	}
+	b.writeBTreePage(schemaPage, sqliteLeafTable, schema, 0)
+
+	header := b.pages[0]
+	copy(header, sqliteMagic)
+	binary.BigEndian.PutUint16(header[16:18], testSQLitePageSize)
+	header[18], header[19] = 1, 1
+	header[21], header[22], header[23] = 64, 32, 32
+	binary.BigEndian.PutUint32(header[28:32], uint32(len(b.pages)))
+	binary.BigEndian.PutUint32(header[44:48], 4)
+	binary.BigEndian.PutUint32(header[56:60], 1)
+
+	return bytes.Join(b.pages, nil)
+}
+
+func TestReadSQLite(t *testing.T) {
+	blobs := [][]byte{
+		[]byte("small"),
+		bytes.Repeat([]byte("large"), 1000),
+		bytes.Repeat([]byte("z"), testSQLitePageSize-40),
+	}
+	path := filepath.Join(t.TempDir(), "rpmdb.sqlite")
+	require.NoError(t, os.WriteFile(path, buildSQLite(t, blobs), 0o644))
+
+	var visited [][]byte
+	require.NoError(t, readSQLite(path, func(blob []byte) {
+		visited = append(visited, blob)
+	}))
+	assert.Equal(t, blobs, visited)
+
+	t.Run("not a sqlite database", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(path, make([]byte, testSQLitePageSize), 0o644))
+		assert.Error(t, readSQLite(path, func([]byte) {}))
+	})
+
+	t.Run("b-tree loop", func(t *testing.T) {
+		file := buildSQLite(t, blobs)
+		// Make the root's right-most child point back at the root
+		binary.BigEndian.PutUint32(file[testSQLitePageSize+8:], 2)
+		require.NoError(t, os.WriteFile(path, file, 0o644))
+		assert.ErrorIs(t, readSQLite(path, func([]byte) {}), errCorrupt)
+	})
+}
+
+func TestReadVarint(t *testing.T) {
+	tests := []struct {
+		input  []byte
+		value  uint64
+		length int
+	}{
+		{[]byte{0x05}, 5, 1},
+		{[]byte{0x81, 0x00}, 128, 2},
+		{appendVarint(nil, 300000), 300000, 3},
+		{bytes.Repeat([]byte{0xff}, 9), ^uint64(0), 9},
+		{[]byte{0x81}, 0, 0},
+	}
+
+	for _, tt := range tests {
+		value, length := readVarint(tt.input)
+		assert.Equal(t, tt.value, value)
+		assert.Equal(t, tt.length, length)
+	}
+}
@@ -0,0 +1,95 @@
+// Package sdnotify implements the systemd notification protocol, letting a
+// service started with Type=notify signal readiness, status and liveness
+// over the datagram socket named in $NOTIFY_SOCKET.
+package sdnotify
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Notifier sends state updates to systemd. Without $NOTIFY_SOCKET, when
+// the agent is not run by systemd, all methods do nothing.
+type Notifier struct {
+	socket   string
+	watchdog time.Duration
+}
+
+// New creates a notifier from the environment systemd sets for the service
+func New() *Notifier {
+	n := &Notifier{socket: os.Getenv("NOTIFY_SOCKET")}
+
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return n
+	}
+	// The watchdog may be meant for another process of the unit
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return n
+	}
+	n.watchdog = time.Duration(usec) * time.Microsecond
+	return n
+}
+
+// Enabled reports whether systemd listens for notifications
+func (n *Notifier) Enabled() bool {
+	return n.socket != ""
+}
+
+// WatchdogInterval returns the watchdog timeout set with WatchdogSec=, or 0
+// when the watchdog is disabled. Pings should be sent at half this interval.
+func (n *Notifier) WatchdogInterval() time.Duration {
+	if !n.Enabled() {
+		return 0
+	}
+	return n.watchdog
+}
+
+// Ready tells systemd that start-up has finished
+func (n *Notifier) Ready() error {
+	return n.Notify("READY=1")
+}
+
+// Status sets the free-form status shown by systemctl status
+func (n *Notifier) Status(status string) error {
+	// A newline would end the assignment early
+	return n.Notify("STATUS=" + strings.ReplaceAll(status, "\n", " "))
+}
+
+// Watchdog tells systemd the service is alive
+func (n *Notifier) Watchdog() error {
+	return n.Notify("WATCHDOG=1")
+}
+
+// Stopping tells systemd that shutdown has begun
+func (n *Notifier) Stopping() error {
+	return n.Notify("STOPPING=1")
+}
+
+// Notify sends newline-separated state assignments
+func (n *Notifier) Notify(state ...string) error {
+	if !n.Enabled() {
+		return nil
+	}
+
+	// A leading @ names a socket in the abstract namespace
+	name := n.socket
+	if strings.HasPrefix(name, "@") {
+		name = "\x00" + name[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: name, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("error connecting to notify socket: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	if _, err := conn.Write([]byte(strings.Join(state, "\n"))); err != nil {
+		return fmt.Errorf("error sending notification: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package sdnotify
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// listen creates a notify socket and points $NOTIFY_SOCKET at it
+func listen(t *testing.T) *net.UnixConn {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", path)
+	return conn
+}
+
+func receive(t *testing.T, conn *net.UnixConn) string {
+	t.Helper()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	buf := make([]byte, 4096)
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	return string(buf[:n])
+}
+
+func TestNotifier_Disabled(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	t.Setenv("WATCHDOG_USEC", "30000000")
+
+	n := New()
+	assert.False(t, n.Enabled())
+	assert.Zero(t, n.WatchdogInterval())
+	assert.NoError(t, n.Ready())
+}
+
+func TestNotifier_Messages(t *testing.T) {
+	conn := listen(t)
+	n := New()
+	require.True(t, n.Enabled())
+
+	tests := []struct {
+		name     string
+		send     func() error
+		expected string
+	}{
+		{"ready", n.Ready, "READY=1"},
+		{"watchdog", n.Watchdog, "WATCHDOG=1"},
+		{"stopping", n.Stopping, "STOPPING=1"},
+		{"status", func() error { return n.Status("Last report\nsucceeded") }, "STATUS=Last report succeeded"},
+		{"several", func() error { return n.Notify("READY=1", "STATUS=Running") }, "READY=1\nSTATUS=Running"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, tt.send())
+			assert.Equal(t, tt.expected, receive(t, conn))
+		})
+	}
+}
+
+func TestNotifier_WatchdogInterval(t *testing.T) {
+	listen(t)
+
+	t.Setenv("WATCHDOG_USEC", "30000000")
+	t.Setenv("WATCHDOG_PID", "")
+	assert.Equal(t, 30*time.Second, New().WatchdogInterval())
+
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	assert.Equal(t, 30*time.Second, New().WatchdogInterval())
+
+	// Meant for another process of the unit
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()+1))
+	assert.Zero(t, New().WatchdogInterval())
+
+	t.Setenv("WATCHDOG_USEC", "")
+	assert.Zero(t, New().WatchdogInterval())
+}
@@ -0,0 +1,253 @@
+// Package signing verifies detached signatures of agent binaries before a
+// self-update installs them.
+//
+// Signatures use the minisign format: Ed25519 over the file, or over its
+// BLAKE2b-512 hash for the default prehashed mode, plus a global signature
+// binding the trusted comment. Each key carries an 8-byte ID, so several keys
+// can be trusted at once while a new signing key is rolled out, and revoked
+// key IDs are refused even when the key is otherwise trusted.
+package signing
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// EmbeddedKeys holds the release signing keys built into the agent, as
+// comma-separated minisign public keys. It is set at build time with
+// -ldflags "-X patchmon-agent/internal/signing.EmbeddedKeys=...".
+var EmbeddedKeys string
+
+// Signature algorithms
+const (
+	algEd25519       = "Ed" // Ed25519 over the file itself
+	algEd25519Hashed = "ED" // Ed25519 over the BLAKE2b-512 hash of the file
+)
+
+const (
+	keyIDSize         = 8
+	untrustedPrefix   = "untrusted comment:"
+	trustedPrefix     = "trusted comment: "
+	maxSignatureBytes = 4096
+)
+
+var (
+	// ErrNoKeys is returned when no signing key is trusted
+	ErrNoKeys = errors.New("no trusted signing keys configured")
+	// ErrUnknownKey is returned when the signing key is not trusted
+	ErrUnknownKey = errors.New("signed with an untrusted key")
+	// ErrRevokedKey is returned when the signing key has been revoked
+	ErrRevokedKey = errors.New("signed with a revoked key")
+	// ErrBadSignature is returned when the signature does not match
+	ErrBadSignature = errors.New("signature does not match")
+)
+
+// KeyID identifies a signing key
+type KeyID [keyIDSize]byte
+
+// String formats the ID as minisign prints it
+func (id KeyID) String() string {
+	reversed := id
+	slices.Reverse(reversed[:])
+	return strings.ToUpper(hex.EncodeToString(reversed[:]))
+}
+
+// ParseKeyID parses a key ID as printed by String
+func ParseKeyID(s string) (KeyID, error) {
+	var id KeyID
+	raw, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(raw) != keyIDSize {
+		return id, fmt.Errorf("invalid key ID %q", s)
+	}
+	slices.Reverse(raw)
+	copy(id[:], raw)
+	return id, nil
+}
+
+// PublicKey is a trusted signing key
+type PublicKey struct {
+	ID  KeyID
+	Key ed25519.PublicKey
+}
+
+// ParsePublicKey parses a minisign public key, either the base64 key alone
+// or the contents of a .pub file with its comment line
+func ParsePublicKey(text string) (PublicKey, error) {
+	line, err := lastDataLine(text)
+	if err != nil {
+		return PublicKey{}, fmt.Errorf("invalid public key: %w", err)
+	}
+	raw, err := base64.StdEncoding.DecodeString(line)
+	if err != nil || len(raw) != 2+keyIDSize+ed25519.PublicKeySize || string(raw[:2]) != algEd25519 {
+		return PublicKey{}, errors.New("invalid public key: not a minisign Ed25519 key")
+	}
+
+	key := PublicKey{Key: ed25519.PublicKey(raw[2+keyIDSize:])}
+	copy(key.ID[:], raw[2:2+keyIDSize])
+	return key, nil
+}
+
+// lastDataLine returns the single non-comment line of a key
+func lastDataLine(text string) (string, error) {
+	var data []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, untrustedPrefix) {
+			continue
+		}
+		data = append(data, line)
+	}
+	if len(data) != 1 {
+		return "", errors.New("expected one key line")
+	}
+	return data[0], nil
+}
+
+// Signature is a parsed minisign signature file
+type Signature struct {
+	Algorithm      string
+	KeyID          KeyID
+	Signature      []byte
+	TrustedComment string
+	GlobalSig      []byte
+}
+
+// ParseSignature parses the contents of a .minisig file
+func ParseSignature(data []byte) (*Signature, error) {
+	if len(data) > maxSignatureBytes {
+		return nil, errors.New("invalid signature: too large")
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if line := strings.TrimRight(scanner.Text(), "\r"); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], untrustedPrefix) || !strings.HasPrefix(lines[2], trustedPrefix) {
+		return nil, errors.New("invalid signature: not a minisign signature file")
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(lines[1])
+	if err != nil || len(raw) != 2+keyIDSize+ed25519.SignatureSize {
+		return nil, errors.New("invalid signature: malformed signature line")
+	}
+	global, err := base64.StdEncoding.DecodeString(lines[3])
+	if err != nil || len(global) != ed25519.SignatureSize {
+		return nil, errors.New("invalid signature: malformed global signature")
+	}
+
+	sig := &Signature{
+		Algorithm:      string(raw[:2]),
+		Signature:      raw[2+keyIDSize:],
+		TrustedComment: strings.TrimPrefix(lines[2], trustedPrefix),
+		GlobalSig:      global,
+	}
+	copy(sig.KeyID[:], raw[2:2+keyIDSize])
+	if sig.Algorithm != algEd25519 && sig.Algorithm != algEd25519Hashed {
+		return nil, fmt.Errorf("invalid signature: unsupported algorithm %q", sig.Algorithm)
+	}
+	return sig, nil
+}
+
+// Keyring is the set of trusted and revoked signing keys
+type Keyring struct {
+	keys    map[KeyID]PublicKey
+	revoked map[KeyID]bool
+}
+
+// NewKeyring builds a keyring from minisign public keys and revoked key IDs
+func NewKeyring(trusted, revoked []string) (*Keyring, error) {
+	k := &Keyring{keys: map[KeyID]PublicKey{}, revoked: map[KeyID]bool{}}
+	for _, text := range trusted {
+		key, err := ParsePublicKey(text)
+		if err != nil {
+			return nil, err
+		}
+		k.keys[key.ID] = key
+	}
+	for _, text := range revoked {
+		id, err := ParseKeyID(text)
+		if err != nil {
+			return nil, err
+		}
+		k.revoked[id] = true
+	}
+	return k, nil
+}
+
+// SplitKeys splits a comma-separated key list such as EmbeddedKeys
+func SplitKeys(list string) []string {
+	var keys []string
+	for _, key := range strings.Split(list, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Len returns the number of usable keys
+func (k *Keyring) Len() int {
+	n := 0
+	for id := range k.keys {
+		if !k.revoked[id] {
+			n++
+		}
+	}
+	return n
+}
+
+// Verify reads the signed content from r and checks it against the
+// signature. It returns the parsed signature, whose key ID and trusted
+// comment identify what was verified.
+func (k *Keyring) Verify(r io.Reader, signature []byte) (*Signature, error) {
+	if k.Len() == 0 {
+		return nil, ErrNoKeys
+	}
+
+	sig, err := ParseSignature(signature)
+	if err != nil {
+		return nil, err
+	}
+	if k.revoked[sig.KeyID] {
+		return nil, fmt.Errorf("%w %s", ErrRevokedKey, sig.KeyID)
+	}
+	key, ok := k.keys[sig.KeyID]
+	if !ok {
+		return nil, fmt.Errorf("%w %s", ErrUnknownKey, sig.KeyID)
+	}
+
+	var message []byte
+	if sig.Algorithm == algEd25519Hashed {
+		h := newBlake2b512()
+		if _, err := io.Copy(h, r); err != nil {
+			return nil, fmt.Errorf("error reading signed file: %w", err)
+		}
+		message = h.Sum(nil)
+	} else {
+		if message, err = io.ReadAll(r); err != nil {
+			return nil, fmt.Errorf("error reading signed file: %w", err)
+		}
+	}
+
+	if !ed25519.Verify(key.Key, message, sig.Signature) {
+		return nil, ErrBadSignature
+	}
+	// The global signature stops the trusted comment being swapped
+	global := append(slices.Clone(sig.Signature), sig.TrustedComment...)
+	if !ed25519.Verify(key.Key, global, sig.GlobalSig) {
+		return nil, fmt.Errorf("%w: trusted comment was altered", ErrBadSignature)
+	}
+
+	return sig, nil
+}
@@ -0,0 +1,184 @@
+package signing
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testKey is a signing key pair in minisign format
+type testKey struct {
+	id     KeyID
+	public string
+	secret ed25519.PrivateKey
+}
+
+func newTestKey(t *testing.T) testKey {
+	t.Helper()
+	public, secret, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	var id KeyID
+	_, err = rand.Read(id[:])
+	require.NoError(t, err)
+
+	raw := append([]byte(algEd25519), id[:]...)
+	raw = append(raw, public...)
+	return testKey{
+		id:     id,
+		public: "untrusted comment: minisign public key " + id.String() + "\n" + base64.StdEncoding.EncodeToString(raw) + "\n",
+		secret: secret,
+	}
+}
+
+// sign creates a minisign signature file for data
+func (k testKey) sign(data []byte, algorithm, trustedComment string) []byte {
+	message := data
+	if algorithm == algEd25519Hashed {
+		h := newBlake2b512()
+		h.Write(data)
+		message = h.Sum(nil)
+	}
+	sig := ed25519.Sign(k.secret, message)
+	global := ed25519.Sign(k.secret, append(bytes.Clone(sig), trustedComment...))
+
+	raw := append([]byte(algorithm), k.id[:]...)
+	raw = append(raw, sig...)
+	return []byte(fmt.Sprintf("untrusted comment: signature from minisign secret key\n%s\ntrusted comment: %s\n%s\n",
+		base64.StdEncoding.EncodeToString(raw), trustedComment, base64.StdEncoding.EncodeToString(global)))
+}
+
+func TestBlake2b512(t *testing.T) {
+	// Reference digests from the RFC 7693 implementation
+	tests := []struct {
+		input    []byte
+		expected string
+	}{
+		{nil, "786a02f742015903c6c6fd852552d272912f4740e15847618a86e217f71f5419d25e1031afee585313896444934eb04b903a685b1448b755d56f701afe9be2ce"},
+		{[]byte("abc"), "ba80a53f981c4d0d6a2797b69f12f6e94c212f14685ac4b74b12bb6fdbffa2d17d87c5392aab792dc252d5de4533cc9518d38aa8dbf1925ab92386edd4009923"},
+		{bytes.Repeat([]byte("a"), 128), "fc6c71f688f43ea7d60817478808f3cac753e61571865c95adbc2d9122c943a76b92c2cb1047ef3fe7bf6e436ec1d0a99a9e5b216780bf7fed9d7ca91d3a8f3b"},
+		{bytes.Repeat([]byte("a"), 129), "55e6e0eb418149a8af92fd9ddc99254781b2f522a131b4f4d984404b71a00e1167b8124d5dcddd4c6977b299392335d6edd303da6d344d74bbef2d38101b232b"},
+	}
+
+	for _, tt := range tests {
+		h := newBlake2b512()
+		// Split writes must give the same digest as one write
+		half := len(tt.input) / 2
+		h.Write(tt.input[:half])
+		h.Write(tt.input[half:])
+		assert.Equal(t, tt.expected, hex.EncodeToString(h.Sum(nil)), "input length %d", len(tt.input))
+	}
+}
+
+func TestKeyID(t *testing.T) {
+	id := KeyID{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}
+	assert.Equal(t, "0807060504030201", id.String())
+
+	parsed, err := ParseKeyID("0807060504030201")
+	require.NoError(t, err)
+	assert.Equal(t, id, parsed)
+
+	_, err = ParseKeyID("0807")
+	assert.Error(t, err)
+}
+
+func TestKeyring_Verify(t *testing.T) {
+	current := newTestKey(t)
+	next := newTestKey(t)
+	other := newTestKey(t)
+	binary := bytes.Repeat([]byte("\x7fELF agent binary "), 1000)
+
+	keyring, err := NewKeyring([]string{current.public, next.public}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, keyring.Len())
+
+	t.Run("prehashed", func(t *testing.T) {
+		sig, err := keyring.Verify(bytes.NewReader(binary), current.sign(binary, algEd25519Hashed, "patchmon-agent 1.3.1"))
+		require.NoError(t, err)
+		assert.Equal(t, current.id, sig.KeyID)
+		assert.Equal(t, "patchmon-agent 1.3.1", sig.TrustedComment)
+	})
+
+	t.Run("legacy", func(t *testing.T) {
+		_, err := keyring.Verify(bytes.NewReader(binary), current.sign(binary, algEd25519, "legacy"))
+		assert.NoError(t, err)
+	})
+
+	t.Run("rotated key", func(t *testing.T) {
+		_, err := keyring.Verify(bytes.NewReader(binary), next.sign(binary, algEd25519Hashed, "next"))
+		assert.NoError(t, err)
+	})
+
+	t.Run("untrusted key", func(t *testing.T) {
+		_, err := keyring.Verify(bytes.NewReader(binary), other.sign(binary, algEd25519Hashed, "other"))
+		assert.ErrorIs(t, err, ErrUnknownKey)
+	})
+
+	t.Run("modified binary", func(t *testing.T) {
+		sig := current.sign(binary, algEd25519Hashed, "patchmon-agent 1.3.1")
+		tampered := append(bytes.Clone(binary), 0x90)
+		_, err := keyring.Verify(bytes.NewReader(tampered), sig)
+		assert.ErrorIs(t, err, ErrBadSignature)
+	})
+
+	t.Run("altered trusted comment", func(t *testing.T) {
+		sig := current.sign(binary, algEd25519Hashed, "patchmon-agent 1.3.1")
+		sig = bytes.Replace(sig, []byte("1.3.1"), []byte("9.9.9"), 1)
+		_, err := keyring.Verify(bytes.NewReader(binary), sig)
+		assert.ErrorIs(t, err, ErrBadSignature)
+	})
+
+	t.Run("malformed signature", func(t *testing.T) {
+		_, err := keyring.Verify(bytes.NewReader(binary), []byte("not a signature"))
+		assert.Error(t, err)
+	})
+}
+
+func TestKeyring_Revoked(t *testing.T) {
+	old := newTestKey(t)
+	current := newTestKey(t)
+	binary := []byte("agent")
+
+	keyring, err := NewKeyring([]string{old.public, current.public}, []string{old.id.String()})
+	require.NoError(t, err)
+	assert.Equal(t, 1, keyring.Len())
+
+	_, err = keyring.Verify(bytes.NewReader(binary), old.sign(binary, algEd25519Hashed, "old"))
+	assert.ErrorIs(t, err, ErrRevokedKey)
+	_, err = keyring.Verify(bytes.NewReader(binary), current.sign(binary, algEd25519Hashed, "current"))
+	assert.NoError(t, err)
+
+	// Without usable keys nothing verifies
+	keyring, err = NewKeyring([]string{old.public}, []string{old.id.String()})
+	require.NoError(t, err)
+	_, err = keyring.Verify(bytes.NewReader(binary), current.sign(binary, algEd25519Hashed, "current"))
+	assert.ErrorIs(t, err, ErrNoKeys)
+}
+
+func TestParsePublicKey(t *testing.T) {
+	key := newTestKey(t)
+
+	parsed, err := ParsePublicKey(key.public)
+	require.NoError(t, err)
+	assert.Equal(t, key.id, parsed.ID)
+
+	// The bare base64 line is accepted too
+	bare, err := lastDataLine(key.public)
+	require.NoError(t, err)
+	parsed, err = ParsePublicKey(bare)
+	require.NoError(t, err)
+	assert.Equal(t, key.id, parsed.ID)
+
+	_, err = ParsePublicKey("RWQ=")
+	assert.Error(t, err)
+	_, err = NewKeyring([]string{"garbage"}, nil)
+	assert.Error(t, err)
+	assert.Equal(t, []string{"RWQa", "RWQb"}, SplitKeys(" RWQa, ,RWQb "))
+}
@@ -0,0 +1,172 @@
+// Package wsproto defines the message envelope exchanged with the PatchMon
+// server over the agent WebSocket.
+//
+// Every versioned message is an envelope:
+//
+//	{"v":1,"id":"...","type":"report_now","payload":{...}}
+//
+// The agent answers each command with an ack frame once the command has been
+// accepted, optional progress frames while it runs, and finally a result or
+// error frame. Reply frames carry the command's ID in reply_to.
+//
+// Servers that predate the envelope send bare messages with their fields at
+// the top level, e.g. {"type":"settings_update","update_interval":60}. These
+// are still accepted and decoded with Version 0.
+package wsproto
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ProtocolVersion is the envelope version spoken by this agent
+const ProtocolVersion = 1
+
+// Reply frame types sent by the agent
+const (
+	TypeAck      = "ack"
+	TypeProgress = "progress"
+	TypeResult   = "result"
+	TypeError    = "error"
+)
+
+// Error codes carried in error frames
+const (
+	ErrCodeMalformed          = "malformed"
+	ErrCodeUnsupportedVersion = "unsupported_version"
+	ErrCodeUnknownCommand     = "unknown_command"
+	ErrCodeInvalidPayload     = "invalid_payload"
+	ErrCodeBusy               = "busy"
+	ErrCodeDenied             = "denied"
+	ErrCodeFailed             = "failed"
+)
+
+// Envelope is a single WebSocket message
+type Envelope struct {
+	Version int             `json:"v"`
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	ReplyTo string          `json:"reply_to,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// ErrorPayload is the payload of an error frame
+type ErrorPayload struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Details any    `json:"details,omitempty"`
+}
+
+// Error is a protocol error that is reported to the server with its code
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// Errorf creates a protocol error with the given code
+func Errorf(code, format string, args ...any) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// Legacy reports whether the message is a bare, pre-envelope message
+func (e Envelope) Legacy() bool {
+	return e.Version == 0
+}
+
+// Decode parses a message received from the server. Bare legacy messages are
+// returned with Version 0 and the whole message as payload, so their
+// top-level fields decode like an envelope payload would.
+func Decode(data []byte) (Envelope, error) {
+	var probe struct {
+		Version *int   `json:"v"`
+		ID      string `json:"id"`
+		Type    string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return Envelope{}, Errorf(ErrCodeMalformed, "invalid JSON: %v", err)
+	}
+
+	if probe.Version == nil {
+		if probe.Type == "" {
+			return Envelope{}, Errorf(ErrCodeMalformed, "message has no type")
+		}
+		return Envelope{ID: probe.ID, Type: probe.Type, Payload: json.RawMessage(data)}, nil
+	}
+
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return Envelope{}, Errorf(ErrCodeMalformed, "invalid envelope: %v", err)
+	}
+	if env.Version < 1 || env.Version > ProtocolVersion {
+		return env, Errorf(ErrCodeUnsupportedVersion, "unsupported protocol version %d", env.Version)
+	}
+	if env.Type == "" {
+		return env, Errorf(ErrCodeMalformed, "message has no type")
+	}
+	if env.ID == "" {
+		return env, Errorf(ErrCodeMalformed, "message has no id")
+	}
+	return env, nil
+}
+
+// DecodePayload unmarshals the payload into v. An absent payload leaves v
+// untouched.
+func (e Envelope) DecodePayload(v any) error {
+	if len(e.Payload) == 0 || string(e.Payload) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(e.Payload, v); err != nil {
+		return Errorf(ErrCodeInvalidPayload, "invalid %s payload: %v", e.Type, err)
+	}
+	return nil
+}
+
+// NewReply builds a reply frame to the command with ID replyTo
+func NewReply(frameType, replyTo string, payload any) (Envelope, error) {
+	env := Envelope{
+		Version: ProtocolVersion,
+		ID:      NewID(),
+		Type:    frameType,
+		ReplyTo: replyTo,
+	}
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return Envelope{}, fmt.Errorf("failed to encode %s payload: %w", frameType, err)
+		}
+		env.Payload = data
+	}
+	return env, nil
+}
+
+// NewErrorReply builds an error frame for err. Protocol errors keep their
+// code, anything else is reported as failed.
+func NewErrorReply(replyTo string, err error, details any) Envelope {
+	payload := ErrorPayload{Code: ErrCodeFailed, Message: err.Error(), Details: details}
+	var protoErr *Error
+	if errors.As(err, &protoErr) {
+		payload.Code = protoErr.Code
+		payload.Message = protoErr.Message
+	}
+	// ErrorPayload always encodes unless details cannot be
+	env, encodeErr := NewReply(TypeError, replyTo, payload)
+	if encodeErr != nil {
+		payload.Details = nil
+		env, _ = NewReply(TypeError, replyTo, payload)
+	}
+	return env
+}
+
+// NewID returns a random message ID
+func NewID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,129 @@
+package wsproto
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected Envelope
+		errCode  string
+	}{
+		{
+			name:  "envelope",
+			input: `{"v":1,"id":"c1","type":"settings_update","payload":{"update_interval":30}}`,
+			expected: Envelope{
+				Version: 1,
+				ID:      "c1",
+				Type:    "settings_update",
+				Payload: json.RawMessage(`{"update_interval":30}`),
+			},
+		},
+		{
+			name:     "envelope without payload",
+			input:    `{"v":1,"id":"c2","type":"report_now"}`,
+			expected: Envelope{Version: 1, ID: "c2", Type: "report_now"},
+		},
+		{
+			name:  "legacy",
+			input: `{"type":"settings_update","update_interval":60}`,
+			expected: Envelope{
+				Type:    "settings_update",
+				Payload: json.RawMessage(`{"type":"settings_update","update_interval":60}`),
+			},
+		},
+		{
+			name:  "legacy with id",
+			input: `{"type":"apply_updates","id":"a1","mode":"all"}`,
+			expected: Envelope{
+				ID:      "a1",
+				Type:    "apply_updates",
+				Payload: json.RawMessage(`{"type":"apply_updates","id":"a1","mode":"all"}`),
+			},
+		},
+		{name: "not json", input: `report_now`, errCode: ErrCodeMalformed},
+		{name: "legacy without type", input: `{"update_interval":60}`, errCode: ErrCodeMalformed},
+		{name: "envelope without id", input: `{"v":1,"type":"report_now"}`, errCode: ErrCodeMalformed},
+		{name: "envelope without type", input: `{"v":1,"id":"c3"}`, errCode: ErrCodeMalformed},
+		{name: "future version", input: `{"v":2,"id":"c4","type":"report_now"}`, errCode: ErrCodeUnsupportedVersion},
+		{name: "bad payload type", input: `{"v":1,"id":"c5","type":"report_now","payload":"x","reply_to":5}`, errCode: ErrCodeMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env, err := Decode([]byte(tt.input))
+			if tt.errCode != "" {
+				var protoErr *Error
+				require.True(t, errors.As(err, &protoErr), "expected protocol error, got %v", err)
+				assert.Equal(t, tt.errCode, protoErr.Code)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, env)
+			assert.Equal(t, tt.expected.Version == 0, env.Legacy())
+		})
+	}
+}
+
+func TestEnvelope_DecodePayload(t *testing.T) {
+	var settings struct {
+		UpdateInterval int `json:"update_interval"`
+	}
+
+	env, err := Decode([]byte(`{"v":1,"id":"c1","type":"settings_update","payload":{"update_interval":15}}`))
+	require.NoError(t, err)
+	require.NoError(t, env.DecodePayload(&settings))
+	assert.Equal(t, 15, settings.UpdateInterval)
+
+	env, err = Decode([]byte(`{"type":"settings_update","update_interval":45}`))
+	require.NoError(t, err)
+	require.NoError(t, env.DecodePayload(&settings))
+	assert.Equal(t, 45, settings.UpdateInterval)
+
+	env, err = Decode([]byte(`{"v":1,"id":"c2","type":"settings_update","payload":{"update_interval":"soon"}}`))
+	require.NoError(t, err)
+	err = env.DecodePayload(&settings)
+	var protoErr *Error
+	require.True(t, errors.As(err, &protoErr))
+	assert.Equal(t, ErrCodeInvalidPayload, protoErr.Code)
+
+	// An absent payload is not an error
+	env = Envelope{Version: 1, ID: "c3", Type: "report_now"}
+	assert.NoError(t, env.DecodePayload(&settings))
+}
+
+func TestNewReply(t *testing.T) {
+	env, err := NewReply(TypeResult, "c1", map[string]int{"update_interval": 30})
+	require.NoError(t, err)
+	assert.Equal(t, ProtocolVersion, env.Version)
+	assert.Len(t, env.ID, 32)
+	assert.Equal(t, "c1", env.ReplyTo)
+	assert.JSONEq(t, `{"update_interval":30}`, string(env.Payload))
+
+	env, err = NewReply(TypeAck, "c1", nil)
+	require.NoError(t, err)
+	assert.Nil(t, env.Payload)
+
+	data, err := json.Marshal(env)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"v":1,"id":"`+env.ID+`","type":"ack","reply_to":"c1"}`, string(data))
+}
+
+func TestNewErrorReply(t *testing.T) {
+	env := NewErrorReply("c1", Errorf(ErrCodeUnknownCommand, "unknown command %q", "reboot"), nil)
+	assert.Equal(t, TypeError, env.Type)
+	assert.JSONEq(t, `{"code":"unknown_command","message":"unknown command \"reboot\""}`, string(env.Payload))
+
+	env = NewErrorReply("c2", errors.New("apt-get exited with code 100"), map[string]int{"exit_code": 100})
+	assert.JSONEq(t, `{"code":"failed","message":"apt-get exited with code 100","details":{"exit_code":100}}`, string(env.Payload))
+
+	env = NewErrorReply("c3", errors.New("boom"), func() {})
+	assert.JSONEq(t, `{"code":"failed","message":"boom"}`, string(env.Payload))
+}
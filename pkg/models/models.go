@@ -1,12 +1,26 @@
 package models
 
+import "time"
+
 // Package represents a software package
 type Package struct {
-	Name             string `json:"name"`
-	CurrentVersion   string `json:"currentVersion"`
-	AvailableVersion string `json:"availableVersion,omitempty"`
-	NeedsUpdate      bool   `json:"needsUpdate"`
-	IsSecurityUpdate bool   `json:"isSecurityUpdate"`
+	Name             string   `json:"name"`
+	CurrentVersion   string   `json:"currentVersion"`
+	AvailableVersion string   `json:"availableVersion,omitempty"`
+	NeedsUpdate      bool     `json:"needsUpdate"`
+	IsSecurityUpdate bool     `json:"isSecurityUpdate"`
+	Source           string   `json:"source,omitempty"` // Package ecosystem, e.g. apt, dnf, snap, flatpak
+	Architecture     string   `json:"architecture,omitempty"`
+	SourcePackage    string   `json:"sourcePackage,omitempty"`
+	InstalledSize    int64    `json:"installedSize,omitempty"` // Bytes
+	InstallState     string   `json:"installState,omitempty"`  // e.g. installed, half-installed, config-files
+	UpdateKind       string   `json:"updateKind,omitempty"`    // epoch, major, minor, patch, revision or downgrade
+	AdvisoryID       string   `json:"advisoryId,omitempty"`    // e.g. RHSA-2023:5312, ALSA-2023:5312, FEDORA-2023-1a2b3c4d5e
+	AdvisoryType     string   `json:"advisoryType,omitempty"`  // security, bugfix, enhancement or newpackage
+	Severity         string   `json:"severity,omitempty"`      // Critical, Important, Moderate or Low
+	CVEs             []string `json:"cves,omitempty"`
+	Origin           string   `json:"origin,omitempty"`    // Repository release of the update; for security updates the one that matched
+	HoldState        string   `json:"holdState,omitempty"` // kept-back, held or version-locked
 }
 
 // Repository represents a software repository
@@ -132,7 +146,61 @@ type VersionResponse struct {
 
 // UpdateIntervalResponse represents update interval response
 type UpdateIntervalResponse struct {
-	UpdateInterval int `json:"updateInterval"`
+	UpdateInterval int             `json:"updateInterval"`
+	Schedule       *ReportSchedule `json:"schedule,omitempty"`
+}
+
+// ReportSchedule configures when serve mode sends periodic reports. Without
+// cron expressions reports follow the update interval.
+type ReportSchedule struct {
+	Cron            []string         `yaml:"cron" mapstructure:"cron" json:"cron,omitempty"`
+	Timezone        string           `yaml:"timezone" mapstructure:"timezone" json:"timezone,omitempty"`
+	BlackoutWindows []BlackoutWindow `yaml:"blackout_windows" mapstructure:"blackout_windows" json:"blackout_windows,omitempty"`
+}
+
+// IsZero reports whether the schedule sets nothing
+func (s ReportSchedule) IsZero() bool {
+	return len(s.Cron) == 0 && s.Timezone == "" && len(s.BlackoutWindows) == 0
+}
+
+// BlackoutWindow is a recurring period in which no scheduled report runs
+type BlackoutWindow struct {
+	Days  []string `yaml:"days" mapstructure:"days" json:"days,omitempty"` // mon..sun, every day if empty
+	Start string   `yaml:"start" mapstructure:"start" json:"start"`        // HH:MM
+	End   string   `yaml:"end" mapstructure:"end" json:"end"`              // HH:MM
+}
+
+// UpdatePolicy controls when the agent updates itself automatically after a
+// report. The server's auto-update settings for the host must allow it too.
+type UpdatePolicy struct {
+	Channel    string         `yaml:"channel" mapstructure:"channel"`         // stable (default) or beta
+	Pin        string         `yaml:"pin" mapstructure:"pin"`                 // Only ever adopt this version
+	MinimumAge time.Duration  `yaml:"minimum_age" mapstructure:"minimum_age"` // How long a release must be out before it is adopted
+	Rollout    time.Duration  `yaml:"rollout" mapstructure:"rollout"`         // Period over which hosts adopt a release, after MinimumAge
+	Timezone   string         `yaml:"timezone" mapstructure:"timezone"`
+	Windows    []UpdateWindow `yaml:"windows" mapstructure:"windows"` // Update only inside these windows, any time if empty
+}
+
+// IsZero reports whether the policy sets nothing
+func (p UpdatePolicy) IsZero() bool {
+	return p.Channel == "" && p.Pin == "" && p.MinimumAge == 0 && p.Rollout == 0 && p.Timezone == "" && len(p.Windows) == 0
+}
+
+// UpdateWindow is a recurring period in which the agent may update itself
+type UpdateWindow struct {
+	Days  []string `yaml:"days" mapstructure:"days"`   // mon..sun, every day if empty
+	Start string   `yaml:"start" mapstructure:"start"` // HH:MM
+	End   string   `yaml:"end" mapstructure:"end"`     // HH:MM
+}
+
+// AgentRollbackPayload reports a self-update that was rolled back because
+// the new version did not come up healthy
+type AgentRollbackPayload struct {
+	FailedVersion   string    `json:"failedVersion"`
+	RestoredVersion string    `json:"restoredVersion"`
+	Reason          string    `json:"reason"`
+	InstalledAt     time.Time `json:"installedAt"`
+	RolledBackAt    time.Time `json:"rolledBackAt"`
 }
 
 // AgentTimestampResponse represents agent timestamp response
@@ -156,9 +224,17 @@ type Credentials struct {
 
 // Config represents agent configuration
 type Config struct {
-	PatchmonServer  string `yaml:"patchmon_server" mapstructure:"patchmon_server"`
-	APIVersion      string `yaml:"api_version" mapstructure:"api_version"`
-	CredentialsFile string `yaml:"credentials_file" mapstructure:"credentials_file"`
-	LogFile         string `yaml:"log_file" mapstructure:"log_file"`
-	LogLevel        string `yaml:"log_level" mapstructure:"log_level"`
+	PatchmonServer  string         `yaml:"patchmon_server" mapstructure:"patchmon_server"`
+	APIVersion      string         `yaml:"api_version" mapstructure:"api_version"`
+	CredentialsFile string         `yaml:"credentials_file" mapstructure:"credentials_file"`
+	LogFile         string         `yaml:"log_file" mapstructure:"log_file"`
+	LogLevel        string         `yaml:"log_level" mapstructure:"log_level"`
+	ReportJitter    time.Duration  `yaml:"report_jitter" mapstructure:"report_jitter"`
+	Schedule        ReportSchedule `yaml:"schedule" mapstructure:"schedule"`
+	BackupRetention int            `yaml:"backup_retention" mapstructure:"backup_retention"` // Agent builds kept after self-updates
+	// Minisign public keys trusted to sign agent binaries, in addition to
+	// those built into the agent, and key IDs that are no longer trusted
+	UpdatePublicKeys  []string     `yaml:"update_public_keys" mapstructure:"update_public_keys"`
+	UpdateRevokedKeys []string     `yaml:"update_revoked_keys" mapstructure:"update_revoked_keys"`
+	AutoUpdate        UpdatePolicy `yaml:"auto_update" mapstructure:"auto_update"`
 }